@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Права доступа к разделам задаются файлом .access.yaml в директории
+// или секцией access в config.yaml:
+//
+//	groups: [HR, Руководители]
+//	users: [ivanov, petrov]
+//
+// Раздел видят пользователи из перечисленных групп и перечисленные пользователи;
+// "*" в users - любой вошедший пользователь. Правило действует на директорию
+// и все вложенные, пока ниже не встретится своё правило. Если для одной
+// директории есть и файл, и правило в config.yaml, действует config.yaml.
+// Анонимным пользователям закрытые разделы не видны никогда.
+const accessFileName = ".access.yaml"
+
+// accessRule - кому доступен раздел. Пустое правило не пускает никого.
+type accessRule struct {
+	Groups []string `yaml:"groups"`
+	Users  []string `yaml:"users"`
+}
+
+// allows проверяет, доступен ли раздел пользователю u (nil - анонимный).
+// nil-правило означает отсутствие ограничений.
+func (a *accessRule) allows(u *User) bool {
+	if a == nil {
+		return true
+	}
+	if u == nil {
+		return false
+	}
+	for _, name := range a.Users {
+		if name == "*" || strings.EqualFold(name, u.Name) {
+			return true
+		}
+	}
+	for _, g := range a.Groups {
+		if u.InGroup(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessRules - правила доступа, ключ - нормализованный путь директории (см. accessKey).
+type accessRules map[string]*accessRule
+
+func (rules accessRules) set(dir string, rule *accessRule) {
+	rules[accessKey(dir)] = rule
+}
+
+// accessKey нормализует относительный путь директории: "/" в качестве разделителя,
+// без "/" по краям, "" для корня. Регистр и завершающие точки и пробелы
+// в именах отбрасываются, потому что Windows открывает "hr/" и "HR./"
+// как ту же директорию, что и "HR/", - иначе правило можно было бы обойти,
+// изменив регистр в адресе.
+func accessKey(dir string) string {
+	dir = path.Clean("/" + strings.ReplaceAll(dir, "\\", "/"))
+	if dir == "/" {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimRight(p, ". "))
+	}
+	return strings.Join(parts, "/")
+}
+
+// parseAccessRules проверяет секцию access из config.yaml.
+func parseAccessRules(y map[string]accessRule) (accessRules, error) {
+	rules := make(accessRules, len(y))
+	for dir, rule := range y {
+		for _, part := range strings.Split(strings.ReplaceAll(dir, "\\", "/"), "/") {
+			if part == ".." {
+				return nil, fmt.Errorf("access: invalid directory %q", dir)
+			}
+		}
+		rules.set(dir, &rule)
+	}
+	return rules, nil
+}
+
+// loadAccessFile читает .access.yaml.
+func loadAccessFile(path string) (*accessRule, error) {
+	var rule accessRule
+	if err := readYAMLFile(path, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ruleFor возвращает правило, действующее для директории dir (с "/", "" или "." - корень):
+// ближайшее вверх по дереву, сначала из config.yaml, затем из .access.yaml.
+// nil - ограничений нет.
+func (r *DocRepository) ruleFor(res *scanResult, dir string) *accessRule {
+	key := accessKey(dir)
+	for {
+		if rule, ok := r.accessRules[key]; ok {
+			return rule
+		}
+		if rule, ok := res.access[key]; ok {
+			return rule
+		}
+		if key == "" {
+			return nil
+		}
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			key = key[:i]
+		} else {
+			key = ""
+		}
+	}
+}
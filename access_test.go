@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newAccessTestRepo creates:
+//
+//	public.pdf
+//	HR/salary.pdf          (.access.yaml: group HR)
+//	HR/Open/holidays.pdf   (.access.yaml: any logged-in user)
+//	Board/minutes.pdf      (config rule: user boss)
+func newAccessTestRepo(t *testing.T) *DocRepository {
+	t.Helper()
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"public.pdf":                "public",
+		"HR/salary.pdf":             "salary",
+		"HR/.access.yaml":           "groups: [hr]\n",
+		"HR/Open/holidays.pdf":      "holidays",
+		"HR/Open/.access.yaml":      "users: ['*']\n",
+		"Board/minutes.pdf":         "minutes",
+		"Board/.access.yaml":        "groups: [Everyone]\n",
+		"Board/README.md":           "# Board",
+		"Broken/secret.pdf":         "secret",
+		"Broken/.access.yaml":       "groups: [unclosed\n",
+		"Unrestricted/readme.txt":   "text",
+		"Unrestricted/Sub/memo.pdf": "memo",
+	}
+	for name, data := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	repo.accessRules = accessRules{}
+	// The config rule overrides Board/.access.yaml.
+	repo.accessRules.set("/Board/", &accessRule{Users: []string{"boss"}})
+	return repo
+}
+
+func sectionNames(t *testing.T, repo *DocRepository, u *User) []string {
+	t.Helper()
+	sections, err := repo.SectionsFor(u)
+	if err != nil {
+		t.Fatalf("SectionsFor failed: %v", err)
+	}
+	var names []string
+	for _, s := range sections {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestDocRepository_SectionsFor(t *testing.T) {
+	repo := newAccessTestRepo(t)
+
+	cases := []struct {
+		name string
+		user *User
+		want []string
+	}{
+		{"anonymous", nil, []string{generalSectionName, "Unrestricted", "Unrestricted/Sub"}},
+		{"logged in", &User{Name: "petrov", Groups: []string{"Everyone"}}, []string{generalSectionName, "HR/Open", "Unrestricted", "Unrestricted/Sub"}},
+		{"hr group", &User{Name: "ivanov", Groups: []string{"HR"}}, []string{generalSectionName, "HR", "HR/Open", "Unrestricted", "Unrestricted/Sub"}},
+		{"config user", &User{Name: "Boss"}, []string{generalSectionName, "Board", "HR/Open", "Unrestricted", "Unrestricted/Sub"}},
+	}
+	for _, c := range cases {
+		got := sectionNames(t, repo, c.user)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: sections = %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: sections = %v, want %v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+
+	// All sections are still available without filtering.
+	all, err := repo.GetSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 7 {
+		t.Errorf("expected 7 sections in total, got %d", len(all))
+	}
+}
+
+func TestDocRepository_SearchForHidesRestrictedDocuments(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "HR"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"rules.md":        "Vacation rules for everyone",
+		"HR/salary.md":    "Vacation pay and salary",
+		"HR/.access.yaml": "groups: [HR]",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := NewDocRepository(tmpDir, time.Minute)
+
+	results, err := repo.SearchFor(nil, "vacation", 1)
+	if err != nil {
+		t.Fatalf("SearchFor failed: %v", err)
+	}
+	// Restricted documents are filtered before the limit is applied.
+	if len(results) != 1 || results[0].Name != "rules.md" {
+		t.Fatalf("expected only rules.md for anonymous user, got %+v", results)
+	}
+
+	results, err = repo.SearchFor(&User{Name: "ivanov", Groups: []string{"hr"}}, "vacation", 10)
+	if err != nil {
+		t.Fatalf("SearchFor failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results for HR member, got %+v", results)
+	}
+}
+
+func TestDocsFileHandler_EnforcesAccess(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	for name, data := range map[string]string{
+		"Unrestricted/meta.yaml":               "readme.txt:\n  title: Памятка\n",
+		"Unrestricted/readme.txt.yaml":         "title: Памятка\n",
+		"Unrestricted/Restricted/a.pdf":        "a",
+		"Unrestricted/Restricted/.access.yaml": "users: [boss]\n",
+	} {
+		p := filepath.Join(repo.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := http.StripPrefix("/docs/", docsFileHandler(repo, nil, nil))
+	hr := &User{Name: "ivanov", Groups: []string{"HR"}}
+
+	cases := []struct {
+		url    string
+		user   *User
+		status int
+	}{
+		{"/docs/public.pdf", nil, http.StatusOK},
+		{"/docs/HR/salary.pdf", nil, http.StatusNotFound},
+		{"/docs/HR/salary.pdf", &User{Name: "petrov"}, http.StatusNotFound},
+		{"/docs/HR/salary.pdf", hr, http.StatusOK},
+		// Other spellings of the same directory on case-insensitive file systems.
+		{"/docs/hr/salary.pdf", nil, http.StatusNotFound},
+		{"/docs/HR./salary.pdf", nil, http.StatusNotFound},
+		{"/docs/Unrestricted/../HR/salary.pdf", nil, http.StatusNotFound},
+		// Directory listing of a restricted section.
+		{"/docs/HR/", nil, http.StatusNotFound},
+		{"/docs/HR/Open/holidays.pdf", &User{Name: "petrov"}, http.StatusOK},
+		{"/docs/Broken/secret.pdf", hr, http.StatusNotFound},
+		// The rule files themselves are never served.
+		{"/docs/HR/.access.yaml", hr, http.StatusNotFound},
+		// Neither are document descriptions.
+		{"/docs/Unrestricted/meta.yaml", hr, http.StatusNotFound},
+		{"/docs/Unrestricted/readme.txt.yaml", hr, http.StatusNotFound},
+		// Windows drops trailing dots and spaces and would open the real files.
+		{"/docs/Unrestricted/.access.yaml.", hr, http.StatusNotFound},
+		{"/docs/Unrestricted/meta.yaml%20", hr, http.StatusNotFound},
+		// Listings would show restricted sub-sections and service files.
+		{"/docs/", hr, http.StatusNotFound},
+		{"/docs/Unrestricted/", hr, http.StatusNotFound},
+		{"/docs/Unrestricted", hr, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		if c.user != nil {
+			req = req.WithContext(contextWithUser(req.Context(), c.user))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s as %+v: status = %d, want %d", c.url, c.user, rec.Code, c.status)
+		}
+	}
+}
+
+func TestAccessKey(t *testing.T) {
+	cases := map[string]string{
+		"":            "",
+		".":           "",
+		"/":           "",
+		"HR":          "hr",
+		"/HR/2025/":   "hr/2025",
+		`HR\2025`:     "hr/2025",
+		"HR. /Отдел ": "hr/отдел",
+	}
+	for in, want := range cases {
+		if got := accessKey(in); got != want {
+			t.Errorf("accessKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadConfig_Access(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := []byte(`
+access:
+  "HR/2025": { groups: [HR], users: [ivanov] }
+  "/": { users: ["*"] }
+`)
+	if err := os.WriteFile(cfgPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if rule := cfg.Access["hr/2025"]; rule == nil || len(rule.Groups) != 1 || rule.Users[0] != "ivanov" {
+		t.Errorf("unexpected HR/2025 rule: %+v", rule)
+	}
+	if rule := cfg.Access[""]; rule == nil || rule.Users[0] != "*" {
+		t.Errorf("unexpected root rule: %+v", rule)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(`access: { "../etc": { users: [x] } }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(cfgPath); err == nil {
+		t.Fatalf("expected error for directory outside docs_dir")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Форматы access-лога (log_format в config.yaml); всё остальное - шаблон.
+const (
+	logFormatCombined = "combined"
+	logFormatJSON     = "json"
+)
+
+// requestIDHeader - идентификатор запроса: берётся от клиента или прокси,
+// если он там уже есть, иначе генерируется. Возвращается в ответе, чтобы
+// жалобу пользователя можно было найти в логе.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID - что принимаем как идентификатор запроса от клиента.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+var accessLog *log.Logger
+
+// accessLogFmt - формат строк accessLog; нулевое значение - combined.
+var accessLogFmt accessLogFormat
+
+// accessLogEntry - поля одной записи access-лога. Имена полей доступны
+// в пользовательском шаблоне: {{.ClientIP}}, {{.RequestID}} и т.д.
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	// ClientIP - адрес клиента; RemoteAddr - адрес, с которого пришло соединение
+	// (за обратным прокси - адрес прокси); ForwardedFor - заголовок X-Forwarded-For как есть.
+	ClientIP     string  `json:"client_ip"`
+	RemoteAddr   string  `json:"remote_addr"`
+	ForwardedFor string  `json:"forwarded_for,omitempty"`
+	User         string  `json:"user,omitempty"`
+	Method       string  `json:"method"`
+	URI          string  `json:"uri"`
+	Proto        string  `json:"proto"`
+	Route        string  `json:"route,omitempty"`
+	Status       int     `json:"status"`
+	Bytes        int     `json:"bytes"`
+	Duration     float64 `json:"duration"` // секунды
+	Referer      string  `json:"referer,omitempty"`
+	UserAgent    string  `json:"user_agent,omitempty"`
+}
+
+// accessLogFormat - формат строк access-лога.
+type accessLogFormat struct {
+	name string
+	tmpl *template.Template
+}
+
+// parseAccessLogFormat разбирает log_format: combined, json или шаблон text/template
+// с полями accessLogEntry. Шаблон сразу пробно выполняется, чтобы опечатка в имени
+// поля была ошибкой конфигурации, а не пустым логом.
+func parseAccessLogFormat(s string) (accessLogFormat, error) {
+	switch s {
+	case "", logFormatCombined:
+		return accessLogFormat{name: logFormatCombined}, nil
+	case logFormatJSON:
+		return accessLogFormat{name: logFormatJSON}, nil
+	}
+
+	tmpl, err := template.New("log_format").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return accessLogFormat{}, fmt.Errorf("invalid log_format template: %w", err)
+	}
+	if err := tmpl.Execute(new(strings.Builder), accessLogEntry{}); err != nil {
+		return accessLogFormat{}, fmt.Errorf("invalid log_format template: %w", err)
+	}
+	return accessLogFormat{name: "template", tmpl: tmpl}, nil
+}
+
+// timestamped сообщает, нужно ли log.Logger добавлять время перед строкой:
+// в JSON и шаблоне время - отдельное поле.
+func (f accessLogFormat) timestamped() bool {
+	return f.name == "" || f.name == logFormatCombined
+}
+
+func (f accessLogFormat) format(e accessLogEntry) string {
+	switch {
+	case f.tmpl != nil:
+		var b strings.Builder
+		if err := f.tmpl.Execute(&b, e); err != nil {
+			return fmt.Sprintf("log_format error: %v", err)
+		}
+		return b.String()
+	case f.name == logFormatJSON:
+		b, _ := json.Marshal(e)
+		return string(b)
+	}
+
+	// Формат, близкий к nginx combined log (без времени, его пишет log.Logger):
+	// $remote_addr - $remote_user "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time
+	user := e.User
+	if user == "" {
+		user = "-"
+	}
+	return fmt.Sprintf("%s - %s \"%s %s %s\" %d %d \"%s\" \"%s\" %.3f",
+		e.ClientIP, user, e.Method, e.URI, e.Proto, e.Status, e.Bytes, e.Referer, e.UserAgent, e.Duration)
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(statusCode int) {
+	lrw.status = statusCode
+	lrw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (lrw *loggingResponseWriter) Write(p []byte) (int, error) {
+	if lrw.status == 0 {
+		// Если явно не вызывали WriteHeader, считаем статус 200.
+		lrw.status = http.StatusOK
+	}
+	n, err := lrw.ResponseWriter.Write(p)
+	lrw.bytes += n
+	return n, err
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController:
+// без него обработчики не могут продлить тайм-аут записи или сбросить буфер.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// requestInfo - сведения о запросе, которые становятся известны во внутренних
+// обработчиках (маршрут, пользователь), а нужны loggingMiddleware снаружи.
+type requestInfo struct {
+	Route string
+	User  string
+	// ClientIP и Scheme - адрес клиента и схема по заголовкам доверенного
+	// прокси (см. proxyMiddleware); пустые, если запрос пришёл напрямую.
+	ClientIP string
+	Scheme   string
+}
+
+type requestInfoContextKey struct{}
+
+// withRequestInfo добавляет в контекст запроса пустой requestInfo.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	info := new(requestInfo)
+	return r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info)), info
+}
+
+// requestInfoFrom возвращает requestInfo запроса или nil вне loggingMiddleware.
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey{}).(*requestInfo)
+	return info
+}
+
+// remoteHost возвращает адрес, с которого пришло соединение, без порта.
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// clientIP возвращает IP-адрес клиента без порта: за доверенным прокси -
+// из X-Forwarded-For/Forwarded, иначе адрес соединения.
+func clientIP(r *http.Request) string {
+	if info := requestInfoFrom(r.Context()); info != nil && info.ClientIP != "" {
+		return info.ClientIP
+	}
+	return remoteHost(r)
+}
+
+// requestID возвращает идентификатор запроса из заголовка X-Request-ID или новый.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+
+		r, info := withRequestInfo(r)
+		lrw := &loggingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(lrw, r)
+
+		if lrw.status == 0 {
+			lrw.status = http.StatusOK
+		}
+		duration := time.Since(start)
+		metrics.observeRequest(info.Route, lrw.status, duration)
+
+		if accessLog != nil {
+			// /healthz и /readyz обычно дергаются очень часто мониторингом, поэтому
+			// по умолчанию не логируем их, чтобы не засорять access.log.
+			// Route учитывает base_path, Path - запросы мимо маршрутизатора.
+			switch {
+			case r.URL.Path == "/healthz", r.URL.Path == "/readyz",
+				info.Route == "/healthz", info.Route == "/readyz":
+				return
+			}
+
+			accessLog.Print(accessLogFmt.format(accessLogEntry{
+				Time:         start,
+				RequestID:    id,
+				ClientIP:     clientIP(r),
+				RemoteAddr:   remoteHost(r),
+				ForwardedFor: r.Header.Get("X-Forwarded-For"),
+				User:         info.User,
+				Method:       r.Method,
+				URI:          r.URL.RequestURI(),
+				Proto:        r.Proto,
+				Route:        info.Route,
+				Status:       lrw.status,
+				Bytes:        lrw.bytes,
+				Duration:     duration.Seconds(),
+				Referer:      r.Referer(),
+				UserAgent:    r.UserAgent(),
+			}))
+		}
+	})
+}
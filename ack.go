@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Бакеты хранилища подтверждений.
+var (
+	ackBucket  = []byte("acks")
+	userBucket = []byte("users")
+)
+
+// Статусы ознакомления в отчёте.
+const (
+	ackStatusAcknowledged = "acknowledged"
+	ackStatusOutdated     = "outdated"
+	ackStatusMissing      = "missing"
+)
+
+// ackStatusNames - статусы для CSV-отчёта.
+var ackStatusNames = map[string]string{
+	ackStatusAcknowledged: "ознакомлен",
+	ackStatusOutdated:     "ознакомлен с прошлой версией",
+	ackStatusMissing:      "не ознакомлен",
+}
+
+// userCookieName - cookie с именем сотрудника, который сам представился при подтверждении.
+const userCookieName = "docsrv_user"
+
+// Ack - подтверждение "Ознакомлен" одного сотрудника с одним документом.
+type Ack struct {
+	User     string `json:"user"`
+	Document string `json:"document"`
+	// Version - SHA-256 содержимого документа в момент подтверждения.
+	// Если файл потом заменили, подтверждение относится к прошлой версии.
+	Version string    `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// ackStore - подтверждения ознакомления во встроенной БД (bbolt).
+type ackStore struct {
+	db *bolt.DB
+
+	// Хэши файлов документов, чтобы не перечитывать неизменившиеся файлы для каждого отчёта.
+	*fileHasher
+}
+
+// fileHasher кэширует SHA-256 файлов (ключ - полный путь) по размеру и времени изменения.
+type fileHasher struct {
+	mu     sync.Mutex
+	hashes map[string]fileHash
+}
+
+func newFileHasher() *fileHasher {
+	return &fileHasher{hashes: make(map[string]fileHash)}
+}
+
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func openAckStore(path string) (*ackStore, error) {
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create ack database directory %q: %w", dir, err)
+		}
+	}
+
+	// Timeout - чтобы второй экземпляр сервера не зависал на блокировке файла.
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open ack database %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{ackBucket, userBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init ack database %q: %w", path, err)
+	}
+
+	return &ackStore{db: db, fileHasher: newFileHasher()}, nil
+}
+
+func (s *ackStore) Close() error {
+	return s.db.Close()
+}
+
+func ackKey(user, doc string) []byte {
+	return []byte(user + "\x00" + doc)
+}
+
+// Acknowledge сохраняет подтверждение; повторное подтверждение перезаписывает прежнее.
+func (s *ackStore) Acknowledge(a Ack) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(userBucket)
+		if users.Get([]byte(a.User)) == nil {
+			if err := users.Put([]byte(a.User), []byte(a.Time.Format(time.RFC3339))); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(ackBucket).Put(ackKey(a.User, a.Document), data)
+	})
+}
+
+// UserAcks возвращает подтверждения сотрудника, ключ - путь документа.
+func (s *ackStore) UserAcks(user string) (map[string]Ack, error) {
+	acks := make(map[string]Ack)
+	prefix := []byte(user + "\x00")
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(ackBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var a Ack
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			acks[a.Document] = a
+		}
+		return nil
+	})
+	return acks, err
+}
+
+// Acks возвращает все подтверждения.
+func (s *ackStore) Acks() ([]Ack, error) {
+	var acks []Ack
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(ackBucket).ForEach(func(_, v []byte) error {
+			var a Ack
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			acks = append(acks, a)
+			return nil
+		})
+	})
+	return acks, err
+}
+
+// Users возвращает всех сотрудников, когда-либо подтверждавших ознакомление.
+func (s *ackStore) Users() ([]string, error) {
+	var users []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(userBucket).ForEach(func(k, _ []byte) error {
+			users = append(users, string(k))
+			return nil
+		})
+	})
+	return users, err
+}
+
+// documentHash возвращает SHA-256 содержимого файла (hex).
+func (s *fileHasher) documentHash(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	cached, ok := s.hashes[path]
+	s.mu.Unlock()
+	if ok && cached.size == fi.Size() && cached.modTime.Equal(fi.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %q: %w", path, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.hashes[path] = fileHash{size: fi.Size(), modTime: fi.ModTime(), sum: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+// requestUser возвращает логин вошедшего пользователя, а без аутентификации
+// (selfDeclared) - имя, которое сотрудник указал при первом подтверждении.
+func requestUser(r *http.Request, selfDeclared bool) string {
+	if u := userFromRequest(r); u != nil {
+		return u.Name
+	}
+	if !selfDeclared {
+		return ""
+	}
+	c, err := r.Cookie(userCookieName)
+	if err != nil {
+		return ""
+	}
+	name, err := url.QueryUnescape(c.Value)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+// findDocument ищет документ по пути относительно каталога документов.
+func findDocument(sections []Section, path string) (Section, Document, bool) {
+	for _, sec := range sections {
+		for _, doc := range sec.Documents {
+			if doc.Path == path {
+				return sec, doc, true
+			}
+		}
+	}
+	return Section{}, Document{}, false
+}
+
+// ackState - состояние подтверждения для страницы документов.
+type ackState struct {
+	Time time.Time `json:"time"`
+	// Current - подтверждена текущая версия файла.
+	Current bool `json:"current"`
+}
+
+type ackStatusResponse struct {
+	User string              `json:"user"`
+	Acks map[string]ackState `json:"acks"`
+	// LoginURL - куда отправить анонимного пользователя, чтобы он мог отмечаться.
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// ackHandler обслуживает /ack:
+//   - GET  - подтверждения текущего сотрудника (ключ - путь документа);
+//   - POST - подтвердить ознакомление с документом doc (путь документа);
+//     user - ФИО, если сотрудник ещё не представился.
+//
+// selfDeclared - аутентификация выключена, и сотрудник представляется сам;
+// иначе отмечаться могут только вошедшие пользователи.
+func ackHandler(repo *DocRepository, store *ackStore, selfDeclared bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			user := requestUser(r, selfDeclared)
+			resp := ackStatusResponse{User: user, Acks: map[string]ackState{}}
+			if user == "" {
+				if !selfDeclared {
+					resp.LoginURL = repo.basePath + "/login?next=%2F"
+				}
+				writeJSON(w, http.StatusOK, resp)
+				return
+			}
+
+			acks, err := store.UserAcks(user)
+			if err != nil {
+				log.Printf("Error reading acknowledgements of %s: %v", user, err)
+				writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not read acknowledgements"})
+				return
+			}
+			for doc, a := range acks {
+				hash, err := store.documentHash(filepath.Join(repo.dir, filepath.FromSlash(doc)))
+				resp.Acks[doc] = ackState{Time: a.Time, Current: err == nil && hash == a.Version}
+			}
+			writeJSON(w, http.StatusOK, resp)
+
+		case http.MethodPost:
+			user := requestUser(r, selfDeclared)
+			if user == "" && !selfDeclared {
+				writeJSON(w, http.StatusUnauthorized, apiError{Error: "authentication required"})
+				return
+			}
+			if user == "" {
+				user = strings.TrimSpace(r.FormValue("user"))
+				if user == "" {
+					writeJSON(w, http.StatusBadRequest, apiError{Error: "user name is required"})
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     userCookieName,
+					Value:    url.QueryEscape(user),
+					Path:     "/",
+					MaxAge:   365 * 24 * 3600,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			sections, err := repo.SectionsFor(userFromRequest(r))
+			if err != nil {
+				log.Printf("Error getting sections: %v", err)
+				writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not load documents"})
+				return
+			}
+			docPath := r.FormValue("doc")
+			if _, _, ok := findDocument(sections, docPath); !ok {
+				writeJSON(w, http.StatusNotFound, apiError{Error: "document not found"})
+				return
+			}
+
+			hash, err := store.documentHash(filepath.Join(repo.dir, filepath.FromSlash(docPath)))
+			if err != nil {
+				log.Printf("Error hashing %s: %v", docPath, err)
+				writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not read document"})
+				return
+			}
+
+			a := Ack{User: user, Document: docPath, Version: hash, Time: time.Now()}
+			if err := store.Acknowledge(a); err != nil {
+				log.Printf("Error saving acknowledgement: %v", err)
+				writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not save acknowledgement"})
+				return
+			}
+			writeJSON(w, http.StatusOK, ackState{Time: a.Time, Current: true})
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+		}
+	})
+}
+
+// ackReportRow - строка отчёта: один сотрудник и один документ.
+type ackReportRow struct {
+	Employee       string     `json:"employee"`
+	Section        string     `json:"section"`
+	Document       string     `json:"document"`
+	Title          string     `json:"title"`
+	Status         string     `json:"status"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+type ackReportResponse struct {
+	Rows []ackReportRow `json:"rows"`
+}
+
+// loadEmployees читает список сотрудников (по одному на строку, # - комментарий).
+// Пустой путь - списка нет.
+func loadEmployees(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var employees []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		employees = append(employees, line)
+	}
+	return employees, sc.Err()
+}
+
+// ackReportHandler - отчёт об ознакомлении: GET /reports/acks.
+// Строки - все пары "документ x сотрудник" по порядку документов на главной; сотрудники - из employeesFile и все,
+// кто хоть раз подтверждал ознакомление. Параметры: user и doc - отчёт по одному
+// сотруднику или документу, format=csv - выгрузка для Excel.
+// Отчёт доступен только пользователям из viewers (ack_viewers в config.yaml).
+func ackReportHandler(repo *DocRepository, store *ackStore, employeesFile string, viewers *accessRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !viewers.allows(userFromRequest(r)) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "access denied"})
+			return
+		}
+
+		sections, err := repo.SectionsFor(userFromRequest(r))
+		if err != nil {
+			log.Printf("Error getting sections: %v", err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not load documents"})
+			return
+		}
+
+		rows, err := buildAckReport(repo, store, sections, employeesFile, r.URL.Query().Get("user"), r.URL.Query().Get("doc"))
+		if err != nil {
+			log.Printf("Error building acknowledgement report: %v", err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not build report"})
+			return
+		}
+
+		if r.URL.Query().Get("format") != "csv" {
+			writeJSON(w, http.StatusOK, ackReportResponse{Rows: rows})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="acks.csv"`)
+		if err := writeAckReportCSV(w, rows); err != nil {
+			log.Printf("Error writing acknowledgement report: %v", err)
+		}
+	})
+}
+
+func buildAckReport(repo *DocRepository, store *ackStore, sections []Section, employeesFile, user, doc string) ([]ackReportRow, error) {
+	employees, err := loadEmployees(employeesFile)
+	if err != nil {
+		return nil, fmt.Errorf("read employees file: %w", err)
+	}
+	known, err := store.Users()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var all []string
+	for _, e := range append(employees, known...) {
+		if !seen[e] {
+			seen[e] = true
+			all = append(all, e)
+		}
+	}
+	if user != "" {
+		all = []string{user}
+	}
+	sort.Strings(all)
+
+	acks, err := store.Acks()
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]Ack, len(acks))
+	for _, a := range acks {
+		byKey[string(ackKey(a.User, a.Document))] = a
+	}
+
+	rows := []ackReportRow{}
+	for _, sec := range sections {
+		for _, d := range sec.Documents {
+			if doc != "" && d.Path != doc {
+				continue
+			}
+
+			// Хэш считаем, только если кто-то подтверждал этот документ.
+			var current string
+			hashed := false
+
+			for _, e := range all {
+				row := ackReportRow{Employee: e, Section: sec.Name, Document: d.Path, Title: d.DisplayName(), Status: ackStatusMissing}
+				if a, ok := byKey[string(ackKey(e, d.Path))]; ok {
+					if !hashed {
+						current, err = store.documentHash(filepath.Join(repo.dir, filepath.FromSlash(d.Path)))
+						if err != nil && !errors.Is(err, os.ErrNotExist) {
+							log.Printf("Error hashing %s: %v", d.Path, err)
+						}
+						hashed = true
+					}
+					at := a.Time
+					row.AcknowledgedAt = &at
+					row.Status = ackStatusOutdated
+					if a.Version == current {
+						row.Status = ackStatusAcknowledged
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// writeAckReportCSV пишет отчёт в CSV для Excel: UTF-8 с BOM и разделитель ";".
+func writeAckReportCSV(w io.Writer, rows []ackReportRow) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	if err := cw.Write([]string{"Сотрудник", "Раздел", "Документ", "Название", "Статус", "Дата ознакомления"}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		at := ""
+		if row.AcknowledgedAt != nil {
+			at = row.AcknowledgedAt.Format("02.01.2006 15:04")
+		}
+		if err := cw.Write([]string{csvCell(row.Employee), csvCell(row.Section), csvCell(row.Document), csvCell(row.Title),
+			ackStatusNames[row.Status], at}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell защищает ячейку от интерпретации как формулы: Excel исполняет значения,
+// начинающиеся с "=", "+", "-", "@", табуляции или перевода строки, поэтому
+// имя файла или сотрудника вида "=HYPERLINK(...)" экранируется апострофом.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAckStore(t *testing.T) *ackStore {
+	t.Helper()
+	store, err := openAckStore(filepath.Join(t.TempDir(), "data", "acks.db"))
+	if err != nil {
+		t.Fatalf("openAckStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func postAck(t *testing.T, h http.Handler, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAckHandler_AcknowledgeAndStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	hrDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(hrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	docPath := filepath.Join(hrDir, "rules.pdf")
+	if err := os.WriteFile(docPath, []byte("version 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	store := newTestAckStore(t)
+	h := ackHandler(repo, store, true)
+
+	// The user must introduce themselves on the first acknowledgement.
+	if rec := postAck(t, h, url.Values{"doc": {"HR/rules.pdf"}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without user name, got %d", rec.Code)
+	}
+	if rec := postAck(t, h, url.Values{"doc": {"HR/missing.pdf"}, "user": {"Иванов И.И."}}); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown document, got %d", rec.Code)
+	}
+
+	rec := postAck(t, h, url.Values{"doc": {"HR/rules.pdf"}, "user": {"Иванов И.И."}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != userCookieName {
+		t.Fatalf("expected user cookie, got %+v", cookies)
+	}
+
+	status := func() ackStatusResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/ack", nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp ackStatusResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return resp
+	}
+
+	resp := status()
+	if resp.User != "Иванов И.И." || !resp.Acks["HR/rules.pdf"].Current {
+		t.Fatalf("expected current acknowledgement, got %+v", resp)
+	}
+
+	// A new version of the file invalidates the acknowledgement.
+	if err := os.WriteFile(docPath, []byte("version 2, longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp = status()
+	if a, ok := resp.Acks["HR/rules.pdf"]; !ok || a.Current {
+		t.Fatalf("expected outdated acknowledgement, got %+v", resp)
+	}
+
+	// Later acknowledgements use the cookie, the user name is not required.
+	if rec := postAck(t, h, url.Values{"doc": {"HR/rules.pdf"}}, cookies[0]); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !status().Acks["HR/rules.pdf"].Current {
+		t.Fatalf("expected current acknowledgement after re-acknowledging")
+	}
+}
+
+func TestAckReportHandler_JSONAndCSV(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{"a.pdf": "a", "b.pdf": "b"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	employees := filepath.Join(t.TempDir(), "employees.txt")
+	if err := os.WriteFile(employees, []byte("# staff\nПетров П.П.\n\nИванов И.И.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	store := newTestAckStore(t)
+	h := ackHandler(repo, store, true)
+
+	if rec := postAck(t, h, url.Values{"doc": {"a.pdf"}, "user": {"Иванов И.И."}}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec := postAck(t, h, url.Values{"doc": {"b.pdf"}, "user": {"Сидоров С.С."}}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.pdf"), []byte("b, second edition"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := ackReportHandler(repo, store, employees, &accessRule{Groups: []string{"Кадры"}})
+	viewer := &User{Name: "hr", Groups: []string{"Кадры"}}
+	get := func(target string, u *User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if u != nil {
+			req = req.WithContext(contextWithUser(req.Context(), u))
+		}
+		rec := httptest.NewRecorder()
+		report.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The report lists every employee, so it is for ack_viewers only.
+	if rec := get("/reports/acks", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for anonymous user, got %d", rec.Code)
+	}
+	if rec := get("/reports/acks", &User{Name: "petrov"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a user outside ack_viewers, got %d", rec.Code)
+	}
+
+	rec := get("/reports/acks", viewer)
+	var resp ackReportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	// 2 documents x 3 employees (file + everyone who acknowledged).
+	if len(resp.Rows) != 6 {
+		t.Fatalf("expected 6 rows, got %+v", resp.Rows)
+	}
+	statuses := make(map[string]string)
+	for _, row := range resp.Rows {
+		statuses[row.Document+"|"+row.Employee] = row.Status
+	}
+	want := map[string]string{
+		"a.pdf|Иванов И.И.":  ackStatusAcknowledged,
+		"a.pdf|Петров П.П.":  ackStatusMissing,
+		"b.pdf|Сидоров С.С.": ackStatusOutdated,
+		"b.pdf|Иванов И.И.":  ackStatusMissing,
+	}
+	for k, v := range want {
+		if statuses[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, statuses[k])
+		}
+	}
+
+	// Per-employee report as CSV.
+	rec = get("/reports/acks?format=csv&user="+url.QueryEscape("Петров П.П."), viewer)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected Content-Type %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got %q", rec.Body.String())
+	}
+	if !strings.HasPrefix(lines[0], "\ufeffСотрудник;Раздел;") {
+		t.Errorf("expected BOM and ';'-separated header, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "Петров П.П.;Общее;a.pdf;a.pdf;не ознакомлен;") {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
+
+func TestWriteAckReportCSV_EscapesFormulas(t *testing.T) {
+	rows := []ackReportRow{{
+		Employee: "=HYPERLINK(\"http://evil\")",
+		Section:  "+Отдел",
+		Document: "-1.pdf",
+		Title:    "@SUM(A1)",
+		Status:   ackStatusMissing,
+	}, {
+		Employee: "Иванов И.И.",
+		Section:  "\tHR",
+		Document: "\rrules.pdf",
+		Title:    "Правила - 2025",
+		Status:   ackStatusMissing,
+	}}
+	var buf bytes.Buffer
+	if err := writeAckReportCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff")))
+	r.Comma = ';'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d", len(records))
+	}
+	want := [][]string{
+		{"'=HYPERLINK(\"http://evil\")", "'+Отдел", "'-1.pdf", "'@SUM(A1)"},
+		{"Иванов И.И.", "'\tHR", "'\rrules.pdf", "Правила - 2025"},
+	}
+	for i, w := range want {
+		for j, cell := range w {
+			if got := records[i+1][j]; got != cell {
+				t.Errorf("row %d cell %d = %q, want %q", i+1, j, got, cell)
+			}
+		}
+	}
+}
+
+func TestAckHandler_UsesAuthenticatedUser(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "rules.pdf"), []byte("rules"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := newTestAckStore(t)
+	h := ackHandler(NewDocRepository(tmpDir, time.Minute), store, false)
+
+	// With authentication enabled, self-declared names are not accepted.
+	if rec := postAck(t, h, url.Values{"doc": {"rules.pdf"}, "user": {"Кто угодно"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for anonymous user, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader("doc=rules.pdf"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(contextWithUser(req.Context(), &User{Name: "ivanov"}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	acks, err := store.UserAcks("ivanov")
+	if err != nil || len(acks) != 1 {
+		t.Fatalf("expected acknowledgement by login, got %v %v", acks, err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Версионированный JSON API для интранет-портала и скриптов.
+// Структуры ответа отделены от внутренних Section/Document, чтобы
+// изменения в репозитории не ломали формат /api/v1.
+
+type apiDocument struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Type    string    `json:"type"`
+
+	// Сведения из самого PDF.
+	PDFTitle string     `json:"pdf_title,omitempty"`
+	Author   string     `json:"author,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Pages    int        `json:"pages,omitempty"`
+
+	// Описание из файла-спутника.
+	Title     string   `json:"title,omitempty"`
+	Number    string   `json:"number,omitempty"`
+	Adopted   string   `json:"date,omitempty"`
+	Authority string   `json:"authority,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+}
+
+type apiSection struct {
+	Name           string        `json:"name"`
+	Documents      []apiDocument `json:"documents"`
+	ReadmeHTML     string        `json:"readme_html,omitempty"`
+	ReadmeMarkdown string        `json:"readme_markdown,omitempty"`
+}
+
+type apiSectionsResponse struct {
+	Sections []apiSection `json:"sections"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func newAPISection(s Section) apiSection {
+	docs := make([]apiDocument, 0, len(s.Documents))
+	for _, d := range s.Documents {
+		doc := apiDocument{
+			Name:      d.Name,
+			URL:       d.URL,
+			Size:      d.Size,
+			ModTime:   d.ModTime,
+			Type:      d.Type,
+			PDFTitle:  d.PDFTitle,
+			Author:    d.Author,
+			Pages:     d.Pages,
+			Title:     d.Title,
+			Number:    d.Number,
+			Authority: d.Authority,
+			Status:    d.Status,
+			Tags:      d.Tags,
+			Summary:   d.Summary,
+		}
+		if !d.Created.IsZero() {
+			created := d.Created
+			doc.Created = &created
+		}
+		if !d.Adopted.IsZero() {
+			doc.Adopted = d.Adopted.Format("2006-01-02")
+		}
+		docs = append(docs, doc)
+	}
+
+	return apiSection{
+		Name:           s.Name,
+		Documents:      docs,
+		ReadmeHTML:     string(s.Readme),
+		ReadmeMarkdown: s.ReadmeSource,
+	}
+}
+
+// apiSectionsHandler отдаёт дерево документов в JSON:
+//
+//   - GET /api/v1/sections        - все секции;
+//   - GET /api/v1/sections/{path} - одна секция по имени ("HR/2025", "Общее").
+func apiSectionsHandler(repo *DocRepository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sections, err := repo.SectionsFor(userFromRequest(r))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not load documents"})
+			log.Printf("Error getting sections: %v", err)
+			return
+		}
+
+		path := r.PathValue("path")
+		if path == "" {
+			resp := apiSectionsResponse{Sections: make([]apiSection, 0, len(sections))}
+			for _, s := range sections {
+				resp.Sections = append(resp.Sections, newAPISection(s))
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		for _, s := range sections {
+			if s.Name == path {
+				writeJSON(w, http.StatusOK, newAPISection(s))
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, apiError{Error: "section not found"})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAPIMux(repo *DocRepository) *http.ServeMux {
+	mux := http.NewServeMux()
+	h := apiSectionsHandler(repo)
+	mux.Handle("GET /api/v1/sections", h)
+	mux.Handle("GET /api/v1/sections/{path...}", h)
+	return mux
+}
+
+func TestAPISections_ListAndSingle(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "root.pdf"), []byte("pdf content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	yearDir := filepath.Join(tmpDir, "HR", "2025")
+	if err := os.MkdirAll(yearDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(yearDir, "plan.pdf"), []byte("plan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(yearDir, "README.md"), []byte("# HR 2025"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := newTestAPIMux(NewDocRepository(tmpDir, time.Minute))
+
+	// List
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sections", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var list apiSectionsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(list.Sections) != 2 {
+		t.Fatalf("expected 2 sections, got %d", len(list.Sections))
+	}
+
+	// Single section by nested path
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sections/HR/2025", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var sec apiSection
+	if err := json.Unmarshal(rec.Body.Bytes(), &sec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if sec.Name != "HR/2025" || len(sec.Documents) != 1 {
+		t.Fatalf("unexpected section: %+v", sec)
+	}
+	doc := sec.Documents[0]
+	if doc.Name != "plan.pdf" || doc.URL != "/docs/HR/2025/plan.pdf" || doc.Size != 4 || doc.ModTime.IsZero() {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if sec.ReadmeMarkdown != "# HR 2025" {
+		t.Errorf("expected README markdown, got %q", sec.ReadmeMarkdown)
+	}
+	if !strings.Contains(sec.ReadmeHTML, "<h1>HR 2025</h1>") {
+		t.Errorf("expected README HTML, got %q", sec.ReadmeHTML)
+	}
+}
+
+func TestAPISections_NotFound(t *testing.T) {
+	mux := newTestAPIMux(NewDocRepository(t.TempDir(), time.Minute))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/sections/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Результаты запроса документа в журнале скачиваний.
+const (
+	auditResultOK          = "ok"
+	auditResultNotModified = "not_modified"
+	auditResultDenied      = "denied"
+	auditResultNotFound    = "not_found"
+	auditResultError       = "error"
+)
+
+// Сколько записей отдаёт /reports/downloads по умолчанию и максимум.
+const (
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 10000
+)
+
+// rotatedLogSuffix - формат суффикса ротированных файлов (см. rotatingWriter.rotate).
+const rotatedLogSuffix = "20060102-150405"
+
+// auditRecord - одна строка журнала скачиваний (JSON Lines).
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	IP      string    `json:"ip"`
+	Path    string    `json:"path"`
+	Section string    `json:"section,omitempty"`
+	// SHA256 - хэш отданного файла; только для успешных запросов.
+	SHA256    string `json:"sha256,omitempty"`
+	Result    string `json:"result"`
+	Status    int    `json:"status"`
+	Bytes     int    `json:"bytes"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// auditLog - журнал скачиваний документов из /docs/: кто, когда и какую версию
+// файла получил. Пишется отдельно от access.log, в файл с ротацией.
+// Методы nil-журнала ничего не делают.
+type auditLog struct {
+	file   string
+	w      io.WriteCloser
+	hashes *fileHasher
+}
+
+func openAuditLog(file string) (*auditLog, error) {
+	w, err := newRotatingWriter(file, maxLogSizeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %q: %w", file, err)
+	}
+	return &auditLog{file: file, w: w, hashes: newFileHasher()}, nil
+}
+
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.w.Close()
+}
+
+// record записывает запрос документа rel (путь относительно каталога документов).
+// fullPath - файл на диске, его хэш пишется для успешных запросов.
+func (a *auditLog) record(r *http.Request, repo *DocRepository, rel, fullPath, result string, status, bytes int) {
+	if a == nil {
+		return
+	}
+
+	rec := auditRecord{
+		Time:      time.Now(),
+		IP:        clientIP(r),
+		Path:      rel,
+		Section:   repo.SectionName(rel),
+		Result:    result,
+		Status:    status,
+		Bytes:     bytes,
+		UserAgent: r.UserAgent(),
+	}
+	if u := userFromRequest(r); u != nil {
+		rec.User = u.Name
+	}
+	if rec.Result == auditResultOK || rec.Result == auditResultNotModified {
+		sum, err := a.hashes.documentHash(fullPath)
+		if err != nil {
+			log.Printf("Error hashing %s for audit log: %v", rel, err)
+		}
+		rec.SHA256 = sum
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Error encoding audit record: %v", err)
+		return
+	}
+	// Одна запись - один Write, чтобы строки параллельных запросов не перемешивались.
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// auditResult переводит HTTP-статус ответа в результат для журнала.
+func auditResult(status int) string {
+	switch {
+	case status == http.StatusOK || status == http.StatusPartialContent:
+		return auditResultOK
+	case status == http.StatusNotModified:
+		return auditResultNotModified
+	case status == http.StatusForbidden:
+		return auditResultDenied
+	case status == http.StatusNotFound:
+		return auditResultNotFound
+	default:
+		return auditResultError
+	}
+}
+
+// auditFilter - условия выборки из журнала. Пустые поля не ограничивают выборку.
+type auditFilter struct {
+	Path   string
+	User   string
+	Result string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+func (f auditFilter) match(rec auditRecord) bool {
+	switch {
+	case f.Path != "" && !strings.EqualFold(f.Path, rec.Path):
+		return false
+	case f.User != "" && !strings.EqualFold(f.User, rec.User):
+		return false
+	case f.Result != "" && f.Result != rec.Result:
+		return false
+	case !f.From.IsZero() && rec.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !rec.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// files возвращает файлы журнала от старых к новым: ротированные, затем текущий.
+func (a *auditLog) files() ([]string, error) {
+	matches, err := filepath.Glob(a.file + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		if _, err := time.Parse(rotatedLogSuffix, strings.TrimPrefix(m, a.file+".")); err == nil {
+			files = append(files, m)
+		}
+	}
+	// Суффикс - время ротации, поэтому лексикографический порядок совпадает с хронологическим.
+	sort.Strings(files)
+	return append(files, a.file), nil
+}
+
+// query возвращает последние записи, подходящие под фильтр, от новых к старым.
+// Читаются все файлы журнала, включая ротированные.
+func (a *auditLog) query(f auditFilter) ([]auditRecord, error) {
+	files, err := a.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []auditRecord
+	for _, name := range files {
+		if err := scanAuditFile(name, func(rec auditRecord) {
+			if !f.match(rec) {
+				return
+			}
+			found = append(found, rec)
+			// Храним не больше limit последних записей.
+			if len(found) > 2*f.Limit {
+				found = append(found[:0], found[len(found)-f.Limit:]...)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(found) > f.Limit {
+		found = found[len(found)-f.Limit:]
+	}
+	records := make([]auditRecord, 0, len(found))
+	for i := len(found) - 1; i >= 0; i-- {
+		records = append(records, found[i])
+	}
+	return records, nil
+}
+
+func scanAuditFile(name string, fn func(auditRecord)) error {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var rec auditRecord
+		// Повреждённые строки (например, обрезанные при аварийной остановке) пропускаем.
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		fn(rec)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read audit log %q: %w", name, err)
+	}
+	return nil
+}
+
+// parseAuditTime разбирает границу периода: дату ("2024-05-01") или RFC 3339.
+func parseAuditTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+type auditReportResponse struct {
+	Records []auditRecord `json:"records"`
+}
+
+// auditReportHandler - выборка из журнала скачиваний: GET /reports/downloads.
+// Параметры: doc - путь документа, user, result, from и to - период
+// (to - не включая; дата или RFC 3339), limit, format=csv - выгрузка для Excel.
+// Журнал доступен только пользователям из viewers (audit_viewers в config.yaml).
+func auditReportHandler(a *auditLog, viewers *accessRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !viewers.allows(userFromRequest(r)) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "access denied"})
+			return
+		}
+
+		q := r.URL.Query()
+		f := auditFilter{
+			Path:   strings.TrimPrefix(q.Get("doc"), "/"),
+			User:   q.Get("user"),
+			Result: q.Get("result"),
+			Limit:  defaultAuditQueryLimit,
+		}
+		for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+			if v := q.Get(name); v != "" {
+				parsed, err := parseAuditTime(v)
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid " + name})
+					return
+				}
+				*t = parsed
+			}
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid limit"})
+				return
+			}
+			f.Limit = min(n, maxAuditQueryLimit)
+		}
+
+		records, err := a.query(f)
+		if err != nil {
+			log.Printf("Error reading audit log: %v", err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "could not read audit log"})
+			return
+		}
+
+		if q.Get("format") != "csv" {
+			writeJSON(w, http.StatusOK, auditReportResponse{Records: records})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="downloads.csv"`)
+		if err := writeAuditCSV(w, records); err != nil {
+			log.Printf("Error writing audit report: %v", err)
+		}
+	})
+}
+
+// writeAuditCSV пишет выборку в CSV для Excel: UTF-8 с BOM и разделитель ";", как отчёт об ознакомлении.
+func writeAuditCSV(w io.Writer, records []auditRecord) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	if err := cw.Write([]string{"Время", "Пользователь", "IP", "Раздел", "Документ", "SHA-256", "Результат"}); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := cw.Write([]string{rec.Time.Format("02.01.2006 15:04:05"), rec.User, rec.IP,
+			rec.Section, rec.Path, rec.SHA256, rec.Result}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
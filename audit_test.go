@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestAuditLog(t *testing.T) *auditLog {
+	t.Helper()
+	a, err := openAuditLog(filepath.Join(t.TempDir(), "log", "audit.log"))
+	if err != nil {
+		t.Fatalf("openAuditLog failed: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func readAuditRecords(t *testing.T, a *auditLog) []auditRecord {
+	t.Helper()
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec auditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestDocsFileHandler_WritesAuditLog(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	audit := openTestAuditLog(t)
+	h := http.StripPrefix("/docs/", docsFileHandler(repo, audit, nil))
+	hr := &User{Name: "ivanov", Groups: []string{"HR"}}
+
+	for _, c := range []struct {
+		url  string
+		user *User
+	}{
+		{"/docs/HR/salary.pdf", hr},
+		{"/docs/HR/salary.pdf", nil},
+		{"/docs/missing.pdf", nil},
+		// Directory listings are not downloads.
+		{"/docs/Unrestricted/", nil},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		req.RemoteAddr = "10.0.0.7:51234"
+		req.Header.Set("User-Agent", "test-agent")
+		if c.user != nil {
+			req = req.WithContext(contextWithUser(req.Context(), c.user))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	records := readAuditRecords(t, audit)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 audit records, got %+v", records)
+	}
+
+	sum := sha256.Sum256([]byte("salary"))
+	ok := records[0]
+	if ok.User != "ivanov" || ok.IP != "10.0.0.7" || ok.Path != "HR/salary.pdf" || ok.Section != "HR" ||
+		ok.SHA256 != hex.EncodeToString(sum[:]) || ok.Result != auditResultOK || ok.Bytes != len("salary") ||
+		ok.UserAgent != "test-agent" || time.Since(ok.Time) > time.Minute {
+		t.Errorf("unexpected download record: %+v", ok)
+	}
+	// A denied request looks like 404 to the client but is recorded as denied, without a hash.
+	if denied := records[1]; denied.User != "" || denied.Result != auditResultDenied || denied.SHA256 != "" {
+		t.Errorf("unexpected denied record: %+v", denied)
+	}
+	if missing := records[2]; missing.Result != auditResultNotFound || missing.Section != generalSectionName {
+		t.Errorf("unexpected not found record: %+v", missing)
+	}
+}
+
+func TestAuditLog_Query(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "audit.log")
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	write := func(name string, records ...auditRecord) {
+		t.Helper()
+		var b strings.Builder
+		for _, rec := range records {
+			line, _ := json.Marshal(rec)
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		// A truncated line left after a crash is skipped.
+		b.WriteString(`{"time":"2024-`)
+		if err := os.WriteFile(name, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(file+".20240502-000000",
+		auditRecord{Time: day(1), User: "ivanov", Path: "HR/salary.pdf", Result: auditResultOK},
+		auditRecord{Time: day(1), User: "petrov", Path: "public.pdf", Result: auditResultOK},
+	)
+	write(file,
+		auditRecord{Time: day(3), User: "petrov", Path: "HR/salary.pdf", Result: auditResultDenied},
+		auditRecord{Time: day(4), User: "sidorov", Path: "HR/salary.pdf", Result: auditResultOK},
+	)
+	// Unrelated files next to the log are not read.
+	write(file+".bak", auditRecord{Time: day(5), User: "intruder", Path: "HR/salary.pdf", Result: auditResultOK})
+
+	a, err := openAuditLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	users := func(f auditFilter) string {
+		t.Helper()
+		if f.Limit == 0 {
+			f.Limit = defaultAuditQueryLimit
+		}
+		records, err := a.query(f)
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		var names []string
+		for _, rec := range records {
+			names = append(names, rec.User)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := users(auditFilter{Path: "hr/salary.pdf"}); got != "sidorov,petrov,ivanov" {
+		t.Errorf("expected downloads of the document newest first across rotated files, got %q", got)
+	}
+	if got := users(auditFilter{Path: "HR/salary.pdf", Result: auditResultOK, Limit: 1}); got != "sidorov" {
+		t.Errorf("expected only the latest successful download, got %q", got)
+	}
+	if got := users(auditFilter{User: "Petrov", From: day(2), To: day(4)}); got != "petrov" {
+		t.Errorf("expected petrov's records from May 2 to May 4, got %q", got)
+	}
+}
+
+func TestAuditReportHandler(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	audit := openTestAuditLog(t)
+	files := http.StripPrefix("/docs/", docsFileHandler(repo, audit, nil))
+	for _, name := range []string{"petrov", "ivanov"} {
+		req := httptest.NewRequest(http.MethodGet, "/docs/public.pdf", nil)
+		files.ServeHTTP(httptest.NewRecorder(), req.WithContext(contextWithUser(req.Context(), &User{Name: name})))
+	}
+
+	h := auditReportHandler(audit, &accessRule{Groups: []string{"Security"}})
+	get := func(target string, u *User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if u != nil {
+			req = req.WithContext(contextWithUser(req.Context(), u))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	officer := &User{Name: "officer", Groups: []string{"security"}}
+
+	if rec := get("/reports/downloads", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for anonymous user, got %d", rec.Code)
+	}
+	if rec := get("/reports/downloads", &User{Name: "ivanov"}); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for regular user, got %d", rec.Code)
+	}
+
+	rec := get("/reports/downloads?doc=%2Fpublic.pdf&user=petrov", officer)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp auditReportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Records) != 1 || resp.Records[0].User != "petrov" || resp.Records[0].Path != "public.pdf" {
+		t.Fatalf("unexpected records: %+v", resp.Records)
+	}
+
+	rec = get("/reports/downloads?format=csv", officer)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if !strings.HasPrefix(lines[0], "\ufeffВремя;") || len(lines) != 3 || !strings.Contains(lines[1], ";ivanov;") {
+		t.Errorf("unexpected CSV report:\n%s", rec.Body.String())
+	}
+
+	for _, q := range []string{"from=yesterday", "limit=0", "to=2024-13-01"} {
+		if rec := get("/reports/downloads?"+q, officer); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestLoadConfig_AuditLog(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) Config {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(cfgPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		return cfg
+	}
+
+	cfg := write(`port: "8080"`)
+	if cfg.AuditLog != "" || cfg.AuditViewers != nil {
+		t.Errorf("unexpected defaults: %q %+v", cfg.AuditLog, cfg.AuditViewers)
+	}
+
+	cfg = write("audit_log: \"logs/downloads.log\"\naudit_viewers:\n  groups: [Security]\n  users: [ivanov]\n")
+	if cfg.AuditLog != "logs/downloads.log" || cfg.AuditViewers == nil || !cfg.AuditViewers.allows(&User{Name: "ivanov"}) {
+		t.Errorf("unexpected audit config: %q %+v", cfg.AuditLog, cfg.AuditViewers)
+	}
+
+	if cfg = write(`audit_log: ""`); cfg.AuditLog != "" {
+		t.Errorf("expected empty audit_log to disable the log, got %q", cfg.AuditLog)
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Режимы аутентификации (поле auth.mode в config.yaml).
+const (
+	// authModeOff - аутентификации нет, всё доступно анонимно.
+	authModeOff = "off"
+	// authModeOptional - вход по желанию: анонимам доступно всё, кроме закрытых разделов.
+	authModeOptional = "optional"
+	// authModeRequired - без входа доступна только страница входа.
+	authModeRequired = "required"
+)
+
+const sessionCookieName = "docsrv_session"
+
+// errInvalidCredentials - неверный логин или пароль (в отличие от недоступности каталога).
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// User - аутентифицированный пользователь.
+type User struct {
+	// Name - логин, по нему пользователь учитывается в отметках об ознакомлении и логах.
+	Name        string
+	DisplayName string
+	Groups      []string
+}
+
+// InGroup проверяет членство в группе без учёта регистра.
+func (u *User) InGroup(group string) bool {
+	for _, g := range u.Groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Title возвращает имя для показа пользователю.
+func (u *User) Title() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Name
+}
+
+type userContextKey struct{}
+
+func contextWithUser(ctx context.Context, u *User) context.Context {
+	if info := requestInfoFrom(ctx); info != nil && u != nil {
+		info.User = u.Name
+	}
+	return context.WithValue(ctx, userContextKey{}, u)
+}
+
+// userFromRequest возвращает пользователя, вошедшего в систему, или nil для анонимного запроса.
+func userFromRequest(r *http.Request) *User {
+	u, _ := r.Context().Value(userContextKey{}).(*User)
+	return u
+}
+
+// passwordAuthenticator проверяет логин и пароль со страницы входа (LDAP).
+type passwordAuthenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+}
+
+// userDirectory находит ФИО и группы пользователя, вошедшего без пароля (Kerberos).
+type userDirectory interface {
+	Lookup(ctx context.Context, username string) (*User, error)
+}
+
+// AuthConfig - настройки аутентификации.
+type AuthConfig struct {
+	Mode       string
+	SessionTTL time.Duration
+	LDAP       *LDAPConfig
+	Kerberos   *KerberosConfig
+	OIDC       *OIDCConfig
+	ClientCert *ClientCertConfig
+}
+
+// yamlAuthConfig mirrors the auth section of config.yaml.
+type yamlAuthConfig struct {
+	Mode       string                `yaml:"mode"`
+	SessionTTL string                `yaml:"session_ttl"`
+	LDAP       *yamlLDAPConfig       `yaml:"ldap"`
+	Kerberos   *yamlKerberosConfig   `yaml:"kerberos"`
+	OIDC       *yamlOIDCConfig       `yaml:"oidc"`
+	ClientCert *yamlClientCertConfig `yaml:"client_cert"`
+}
+
+// DefaultAuthConfig returns auth settings used when config.yaml has no auth section.
+func DefaultAuthConfig() AuthConfig {
+	return AuthConfig{Mode: authModeOff, SessionTTL: 8 * time.Hour}
+}
+
+// parseAuthConfig применяет секцию auth из config.yaml поверх значений по умолчанию.
+func parseAuthConfig(y yamlAuthConfig) (AuthConfig, error) {
+	cfg := DefaultAuthConfig()
+
+	if y.Mode != "" {
+		switch y.Mode {
+		case authModeOff, authModeOptional, authModeRequired:
+			cfg.Mode = y.Mode
+		default:
+			return cfg, fmt.Errorf("invalid value for auth.mode: %q (expected off, optional or required)", y.Mode)
+		}
+	}
+	if y.SessionTTL != "" {
+		ttl, err := parseDurationField("auth.session_ttl", y.SessionTTL)
+		if err != nil {
+			return cfg, err
+		}
+		if ttl <= 0 {
+			return cfg, fmt.Errorf("invalid duration for auth.session_ttl: %q: must be positive", y.SessionTTL)
+		}
+		cfg.SessionTTL = ttl
+	}
+	if y.LDAP != nil {
+		ldapCfg, err := parseLDAPConfig(*y.LDAP)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.LDAP = &ldapCfg
+	}
+	if y.Kerberos != nil {
+		krbCfg, err := parseKerberosConfig(*y.Kerberos)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Kerberos = &krbCfg
+	}
+	if y.OIDC != nil {
+		oidcCfg, err := parseOIDCConfig(*y.OIDC)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.OIDC = &oidcCfg
+	}
+	if y.ClientCert != nil {
+		certCfg, err := parseClientCertConfig(*y.ClientCert)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ClientCert = &certCfg
+	}
+
+	if cfg.Mode != authModeOff && cfg.LDAP == nil && cfg.Kerberos == nil && cfg.OIDC == nil && cfg.ClientCert == nil {
+		return cfg, fmt.Errorf("auth.mode is %q, but no auth provider (auth.ldap, auth.kerberos, auth.oidc or auth.client_cert) is configured", cfg.Mode)
+	}
+	return cfg, nil
+}
+
+type session struct {
+	user    *User
+	expires time.Time
+}
+
+// sessionStore - сессии в памяти процесса; после перезапуска сервера нужно войти заново.
+type sessionStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]session)}
+}
+
+// randomToken возвращает случайную строку для токенов сессий и параметров входа.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Create создаёт сессию и возвращает её токен для cookie.
+func (s *sessionStore) Create(u *User) (string, time.Time, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Заодно выбрасываем истёкшие сессии, чтобы карта не росла бесконечно.
+	now := time.Now()
+	for t, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, t)
+		}
+	}
+	s.sessions[token] = session{user: u, expires: expires}
+	return token, expires, nil
+}
+
+func (s *sessionStore) Get(token string) (*User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return nil, false
+	}
+	return sess.user, true
+}
+
+func (s *sessionStore) Delete(token string) {
+	s.mu.Lock()
+	delete(s.sessions, token)
+	s.mu.Unlock()
+}
+
+// authenticator - аутентификация запросов: сессии, страница входа и выход.
+type authenticator struct {
+	mode     string
+	sessions *sessionStore
+	password passwordAuthenticator
+	// kerberos - вход без пароля по билету Kerberos (nil - выключен).
+	kerberos *kerberosAuthenticator
+	// directory - откуда брать группы пользователей, вошедших через Kerberos (nil - без групп).
+	directory userDirectory
+	// oidc - вход через провайдера OpenID Connect (nil - выключен).
+	oidc *oidcAuthenticator
+	// clientCert - вход по клиентскому сертификату (nil - выключен).
+	clientCert *ClientCertConfig
+	// publicMetrics - отдавать /metrics без входа (metrics.public).
+	publicMetrics bool
+}
+
+// newAuthenticator возвращает nil, если аутентификация выключена.
+func newAuthenticator(cfg AuthConfig) (*authenticator, error) {
+	if cfg.Mode == authModeOff {
+		return nil, nil
+	}
+	a := &authenticator{mode: cfg.Mode, sessions: newSessionStore(cfg.SessionTTL)}
+	if cfg.LDAP != nil {
+		ldapAuth := newLDAPAuthenticator(*cfg.LDAP)
+		a.password = ldapAuth
+		if cfg.LDAP.BindDN != "" {
+			a.directory = ldapAuth
+		}
+	}
+	if cfg.Kerberos != nil {
+		k, err := newKerberosAuthenticator(*cfg.Kerberos)
+		if err != nil {
+			return nil, err
+		}
+		a.kerberos = k
+	}
+	if cfg.OIDC != nil {
+		a.oidc = newOIDCAuthenticator(*cfg.OIDC)
+	}
+	a.clientCert = cfg.ClientCert
+	return a, nil
+}
+
+// isPublicPath - адреса, доступные без входа в режиме required.
+func isPublicPath(p string) bool {
+	return p == "/login" || p == "/healthz" || p == "/readyz" || strings.HasPrefix(p, "/static/") ||
+		p == oidcLoginPath || p == oidcCallbackPath
+}
+
+// loginRequired сообщает, что анонимный запрос к адресу p нужно отклонить.
+// Метрики раскрывают маршруты и разделы, поэтому без metrics.public: true
+// требуют входа и в режиме optional.
+func (a *authenticator) loginRequired(p string) bool {
+	if p == "/metrics" {
+		return !a.publicMetrics
+	}
+	return a.mode == authModeRequired && !isPublicPath(p)
+}
+
+// Middleware определяет пользователя по cookie сессии, билету Kerberos или
+// клиентскому сертификату и кладёт его в контекст запроса.
+// В режиме required анонимные запросы перенаправляются на страницу входа
+// (запросы к API и /metrics получают 401).
+func (a *authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookieName); err == nil {
+			if u, ok := a.sessions.Get(c.Value); ok {
+				r = r.WithContext(contextWithUser(r.Context(), u))
+			}
+		}
+		if userFromRequest(r) == nil && a.kerberos != nil {
+			if token, ok := negotiateToken(r); ok {
+				if u := a.negotiate(w, r, token); u != nil {
+					r = r.WithContext(contextWithUser(r.Context(), u))
+				}
+			}
+		}
+		if userFromRequest(r) == nil && a.clientCert != nil {
+			if u := clientCertUser(r, *a.clientCert); u != nil {
+				a.signIn(w, r, u)
+				r = r.WithContext(contextWithUser(r.Context(), u))
+			}
+		}
+
+		if userFromRequest(r) == nil && a.loginRequired(r.URL.Path) {
+			a.challenge(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiate проверяет билет Kerberos и при успехе открывает сессию, чтобы
+// следующие запросы не проверяли билет заново. При ошибке возвращает nil:
+// запрос продолжается как анонимный, а браузер вне домена увидит форму входа.
+func (a *authenticator) negotiate(w http.ResponseWriter, r *http.Request, token string) *User {
+	u, err := a.kerberos.Authenticate(token)
+	if err != nil {
+		log.Printf("Kerberos authentication failed from %s: %v", r.RemoteAddr, err)
+		return nil
+	}
+	a.signIn(w, r, u)
+	return u
+}
+
+// signIn дополняет пользователя, вошедшего без пароля (Kerberos, сертификат),
+// ФИО и группами из каталога и открывает сессию.
+func (a *authenticator) signIn(w http.ResponseWriter, r *http.Request, u *User) {
+	if a.directory != nil {
+		du, err := a.directory.Lookup(r.Context(), u.Name)
+		if err != nil {
+			log.Printf("Could not look up groups of %s: %v", u.Name, err)
+		} else {
+			u.Groups = du.Groups
+			if du.DisplayName != "" {
+				u.DisplayName = du.DisplayName
+			}
+		}
+	}
+
+	if err := a.startSession(w, r, u); err != nil {
+		log.Printf("Error creating session: %v", err)
+	}
+}
+
+// challenge отвечает на запрос, для которого нужен вход.
+func (a *authenticator) challenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/search" || r.URL.Path == "/ack" ||
+		r.URL.Path == "/feed.atom" || r.URL.Path == "/metrics" {
+		// Скрипты (curl --negotiate), Prometheus и читатели лент могут войти по билету Kerberos сразу.
+		if a.kerberos != nil {
+			w.Header().Set(authenticateHeader, negotiateScheme)
+		}
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "authentication required"})
+		return
+	}
+	http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+}
+
+// loginPage - данные шаблона login.html.
+type loginPage struct {
+	Next     string
+	Username string
+	Error    string
+	// PasswordEnabled - показывать форму для входа по паролю.
+	PasswordEnabled bool
+	// OIDCName - название провайдера OpenID Connect для кнопки входа ("" - кнопки нет).
+	OIDCName string
+}
+
+// safeNext оставляет только локальные адреса, чтобы страницу входа нельзя было
+// использовать для перенаправления на чужой сайт.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// loginHandler - страница входа: GET показывает форму, POST проверяет логин и пароль.
+func (a *authenticator) loginHandler(tmpl *pageTemplate) http.Handler {
+	render := func(w http.ResponseWriter, status int, page loginPage) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if err := tmpl.Execute(w, page); err != nil {
+			log.Printf("Error executing template: %v", err)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := loginPage{Next: safeNext(r.FormValue("next")), PasswordEnabled: a.password != nil}
+		if a.oidc != nil {
+			page.OIDCName = a.oidc.cfg.Name
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Вошёл по билету Kerberos (см. Middleware) или уже был в сессии.
+			if userFromRequest(r) != nil {
+				http.Redirect(w, r, page.Next, http.StatusSeeOther)
+				return
+			}
+			// Предлагаем браузеру войти по билету Kerberos. Браузер в домене повторит
+			// запрос с билетом, остальные покажут форму из тела ответа.
+			// Если билет уже был и не подошёл, повторно не просим.
+			if _, sent := negotiateToken(r); a.kerberos != nil && !sent {
+				w.Header().Set(authenticateHeader, negotiateScheme)
+				render(w, http.StatusUnauthorized, page)
+				return
+			}
+			// Других способов входа нет - сразу к провайдеру.
+			if !page.PasswordEnabled && a.kerberos == nil && a.oidc != nil {
+				http.Redirect(w, r, oidcLoginPath+"?next="+url.QueryEscape(page.Next), http.StatusSeeOther)
+				return
+			}
+			if !page.PasswordEnabled && page.OIDCName == "" {
+				page.Error = "Не удалось выполнить вход через учётную запись Windows."
+			}
+			render(w, http.StatusOK, page)
+		case http.MethodPost:
+			page.Username = strings.TrimSpace(r.PostFormValue("username"))
+			password := r.PostFormValue("password")
+
+			if a.password == nil {
+				page.Error = "Вход по паролю не настроен."
+				render(w, http.StatusBadRequest, page)
+				return
+			}
+
+			u, err := a.password.Authenticate(r.Context(), page.Username, password)
+			if err != nil {
+				if errors.Is(err, errInvalidCredentials) {
+					log.Printf("Failed login for %q from %s", page.Username, r.RemoteAddr)
+					page.Error = "Неверное имя пользователя или пароль."
+					render(w, http.StatusUnauthorized, page)
+					return
+				}
+				log.Printf("Login error for %q: %v", page.Username, err)
+				page.Error = "Сервис проверки паролей недоступен, попробуйте позже."
+				render(w, http.StatusServiceUnavailable, page)
+				return
+			}
+
+			if err := a.startSession(w, r, u); err != nil {
+				log.Printf("Error creating session: %v", err)
+				page.Error = "Не удалось выполнить вход."
+				render(w, http.StatusInternalServerError, page)
+				return
+			}
+			http.Redirect(w, r, page.Next, http.StatusSeeOther)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// startSession создаёт сессию пользователя и выставляет её cookie.
+func (a *authenticator) startSession(w http.ResponseWriter, r *http.Request, u *User) error {
+	token, expires, err := a.sessions.Create(u)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("User %s logged in", u.Name)
+	return nil
+}
+
+// logoutHandler завершает сессию (POST /logout) и возвращает на главную.
+func (a *authenticator) logoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookieName); err == nil {
+			a.sessions.Delete(c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePasswordAuth accepts a single login/password pair.
+type fakePasswordAuth struct {
+	user     User
+	password string
+}
+
+func (f *fakePasswordAuth) Authenticate(_ context.Context, username, password string) (*User, error) {
+	if username != f.user.Name || password != f.password {
+		return nil, errInvalidCredentials
+	}
+	u := f.user
+	return &u, nil
+}
+
+func newTestAuthServer(t *testing.T, mode string) http.Handler {
+	t.Helper()
+	a := &authenticator{
+		mode:     mode,
+		sessions: newSessionStore(time.Hour),
+		password: &fakePasswordAuth{user: User{Name: "ivanov", DisplayName: "Иванов И.И.", Groups: []string{"HR"}}, password: "secret"},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", a.loginHandler(testPageTemplate(t, "login.html")))
+	mux.Handle("POST /logout", a.logoutHandler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if u := userFromRequest(r); u != nil {
+			w.Write([]byte("hello " + u.Name))
+			return
+		}
+		w.Write([]byte("hello anonymous"))
+	})
+	mux.HandleFunc("/api/v1/sections", func(w http.ResponseWriter, r *http.Request) {})
+	return a.Middleware(mux)
+}
+
+func doRequest(h http.Handler, method, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticator_RequiredModeLoginFlow(t *testing.T) {
+	h := newTestAuthServer(t, authModeRequired)
+
+	// Anonymous page requests are redirected to the login page, API requests get 401.
+	rec := doRequest(h, http.MethodGet, "/HR?q=1", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?next=%2FHR%3Fq%3D1" {
+		t.Fatalf("expected redirect to login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := doRequest(h, http.MethodGet, "/api/v1/sections", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for API, got %d", rec.Code)
+	}
+	// Feed readers cannot follow the login form either.
+	if rec := doRequest(h, http.MethodGet, "/feed.atom", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for the feed, got %d", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodGet, "/login?next=%2FHR", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `name="next" value="/HR"`) {
+		t.Fatalf("expected login page, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(h, http.MethodPost, "/login", url.Values{"username": {"ivanov"}, "password": {"wrong"}, "next": {"/HR"}})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Неверное имя пользователя или пароль") {
+		t.Fatalf("expected login error, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(h, http.MethodPost, "/login", url.Values{"username": {"ivanov"}, "password": {"secret"}, "next": {"/HR"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/HR" {
+		t.Fatalf("expected redirect after login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("expected session cookie, got %+v", cookies)
+	}
+
+	if rec := doRequest(h, http.MethodGet, "/", nil, cookies[0]); rec.Body.String() != "hello ivanov" {
+		t.Fatalf("expected authenticated request, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// After logout the session cookie no longer works.
+	if rec := doRequest(h, http.MethodPost, "/logout", nil, cookies[0]); rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect after logout, got %d", rec.Code)
+	}
+	if rec := doRequest(h, http.MethodGet, "/", nil, cookies[0]); rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect to login after logout, got %d", rec.Code)
+	}
+}
+
+func TestAuthenticator_OptionalModeAllowsAnonymous(t *testing.T) {
+	h := newTestAuthServer(t, authModeOptional)
+	if rec := doRequest(h, http.MethodGet, "/", nil); rec.Body.String() != "hello anonymous" {
+		t.Fatalf("expected anonymous access, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	cases := map[string]string{
+		"/HR/2025":             "/HR/2025",
+		"":                     "/",
+		"//evil.example/":      "/",
+		"/\\evil.example":      "/",
+		"https://evil.example": "/",
+	}
+	for in, want := range cases {
+		if got := safeNext(in); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSessionStore_Expiry(t *testing.T) {
+	s := newSessionStore(time.Millisecond)
+	token, _, err := s.Create(&User{Name: "ivanov"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := s.Get(token); ok {
+		t.Fatalf("expected session to expire")
+	}
+}
+
+func TestLoadConfig_Auth(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+auth:
+  mode: required
+  session_ttl: "1h"
+  ldap:
+    url: "ldaps://dc.example.local"
+    bind_dn: "CN=svc,DC=example,DC=local"
+    bind_password: "x"
+    base_dn: "DC=example,DC=local"
+`)
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Auth.Mode != authModeRequired || cfg.Auth.SessionTTL != time.Hour || cfg.Auth.LDAP == nil {
+		t.Fatalf("unexpected auth config: %+v", cfg.Auth)
+	}
+	if cfg.Auth.LDAP.UserFilter != "(sAMAccountName=%s)" || cfg.Auth.LDAP.Timeout != 10*time.Second {
+		t.Errorf("expected LDAP defaults, got %+v", cfg.Auth.LDAP)
+	}
+
+	for _, bad := range []string{
+		"auth: { mode: sometimes }",
+		"auth: { mode: required }",
+		"auth: { mode: optional, ldap: { url: 'ldap://dc', base_dn: 'dc=x' } }",
+	} {
+		write(bad)
+		if _, err := LoadConfig(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"time"
+)
+
+// Виды изменений документов между сканированиями.
+const (
+	changeAdded    = "added"
+	changeModified = "modified"
+	changeRemoved  = "removed"
+	// changeUpdated - документ добавлен или изменён, но когда именно, неизвестно:
+	// так история заполняется при первом сканировании после запуска.
+	changeUpdated = "updated"
+)
+
+// maxChanges - сколько последних изменений помнит DocRepository.
+const maxChanges = 200
+
+// DocChange - изменение документа, замеченное при пересканировании каталога.
+type DocChange struct {
+	Kind string
+	// Time - когда изменение замечено; для changeUpdated - время изменения файла.
+	Time time.Time
+	// Document - документ после изменения, а для удалённого - каким он был.
+	Document Document
+}
+
+// SectionPath возвращает путь раздела документа ("" - раздел "Общее").
+func (c DocChange) SectionPath() string {
+	if dir := path.Dir(c.Document.Path); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// SectionName возвращает название раздела документа.
+func (c DocChange) SectionName() string {
+	if p := c.SectionPath(); p != "" {
+		return p
+	}
+	return generalSectionName
+}
+
+// ChangesFor возвращает изменения документов (от новых к старым) в разделах,
+// доступных пользователю u.
+func (r *DocRepository) ChangesFor(u *User) ([]DocChange, error) {
+	res, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	all := r.changes
+	r.mu.RUnlock()
+
+	var changes []DocChange
+	for _, c := range all {
+		if r.ruleFor(res, c.SectionPath()).allows(u) {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// continueChanges продолжает историю изменений prev - репозитория того же
+// каталога из прежней конфигурации: первое сканирование сравнивается с
+// последним сканированием prev, а не заполняет историю заново.
+// Вызывается до первого сканирования; саму историю prev забирает inheritChanges.
+func (r *DocRepository) continueChanges(prev *DocRepository) {
+	prev.mu.RLock()
+	base, recorded := prev.cache, prev.changesRecorded
+	prev.mu.RUnlock()
+
+	r.mu.Lock()
+	r.changesBase, r.changesPrev, r.changesPrevRecorded = base, prev, recorded
+	r.mu.Unlock()
+}
+
+// inheritChanges дописывает к истории историю репозитория, переданного в
+// continueChanges. Вызывается при подмене сайта: до неё prev продолжает
+// обслуживать запросы и записывать изменения. Записанное prev после того, как
+// было взято changesBase, уже покрыто первым сканированием r, поэтому
+// отбрасывается - иначе изменение попало бы в ленту дважды.
+func (r *DocRepository) inheritChanges() {
+	r.mu.Lock()
+	prev, seen := r.changesPrev, r.changesPrevRecorded
+	r.changesPrev = nil
+	r.mu.Unlock()
+	if prev == nil {
+		return
+	}
+
+	prev.mu.RLock()
+	inherited, covered := prev.changes, prev.changesRecorded-seen
+	prev.mu.RUnlock()
+	if covered >= len(inherited) {
+		return
+	}
+	inherited = inherited[covered:]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Новый срез, а не дописывание: ChangesFor читает прежний без блокировки.
+	merged := append(append([]DocChange(nil), r.changes...), inherited...)
+	if len(merged) > maxChanges {
+		merged = merged[:maxChanges]
+	}
+	r.changes = merged
+}
+
+// recordChangesLocked дополняет историю изменениями, которые дало
+// сканирование res. Должна вызываться под r.mu.Lock() до замены r.cache.
+func (r *DocRepository) recordChangesLocked(res *scanResult, now time.Time) {
+	prev := r.cache
+	if prev == nil {
+		prev = r.changesBase
+	}
+	r.changesBase = nil
+
+	var changes []DocChange
+	if prev == nil {
+		changes = recentDocuments(res)
+	} else {
+		changes = diffScans(prev, res, now)
+	}
+	if len(changes) == 0 {
+		return
+	}
+	r.changesRecorded += len(changes)
+	// Новый срез, а не дописывание: ChangesFor читает прежний без блокировки.
+	merged := append(changes, r.changes...)
+	if len(merged) > maxChanges {
+		merged = merged[:maxChanges]
+	}
+	r.changes = merged
+}
+
+// diffScans сравнивает документы двух сканирований: новые, изменившиеся
+// (размер или время изменения файла) и пропавшие.
+func diffScans(prev, next *scanResult, now time.Time) []DocChange {
+	before := make(map[string]Document)
+	for _, s := range prev.sections {
+		for _, d := range s.Documents {
+			before[d.Path] = d
+		}
+	}
+
+	var changes []DocChange
+	for _, s := range next.sections {
+		for _, d := range s.Documents {
+			old, ok := before[d.Path]
+			delete(before, d.Path)
+			switch {
+			case !ok:
+				changes = append(changes, DocChange{Kind: changeAdded, Time: now, Document: d})
+			case old.Size != d.Size || !old.ModTime.Equal(d.ModTime):
+				changes = append(changes, DocChange{Kind: changeModified, Time: now, Document: d})
+			}
+		}
+	}
+	for _, d := range before {
+		changes = append(changes, DocChange{Kind: changeRemoved, Time: now, Document: d})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Document.Path < changes[j].Document.Path
+	})
+	return changes
+}
+
+// recentDocuments - начальная история: последние изменённые документы
+// по времени изменения файлов.
+func recentDocuments(res *scanResult) []DocChange {
+	var changes []DocChange
+	for _, s := range res.sections {
+		for _, d := range s.Documents {
+			changes = append(changes, DocChange{Kind: changeUpdated, Time: d.ModTime, Document: d})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.After(changes[j].Time)
+	})
+	if len(changes) > maxChanges {
+		changes = changes[:maxChanges]
+	}
+	return changes
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func changeKinds(changes []DocChange) map[string]string {
+	kinds := map[string]string{}
+	for _, c := range changes {
+		kinds[c.Document.Path] = c.Kind
+	}
+	return kinds
+}
+
+func TestDocRepository_TracksChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "plan.pdf", "HR/old.pdf", "HR/same.pdf")
+
+	repo := NewDocRepository(dir, time.Minute)
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first scan fills the history with the documents themselves.
+	changes, err := repo.ChangesFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 || changes[0].Kind != changeUpdated {
+		t.Fatalf("unexpected initial history: %+v", changes)
+	}
+
+	writeReloadTestDocs(t, dir, "HR/new.pdf")
+	writeTestFile(t, filepath.Join(dir, "plan.pdf"), []byte("second edition"))
+	if err := os.Remove(filepath.Join(dir, "HR", "old.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = repo.ChangesFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 6 {
+		t.Fatalf("expected 3 new changes on top of the history, got %+v", changes)
+	}
+	got := changeKinds(changes[:3])
+	want := map[string]string{"HR/new.pdf": changeAdded, "HR/old.pdf": changeRemoved, "plan.pdf": changeModified}
+	for p, kind := range want {
+		if got[p] != kind {
+			t.Errorf("%s: kind = %q, want %q", p, got[p], kind)
+		}
+	}
+
+	// A rescan without changes adds nothing.
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _ := repo.ChangesFor(nil); len(changes) != 6 {
+		t.Errorf("expected no new changes, got %d in total", len(changes))
+	}
+}
+
+func TestDocRepository_ContinueChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "plan.pdf")
+
+	prev := NewDocRepository(dir, time.Minute)
+	if err := prev.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeReloadTestDocs(t, dir, "HR/new.pdf")
+	repo := NewDocRepository(dir, time.Minute)
+	repo.continueChanges(prev)
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	// Until the swap the previous site keeps serving and sees the same change.
+	if err := prev.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	repo.inheritChanges()
+
+	changes, err := repo.ChangesFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Kind != changeAdded || changes[0].Document.Path != "HR/new.pdf" ||
+		changes[1].Document.Path != "plan.pdf" {
+		t.Errorf("expected the new document once on top of the previous history, got %+v", changes)
+	}
+}
+
+func TestDocRepository_ChangesForRespectsAccess(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous, err := repo.ChangesFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr, err := repo.ChangesFor(&User{Name: "ivanov", Groups: []string{"HR"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kinds := changeKinds(anonymous); kinds["HR/salary.pdf"] != "" || kinds["public.pdf"] == "" {
+		t.Errorf("unexpected changes for anonymous user: %v", kinds)
+	}
+	if kinds := changeKinds(hr); kinds["HR/salary.pdf"] == "" || kinds["Board/minutes.pdf"] != "" {
+		t.Errorf("unexpected changes for HR user: %v", kinds)
+	}
+}
+
+func TestDocRepository_ChangesAreLimited(t *testing.T) {
+	prev := &scanResult{}
+	next := &scanResult{sections: []Section{{}}}
+	for i := 0; i < maxChanges+10; i++ {
+		next.sections[0].Documents = append(next.sections[0].Documents, Document{Path: fmt.Sprintf("HR/%03d.pdf", i)})
+	}
+
+	repo := NewDocRepository(t.TempDir(), time.Minute)
+	repo.cache = prev
+	repo.recordChangesLocked(next, time.Now())
+	if len(repo.changes) != maxChanges {
+		t.Errorf("expected %d changes, got %d", maxChanges, len(repo.changes))
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Результаты проверок -check-config.
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// configCheck - результат одной проверки конфигурации.
+type configCheck struct {
+	Status string
+	Name   string
+	Detail string
+}
+
+// configDefaults - значения по умолчанию в записи config.yaml, для вывода
+// действующей конфигурации. Берутся из DefaultConfig, чтобы не расходиться с ним.
+func configDefaults() map[string]string {
+	d := DefaultConfig()
+	types := make([]string, 0, len(d.DocumentTypes))
+	for ext := range d.DocumentTypes {
+		types = append(types, ext)
+	}
+	slices.Sort(types)
+	return map[string]string{
+		"docs_dir":            d.DocsDir,
+		"port":                d.Port,
+		"cache_ttl":           d.CacheTTL.String(),
+		"read_timeout":        d.ReadTimeout.String(),
+		"write_timeout":       d.WriteTimeout.String(),
+		"idle_timeout":        d.IdleTimeout.String(),
+		"read_header_timeout": d.ReadHeaderTimeout.String(),
+		"log_file":            d.LogFile,
+		"log_format":          d.LogFormat.name,
+		"watch":               d.Watch,
+		"watch_poll_interval": d.WatchPollInterval.String(),
+		"scan_timeout":        d.ScanTimeout.String(),
+		"ack_db":              d.AckDB,
+		"audit_log":           d.AuditLog,
+		"stats_db":            d.StatsDB,
+		"document_types":      strings.Join(types, ", "),
+		"branding.org_name":   d.Branding.OrgName,
+		"branding.site_name":  d.Branding.SiteName,
+		"branding.title":      d.Branding.Title,
+		"branding.subtitle":   d.Branding.Subtitle,
+		"branding.footer":     d.Branding.Footer,
+		"auth.mode":           d.Auth.Mode,
+		"auth.session_ttl":    d.Auth.SessionTTL.String(),
+	}
+}
+
+// printEffectiveConfig выводит действующие значения всех настроек с их источником:
+// default, file, env DOCSRV_... или flag.
+func printEffectiveConfig(w io.Writer, sources configSources) {
+	defaults := configDefaults()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, k := range configKeys {
+		s, ok := sources[k.path]
+		if !ok {
+			v, ok := defaults[k.path]
+			if !ok {
+				continue
+			}
+			s = configSetting{Value: v, Source: sourceDefault}
+		}
+		fmt.Fprintf(tw, "%s\t(%s)\t%s\n", k.path, s.Source, s.Value)
+	}
+	tw.Flush()
+}
+
+// checkConfig проверяет, что с конфигурацией cfg сервер запустится и будет
+// работать: каталоги доступны, порты свободны, тайм-ауты разумны.
+func checkConfig(cfg Config) []configCheck {
+	var checks []configCheck
+	add := func(name string, err error) {
+		c := configCheck{Status: checkOK, Name: name}
+		if err != nil {
+			c.Status, c.Detail = checkFail, err.Error()
+		}
+		checks = append(checks, c)
+	}
+	warn := func(name, detail string) {
+		checks = append(checks, configCheck{Status: checkWarn, Name: name, Detail: detail})
+	}
+
+	add("docs_dir "+cfg.DocsDir+" is readable", readableDir(cfg.DocsDir))
+	add("port "+cfg.Port+" is free", portFree(cfg.Port))
+	if cfg.TLS != nil && cfg.TLS.RedirectHTTPPort != "" {
+		add("tls.redirect_http_port "+cfg.TLS.RedirectHTTPPort+" is free", portFree(cfg.TLS.RedirectHTTPPort))
+	}
+	add("log_file directory "+filepath.Dir(cfg.LogFile)+" is writable", writableDir(filepath.Dir(cfg.LogFile)))
+	if cfg.AuditLog != "" {
+		add("audit_log directory "+filepath.Dir(cfg.AuditLog)+" is writable", writableDir(filepath.Dir(cfg.AuditLog)))
+	}
+	if cfg.AckDB != "" {
+		add("ack_db directory "+filepath.Dir(cfg.AckDB)+" is writable", writableDir(filepath.Dir(cfg.AckDB)))
+	}
+	if cfg.StatsDB != "" {
+		add("stats_db directory "+filepath.Dir(cfg.StatsDB)+" is writable", writableDir(filepath.Dir(cfg.StatsDB)))
+	}
+	if cfg.TemplatesDir != "" {
+		add("templates_dir "+cfg.TemplatesDir+" is readable", readableDir(cfg.TemplatesDir))
+	}
+	if cfg.StaticDir != "" {
+		add("static_dir "+cfg.StaticDir+" is readable", readableDir(cfg.StaticDir))
+	}
+	if cfg.TLS != nil {
+		_, err := newServerTLSConfig(*cfg.TLS)
+		add("tls certificate "+cfg.TLS.CertFile+" loads", err)
+	}
+
+	// Тайм-ауты: отрицательные значения - ошибка, остальное - предупреждения.
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"cache_ttl", cfg.CacheTTL},
+		{"read_timeout", cfg.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout},
+		{"idle_timeout", cfg.IdleTimeout},
+		{"read_header_timeout", cfg.ReadHeaderTimeout},
+	} {
+		if d.value < 0 {
+			checks = append(checks, configCheck{Status: checkFail, Name: d.name, Detail: d.value.String() + " must not be negative"})
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", cfg.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout},
+		{"read_header_timeout", cfg.ReadHeaderTimeout},
+	} {
+		if d.value == 0 {
+			warn(d.name, "0 disables the timeout; slow clients can hold connections open")
+		}
+	}
+	if cfg.ReadTimeout > 0 && cfg.ReadHeaderTimeout > cfg.ReadTimeout {
+		warn("read_header_timeout", fmt.Sprintf("%s is longer than read_timeout %s", cfg.ReadHeaderTimeout, cfg.ReadTimeout))
+	}
+	if cfg.CacheTTL == 0 && cfg.Watch == watchModeOff {
+		warn("cache_ttl", "0 with watch: off rescans docs_dir on every request")
+	}
+	return checks
+}
+
+// runCheckConfig выводит действующую конфигурацию и результаты проверок
+// (-check-config) и сообщает, пройдены ли все проверки.
+func runCheckConfig(w io.Writer, cfg Config, sources configSources) bool {
+	fmt.Fprintln(w, "Effective configuration:")
+	printEffectiveConfig(w, sources)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Checks:")
+
+	ok := true
+	for _, c := range checkConfig(cfg) {
+		if c.Detail != "" {
+			fmt.Fprintf(w, "%-4s  %s: %s\n", c.Status, c.Name, c.Detail)
+		} else {
+			fmt.Fprintf(w, "%-4s  %s\n", c.Status, c.Name)
+		}
+		if c.Status == checkFail {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func readableDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.ReadDir(1)
+	if err == io.EOF {
+		// Пустой каталог.
+		return nil
+	}
+	return err
+}
+
+// portFree проверяет, что порт можно занять (служба ещё не запущена и порт
+// не занят другой программой).
+func portFree(port string) error {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+// writableDir проверяет, что в dir можно создать файл. Несуществующий каталог
+// сервер создаст сам, поэтому проверяется ближайший существующий родитель.
+func writableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".docsrv-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func findCheck(checks []configCheck, prefix string) (configCheck, bool) {
+	for _, c := range checks {
+		if strings.HasPrefix(c.Name, prefix) {
+			return c, true
+		}
+	}
+	return configCheck{}, false
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.DocsDir = dir
+	cfg.Port = "0"
+	cfg.LogFile = filepath.Join(dir, "log", "new", "access.log")
+	cfg.AuditLog = ""
+	cfg.AckDB = filepath.Join(dir, "data", "acks.db")
+	cfg.StatsDB = filepath.Join(dir, "stats.db")
+
+	for _, c := range checkConfig(cfg) {
+		if c.Status != checkOK {
+			t.Errorf("unexpected %s for the default config: %s: %s", c.Status, c.Name, c.Detail)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "log")); !os.IsNotExist(err) {
+		t.Error("the check must not create the log directory")
+	}
+}
+
+func TestCheckConfig_Failures(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	dir := t.TempDir()
+	notDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notDir, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.DocsDir = filepath.Join(dir, "missing")
+	cfg.Port = port
+	cfg.LogFile = filepath.Join(notDir, "access.log")
+	cfg.AuditLog = ""
+	cfg.AckDB = filepath.Join(notDir, "acks.db")
+	cfg.StatsDB = filepath.Join(notDir, "stats.db")
+	cfg.CacheTTL = -time.Second
+	cfg.WriteTimeout = 0
+	checks := checkConfig(cfg)
+
+	for _, name := range []string{"docs_dir", "port", "log_file", "ack_db", "stats_db", "cache_ttl"} {
+		if c, ok := findCheck(checks, name); !ok || c.Status != checkFail {
+			t.Errorf("expected %s to fail, got %+v", name, c)
+		}
+	}
+	if c, ok := findCheck(checks, "write_timeout"); !ok || c.Status != checkWarn {
+		t.Errorf("expected a warning for write_timeout 0, got %+v", c)
+	}
+}
+
+func TestRunCheckConfig_PrintsSources(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("cache_ttl: 1m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, sources, err := LoadLayeredConfig(cfgPath, []string{"DOCSRV_WATCH=poll"}, map[string]string{"docs_dir": t.TempDir(), "port": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AuditLog = ""
+	cfg.LogFile = filepath.Join(t.TempDir(), "access.log")
+
+	var b strings.Builder
+	if !runCheckConfig(&b, cfg, sources) {
+		t.Errorf("expected all checks to pass:\n%s", b.String())
+	}
+	out := b.String()
+	lines := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, rest, ok := strings.Cut(line, " "); ok {
+			lines[key] = strings.Join(strings.Fields(rest), " ")
+		}
+	}
+	for key, want := range map[string]string{
+		"cache_ttl":    "(file) 1m",
+		"watch":        "(env DOCSRV_WATCH) poll",
+		"port":         "(flag) 0",
+		"read_timeout": "(default) 15s",
+	} {
+		if lines[key] != want {
+			t.Errorf("%s: got %q, want %q", key, lines[key], want)
+		}
+	}
+	if !strings.Contains(out, "OK    docs_dir") {
+		t.Errorf("expected the checks in the output:\n%s", out)
+	}
+}
@@ -18,6 +18,28 @@ type Config struct {
 	IdleTimeout       time.Duration
 	ReadHeaderTimeout time.Duration
 	LogFile           string
+	LogFormat         accessLogFormat
+	Watch             string
+	WatchPollInterval time.Duration
+	ScanTimeout       time.Duration
+	DocumentTypes     DocumentTypes
+	AckDB             string
+	AckEmployeesFile  string
+	AckViewers        *accessRule
+	AuditLog          string
+	AuditViewers      *accessRule
+	StatsDB           string
+	ZipMaxSize        int64
+	TrustedProxies    trustedProxies
+	BasePath          string
+	PublicURL         string
+	MetricsPublic     bool
+	TLS               *TLSConfig
+	Branding          Branding
+	TemplatesDir      string
+	StaticDir         string
+	Auth              AuthConfig
+	Access            accessRules
 }
 
 // yamlConfig mirrors the YAML structure with string durations.
@@ -30,6 +52,35 @@ type yamlConfig struct {
 	IdleTimeout       string `yaml:"idle_timeout"`
 	ReadHeaderTimeout string `yaml:"read_header_timeout"`
 	LogFile           string `yaml:"log_file"`
+	LogFormat         string `yaml:"log_format"`
+	Watch             string `yaml:"watch"`
+	WatchPollInterval string `yaml:"watch_poll_interval"`
+	ScanTimeout       string `yaml:"scan_timeout"`
+	AckDB             string `yaml:"ack_db"`
+	AckEmployeesFile  string `yaml:"ack_employees_file"`
+	AuditLog          string `yaml:"audit_log"`
+	StatsDB           string `yaml:"stats_db"`
+	ZipMaxMB          *int64 `yaml:"zip_max_mb"`
+	BasePath          string `yaml:"base_path"`
+	PublicURL         string `yaml:"public_url"`
+	TemplatesDir      string `yaml:"templates_dir"`
+	StaticDir         string `yaml:"static_dir"`
+
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	TLS *yamlTLSConfig `yaml:"tls"`
+
+	Branding *yamlBranding `yaml:"branding"`
+
+	Metrics *yamlMetricsConfig `yaml:"metrics"`
+
+	AckViewers   *accessRule `yaml:"ack_viewers"`
+	AuditViewers *accessRule `yaml:"audit_viewers"`
+
+	Auth   *yamlAuthConfig       `yaml:"auth"`
+	Access map[string]accessRule `yaml:"access"`
+
+	DocumentTypes map[string]yamlDocumentType `yaml:"document_types"`
 }
 
 // DefaultConfig returns configuration with sensible defaults.
@@ -43,26 +94,53 @@ func DefaultConfig() Config {
 		IdleTimeout:       60 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		LogFile:           "access.log",
+		LogFormat:         accessLogFormat{name: logFormatCombined},
+		Watch:             watchModeAuto,
+		WatchPollInterval: 30 * time.Second,
+		ScanTimeout:       defaultScanTimeout,
+		DocumentTypes:     DefaultDocumentTypes(),
+		Branding:          DefaultBranding(),
+		Auth:              DefaultAuthConfig(),
 	}
 }
 
 // LoadConfig reads config from the given path if it exists, applying it on top of defaults.
 // If the file does not exist, defaults are returned without error.
 func LoadConfig(path string) (Config, error) {
-	cfg := DefaultConfig()
+	cfg, _, err := LoadLayeredConfig(path, nil, nil)
+	return cfg, err
+}
 
+// readConfigFile returns the top-level mapping of the config file;
+// an empty mapping if the file does not exist.
+func readConfigFile(path string) (*yaml.Node, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return cfg, nil
+			return &yaml.Node{Kind: yaml.MappingNode}, nil
 		}
-		return cfg, fmt.Errorf("read config file %q: %w", path, err)
+		return nil, fmt.Errorf("read config file %q: %w", path, err)
 	}
 
-	var yc yamlConfig
-	if err := yaml.Unmarshal(data, &yc); err != nil {
-		return cfg, fmt.Errorf("parse config file %q: %w", path, err)
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		// Empty file or comments only.
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
 	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse config file %q: line %d: expected a mapping of settings", path, root.Line)
+	}
+	return root, nil
+}
+
+// configFromYAML applies the merged YAML settings on top of defaults.
+func configFromYAML(yc yamlConfig) (Config, error) {
+	cfg := DefaultConfig()
+	var err error
 
 	// Simple string fields.
 	if yc.DocsDir != "" {
@@ -74,6 +152,100 @@ func LoadConfig(path string) (Config, error) {
 	if yc.LogFile != "" {
 		cfg.LogFile = yc.LogFile
 	}
+	if yc.LogFormat != "" {
+		f, err := parseAccessLogFormat(yc.LogFormat)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.LogFormat = f
+	}
+	// ack_db is opt-in: read acknowledgements are enabled only when it is configured.
+	cfg.AckDB = yc.AckDB
+	if yc.AckEmployeesFile != "" {
+		cfg.AckEmployeesFile = yc.AckEmployeesFile
+	}
+	cfg.AckViewers = yc.AckViewers
+	// audit_log is opt-in: downloads are audited only when it is configured.
+	cfg.AuditLog = yc.AuditLog
+	cfg.AuditViewers = yc.AuditViewers
+	// stats_db is opt-in: downloads are counted only when it is configured.
+	cfg.StatsDB = yc.StatsDB
+	// zip_max_mb: section archives are opt-in; unset or 0 disables them.
+	if yc.ZipMaxMB != nil {
+		if *yc.ZipMaxMB < 0 {
+			return cfg, fmt.Errorf("invalid value for zip_max_mb: %d (expected 0 or more)", *yc.ZipMaxMB)
+		}
+		cfg.ZipMaxSize = *yc.ZipMaxMB << 20
+	}
+	if len(yc.TrustedProxies) > 0 {
+		proxies, err := parseTrustedProxies(yc.TrustedProxies)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.TrustedProxies = proxies
+	}
+	if cfg.BasePath, err = normalizeBasePath(yc.BasePath); err != nil {
+		return cfg, err
+	}
+	if cfg.PublicURL, err = normalizePublicURL(yc.PublicURL); err != nil {
+		return cfg, err
+	}
+	if yc.Watch != "" {
+		if !validWatchMode(yc.Watch) {
+			return cfg, fmt.Errorf("invalid value for watch: %q (expected auto, notify, poll or off)", yc.Watch)
+		}
+		cfg.Watch = yc.Watch
+	}
+
+	// Document types replace the defaults entirely, so that unwanted formats can be dropped.
+	if len(yc.DocumentTypes) > 0 {
+		types, err := parseDocumentTypes(yc.DocumentTypes)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.DocumentTypes = types
+	}
+
+	if yc.Branding != nil {
+		branding, err := parseBranding(*yc.Branding)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Branding = branding
+	}
+	// metrics.public: /metrics is open to anonymous scrapers only when explicitly allowed.
+	if yc.Metrics != nil {
+		cfg.MetricsPublic = yc.Metrics.Public
+	}
+	cfg.TemplatesDir = yc.TemplatesDir
+	cfg.StaticDir = yc.StaticDir
+
+	if yc.TLS != nil {
+		tlsCfg, err := parseTLSConfig(*yc.TLS)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.TLS = &tlsCfg
+	}
+
+	if yc.Auth != nil {
+		auth, err := parseAuthConfig(*yc.Auth)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Auth = auth
+	}
+	if cfg.Auth.ClientCert != nil && (cfg.TLS == nil || cfg.TLS.ClientAuth == clientAuthOff) {
+		return cfg, fmt.Errorf("auth.client_cert requires tls with client_ca_file")
+	}
+
+	if len(yc.Access) > 0 {
+		access, err := parseAccessRules(yc.Access)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Access = access
+	}
 
 	// Durations.
 	var perr error
@@ -107,6 +279,24 @@ func LoadConfig(path string) (Config, error) {
 			return cfg, perr
 		}
 	}
+	if yc.WatchPollInterval != "" {
+		cfg.WatchPollInterval, perr = parseDurationField("watch_poll_interval", yc.WatchPollInterval)
+		if perr != nil {
+			return cfg, perr
+		}
+		if cfg.WatchPollInterval <= 0 {
+			return cfg, fmt.Errorf("invalid duration for watch_poll_interval: %q: must be positive", yc.WatchPollInterval)
+		}
+	}
+	if yc.ScanTimeout != "" {
+		cfg.ScanTimeout, perr = parseDurationField("scan_timeout", yc.ScanTimeout)
+		if perr != nil {
+			return cfg, perr
+		}
+		if cfg.ScanTimeout <= 0 {
+			return cfg, fmt.Errorf("invalid duration for scan_timeout: %q: must be positive", yc.ScanTimeout)
+		}
+	}
 
 	return cfg, nil
 }
@@ -92,3 +92,48 @@ func TestLoadConfig_InvalidDurationReturnsError(t *testing.T) {
 		t.Fatalf("expected error for invalid duration, got nil")
 	}
 }
+
+func TestLoadConfig_InvalidWatchModeReturnsError(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	if err := os.WriteFile(cfgPath, []byte(`watch: "inotify"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(cfgPath); err == nil {
+		t.Fatalf("expected error for invalid watch mode, got nil")
+	}
+}
+
+func TestLoadConfig_ZipMaxMB(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	for _, c := range []struct {
+		yaml string
+		want int64
+	}{
+		{``, 0},
+		{`zip_max_mb: 20`, 20 << 20},
+		{`zip_max_mb: 0`, 0},
+	} {
+		if err := os.WriteFile(cfgPath, []byte(c.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(cfgPath)
+		if err != nil {
+			t.Fatalf("%q: %v", c.yaml, err)
+		}
+		if cfg.ZipMaxSize != c.want {
+			t.Errorf("%q: ZipMaxSize = %d, want %d", c.yaml, cfg.ZipMaxSize, c.want)
+		}
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(`zip_max_mb: -1`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(cfgPath); err == nil {
+		t.Fatalf("expected error for negative zip_max_mb, got nil")
+	}
+}
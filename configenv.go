@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix - префикс переменных окружения с настройками: DOCSRV_DOCS_DIR,
+// DOCSRV_TLS_CERT_FILE, DOCSRV_AUTH_LDAP_URL и т.д.
+const envPrefix = "DOCSRV_"
+
+// Источники значений настроек в порядке старшинства.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// configKey - настройка config.yaml: путь вида "tls.cert_file" и тип поля yamlConfig.
+type configKey struct {
+	path string
+	typ  reflect.Type
+}
+
+// env возвращает имя переменной окружения для настройки.
+func (k configKey) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(k.path, ".", "_"))
+}
+
+// secret сообщает, что значение настройки нельзя выводить (-check-config).
+func (k configKey) secret() bool {
+	name := k.path[strings.LastIndex(k.path, ".")+1:]
+	return strings.Contains(name, "password") || strings.Contains(name, "secret")
+}
+
+// configKeys - все настройки config.yaml в порядке полей yamlConfig.
+// Вложенные секции (tls, auth.ldap, ...) раскрываются до отдельных полей;
+// словари (access, document_types) задаются целиком.
+var configKeys = configKeysOf(reflect.TypeOf(yamlConfig{}), "")
+
+func configKeysOf(t reflect.Type, prefix string) []configKey {
+	var keys []configKey
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		typ := f.Type
+		if typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if typ.Kind() == reflect.Struct {
+			keys = append(keys, configKeysOf(typ, prefix+name+".")...)
+			continue
+		}
+		keys = append(keys, configKey{path: prefix + name, typ: typ})
+	}
+	return keys
+}
+
+// configSetting - заданное значение настройки и его источник.
+type configSetting struct {
+	Value  string
+	Source string
+}
+
+// configSources - откуда взято значение каждой заданной настройки (ключ - путь настройки).
+// Настроек со значением по умолчанию в нём нет.
+type configSources map[string]configSetting
+
+// LoadLayeredConfig собирает конфигурацию из слоёв: значения по умолчанию,
+// файл path, переменные окружения DOCSRV_* из environ и флаги командной строки
+// (ключ - путь настройки, например "docs_dir"). Каждый следующий слой главнее
+// предыдущего. Слои объединяются до разбора, поэтому ошибки в значениях из
+// окружения и флагов сообщаются так же, как ошибки в файле.
+func LoadLayeredConfig(path string, environ []string, flags map[string]string) (Config, configSources, error) {
+	root, err := readConfigFile(path)
+	if err != nil {
+		return DefaultConfig(), nil, err
+	}
+
+	sources := configSources{}
+	for _, k := range configKeys {
+		if n := lookupNode(root, k.path); n != nil {
+			sources[k.path] = configSetting{Value: nodeString(k, n), Source: sourceFile}
+		}
+	}
+
+	env := map[string]string{}
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, envPrefix) {
+			env[name] = value
+		}
+	}
+	for _, k := range configKeys {
+		value, ok := env[k.env()]
+		if !ok {
+			continue
+		}
+		n, err := envNode(k, value)
+		if err != nil {
+			return DefaultConfig(), sources, fmt.Errorf("invalid value for %s: %q: %w", k.env(), value, err)
+		}
+		setNode(root, k.path, n)
+		sources[k.path] = configSetting{Value: nodeString(k, n), Source: sourceEnv + " " + k.env()}
+	}
+
+	for _, k := range configKeys {
+		if value, ok := flags[k.path]; ok {
+			n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+			setNode(root, k.path, n)
+			sources[k.path] = configSetting{Value: value, Source: sourceFlag}
+		}
+	}
+
+	var yc yamlConfig
+	if err := root.Decode(&yc); err != nil {
+		return DefaultConfig(), sources, fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	cfg, err := configFromYAML(yc)
+	return cfg, sources, err
+}
+
+// envNode превращает значение переменной окружения в узел YAML для настройки k.
+// Строки берутся как есть (без разбора YAML, чтобы "#ffd86b" или "off" не
+// поменяли смысл), списки строк - через запятую, словари - в синтаксисе YAML:
+// DOCSRV_ACCESS='{HR: {groups: [Кадры]}}'.
+func envNode(k configKey, value string) (*yaml.Node, error) {
+	switch {
+	case k.typ.Kind() == reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+
+	case k.typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false")
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+
+	case k.typ.Kind() == reflect.Slice && k.typ.Elem().Kind() == reflect.String:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return n, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+	}
+	n := doc.Content[0]
+	// Проверяем значение сразу, чтобы ошибка указывала на переменную, а не на файл.
+	if err := n.Decode(reflect.New(k.typ).Interface()); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// lookupNode возвращает значение по пути "auth.ldap.url" или nil.
+func lookupNode(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for _, name := range strings.Split(path, ".") {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == name {
+				next = n.Content[i+1]
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// setNode записывает значение по пути, создавая недостающие секции.
+func setNode(root *yaml.Node, path string, value *yaml.Node) {
+	names := strings.Split(path, ".")
+	n := root
+	for i, name := range names {
+		var next *yaml.Node
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value == name {
+				next = n.Content[j+1]
+			}
+		}
+		if i == len(names)-1 {
+			if next != nil {
+				*next = *value
+			} else {
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, value)
+			}
+			return
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, next)
+		} else if next.Kind != yaml.MappingNode {
+			// "tls:" без полей - пустая секция.
+			*next = yaml.Node{Kind: yaml.MappingNode}
+		}
+		n = next
+	}
+}
+
+// nodeString - значение настройки одной строкой для вывода -check-config.
+func nodeString(k configKey, n *yaml.Node) string {
+	if k.secret() && n.Value != "" {
+		return "***"
+	}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return n.Value
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return flowString(n)
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ", ")
+	}
+	return flowString(n)
+}
+
+func flowString(n *yaml.Node) string {
+	c := *n
+	c.Style = yaml.FlowStyle
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return "?"
+	}
+	return strings.TrimSpace(string(data))
+}
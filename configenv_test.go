@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadLayeredConfig_Precedence(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	data := "docs_dir: /file/docs\nport: \"8081\"\ncache_ttl: 1m\ntls:\n  cert_file: server.crt\n  key_file: server.key\n"
+	if err := os.WriteFile(cfgPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{
+		"DOCSRV_PORT=8082",
+		"DOCSRV_CACHE_TTL=10m",
+		"DOCSRV_TLS_CERT_FILE=/etc/docsrv/tls.crt",
+		"DOCSRV_BRANDING_ACCENT_COLOR=#abc",
+		"PATH=/usr/bin",
+	}
+	cfg, sources, err := LoadLayeredConfig(cfgPath, env, map[string]string{"port": "8083"})
+	if err != nil {
+		t.Fatalf("LoadLayeredConfig failed: %v", err)
+	}
+
+	if cfg.DocsDir != "/file/docs" || cfg.Port != "8083" || cfg.CacheTTL != 10*time.Minute {
+		t.Errorf("unexpected config: docs_dir=%s port=%s cache_ttl=%s", cfg.DocsDir, cfg.Port, cfg.CacheTTL)
+	}
+	if cfg.TLS == nil || cfg.TLS.CertFile != "/etc/docsrv/tls.crt" || cfg.TLS.KeyFile != "server.key" {
+		t.Errorf("expected env to override a single field of the tls section, got %+v", cfg.TLS)
+	}
+	// "#" would start a YAML comment; env values are taken literally.
+	if cfg.Branding.AccentColor != "#abc" {
+		t.Errorf("AccentColor = %q, want #abc", cfg.Branding.AccentColor)
+	}
+	if cfg.ReadTimeout != DefaultConfig().ReadTimeout {
+		t.Errorf("expected the default read_timeout, got %s", cfg.ReadTimeout)
+	}
+
+	for key, want := range map[string]string{
+		"docs_dir":      sourceFile,
+		"port":          sourceFlag,
+		"cache_ttl":     "env DOCSRV_CACHE_TTL",
+		"tls.cert_file": "env DOCSRV_TLS_CERT_FILE",
+		"tls.key_file":  sourceFile,
+	} {
+		if got := sources[key].Source; got != want {
+			t.Errorf("source of %s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := sources["read_timeout"]; ok {
+		t.Error("expected no source for a default value")
+	}
+}
+
+func TestLoadLayeredConfig_EnvTypes(t *testing.T) {
+	env := []string{
+		"DOCSRV_TRUSTED_PROXIES=10.0.0.0/8, 192.168.1.5",
+		"DOCSRV_ACCESS={HR: {groups: [Кадры]}}",
+		"DOCSRV_AUDIT_VIEWERS_GROUPS=Служба безопасности",
+		"DOCSRV_ACK_DB=",
+		"DOCSRV_AUTH_MODE=optional",
+		"DOCSRV_AUTH_LDAP_URL=ldaps://dc.example.local",
+		"DOCSRV_AUTH_LDAP_USER_BIND=%s@example.local",
+		"DOCSRV_AUTH_LDAP_BASE_DN=dc=example,dc=local",
+		"DOCSRV_AUTH_LDAP_BIND_PASSWORD=secret",
+		"DOCSRV_AUTH_LDAP_START_TLS=true",
+	}
+	cfg, sources, err := LoadLayeredConfig(filepath.Join(t.TempDir(), "missing.yaml"), env, nil)
+	if err != nil {
+		t.Fatalf("LoadLayeredConfig failed: %v", err)
+	}
+	if len(cfg.TrustedProxies) != 2 || !cfg.TrustedProxies.contains("192.168.1.5") {
+		t.Errorf("unexpected trusted proxies: %v", cfg.TrustedProxies)
+	}
+	if len(cfg.Access) != 1 {
+		t.Errorf("unexpected access rules: %+v", cfg.Access)
+	}
+	if cfg.AuditViewers == nil || len(cfg.AuditViewers.Groups) != 1 || cfg.AuditViewers.Groups[0] != "Служба безопасности" {
+		t.Errorf("unexpected audit viewers: %+v", cfg.AuditViewers)
+	}
+	if cfg.AckDB != "" {
+		t.Errorf("expected an empty DOCSRV_ACK_DB to disable acknowledgements, got %q", cfg.AckDB)
+	}
+	if cfg.Auth.LDAP == nil || !cfg.Auth.LDAP.StartTLS || cfg.Auth.LDAP.BindPassword != "secret" {
+		t.Errorf("unexpected ldap config: %+v", cfg.Auth.LDAP)
+	}
+	if got := sources["auth.ldap.bind_password"].Value; got != "***" {
+		t.Errorf("expected the password to be masked, got %q", got)
+	}
+}
+
+func TestLoadLayeredConfig_InvalidEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	for _, kv := range []string{
+		"DOCSRV_CACHE_TTL=soon",
+		"DOCSRV_AUTH_LDAP_START_TLS=maybe",
+		"DOCSRV_ACCESS=[HR]",
+	} {
+		if _, _, err := LoadLayeredConfig(path, []string{kv}, nil); err == nil {
+			t.Errorf("expected error for %s", kv)
+		}
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	keys := map[string]string{}
+	for _, k := range configKeys {
+		keys[k.path] = k.env()
+	}
+	for path, env := range map[string]string{
+		"docs_dir":              "DOCSRV_DOCS_DIR",
+		"tls.client_ca_file":    "DOCSRV_TLS_CLIENT_CA_FILE",
+		"auth.oidc.scopes":      "DOCSRV_AUTH_OIDC_SCOPES",
+		"audit_viewers.groups":  "DOCSRV_AUDIT_VIEWERS_GROUPS",
+		"document_types":        "DOCSRV_DOCUMENT_TYPES",
+		"branding.accent_color": "DOCSRV_BRANDING_ACCENT_COLOR",
+	} {
+		if keys[path] != env {
+			t.Errorf("env for %s = %q, want %q", path, keys[path], env)
+		}
+	}
+}
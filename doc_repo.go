@@ -1,85 +1,438 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/ast"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/text"
 )
 
+// Название секции для документов из корня каталога.
+const generalSectionName = "Общее"
+
 type Document struct {
 	Name string
 	URL  string
+	// Path - путь к файлу относительно каталога документов, с "/".
+	Path    string
+	Size    int64
+	ModTime time.Time
+
+	// Тип документа: расширение без точки ("pdf", "docx") и иконка для него (см. doctypes.go).
+	Type string
+	Icon string
+
+	// Сведения из самого PDF (словарь Info и дерево страниц).
+	PDFTitle string
+	Author   string
+	Created  time.Time
+	Pages    int
+
+	// Описание из файла-спутника (см. meta.go); пустое, если его нет.
+	DocumentMeta
+}
+
+// DisplayName возвращает название документа для показа пользователю:
+// заголовок из описания, затем заголовок из PDF, а если нет ни того,
+// ни другого - имя файла.
+func (d Document) DisplayName() string {
+	if d.Title != "" {
+		return d.Title
+	}
+	if d.PDFTitle != "" {
+		return d.PDFTitle
+	}
+	return d.Name
+}
+
+// Details возвращает краткие сведения о файле для показа рядом со ссылкой,
+// например "Иванов И.И. · 12 стр. · 1,2 МБ · 15.01.2025".
+func (d Document) Details() string {
+	var parts []string
+	if d.Author != "" {
+		parts = append(parts, d.Author)
+	}
+	if d.Pages > 0 {
+		parts = append(parts, fmt.Sprintf("%d стр.", d.Pages))
+	}
+	parts = append(parts, formatSize(d.Size))
+	if !d.ModTime.IsZero() {
+		parts = append(parts, d.ModTime.Format("02.01.2006"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatSize форматирует размер файла в человекочитаемом виде: "512 Б", "340 КБ", "1,2 МБ".
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d Б", size)
+	}
+
+	units := []string{"КБ", "МБ", "ГБ", "ТБ"}
+	value := float64(size) / unit
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+
+	if value >= 10 {
+		return fmt.Sprintf("%.0f %s", value, units[i])
+	}
+	return strings.Replace(fmt.Sprintf("%.1f %s", value, units[i]), ".", ",", 1)
 }
 
 type Section struct {
-	Name      string
+	Name string
+	// Path - относительный путь директории с "/" ("" для секции "Общее").
+	Path      string
 	Documents []Document
 	Readme    template.HTML
+	// Исходный Markdown README (для API).
+	ReadmeSource string
 }
 
+// defaultScanTimeout - сколько ждать сканирования каталога, прежде чем
+// считать сетевую шару зависшей.
+const defaultScanTimeout = 2 * time.Minute
+
 type DocRepository struct {
-	dir       string
-	cache     []Section
+	dir string
+	// cache - результат последнего успешного сканирования (nil до первого).
+	cache     *scanResult
 	cacheTime time.Time
 	mu        sync.RWMutex
 	ttl       time.Duration
+
+	// scanTimeout ограничивает время ожидания сканирования.
+	scanTimeout time.Duration
+	// inflight - текущее сканирование; одновременно выполняется не больше одного,
+	// все желающие дожидаются его результата (singleflight).
+	inflight *scanCall
+	// lastAttempt - время запуска последнего сканирования (успешного или нет),
+	// чтобы при ошибках не пересканировать на каждый запрос.
+	lastAttempt time.Time
+	status      ScanStatus
+
+	// types - типы файлов, которые считаются документами.
+	types DocumentTypes
+	// accessRules - правила доступа к разделам из config.yaml (см. access.go).
+	accessRules accessRules
+	// basePath - префикс, под которым опубликован сайт ("/normdocs"),
+	// для ссылок на документы; "" - корень.
+	basePath string
+
+	// watching - каталог отслеживается в фоне (см. Watch), поэтому кэш
+	// обновляется по событиям и не устаревает по TTL при обращении.
+	watching bool
+
+	// changes - последние изменения документов, от новых к старым (см. changes.go).
+	changes []DocChange
+	// changesRecorded - сколько изменений записано за всё время (с учётом вытесненных).
+	changesRecorded int
+	// changesBase - с чем сравнить первое сканирование (см. continueChanges).
+	changesBase *scanResult
+	// changesPrev - репозиторий прежней конфигурации, историю которого
+	// забирает inheritChanges; changesPrevRecorded - его changesRecorded
+	// в момент, когда был взят changesBase.
+	changesPrev         *DocRepository
+	changesPrevRecorded int
+}
+
+// ScanStatus - состояние сканирования каталога для мониторинга.
+type ScanStatus struct {
+	// LastScan - время последнего успешного сканирования.
+	LastScan time.Time
+	// LastDuration - длительность последнего завершённого сканирования.
+	LastDuration time.Duration
+	// LastError - ошибка последнего сканирования; nil, если оно было успешным.
+	// При ошибке продолжают отдаваться данные последнего успешного сканирования.
+	LastError     error
+	LastErrorTime time.Time
+	// FailingSince - время первой из идущих подряд ошибок сканирования
+	// (с него каталог недоступен); нулевое, если последнее сканирование успешно.
+	FailingSince time.Time
+	// Sections и Documents - число разделов и документов по последнему успешному сканированию.
+	Sections  int
+	Documents int
+	// InProgress - сканирование выполняется прямо сейчас (в т.ч. зависшее).
+	InProgress bool
+}
+
+// scanCall - сканирование, результат которого ждут несколько вызывающих.
+type scanCall struct {
+	done chan struct{}
+	err  error
+}
+
+// scanResult - результат одного сканирования каталога.
+// После сканирования только читается.
+type scanResult struct {
+	sections []Section
+	index    *searchIndex
+	// Данные PDF (ключ - путь к файлу), чтобы при следующем сканировании
+	// не разбирать неизменившиеся файлы повторно.
+	pdfs map[string]pdfData
+	// access - правила доступа из файлов .access.yaml, ключ - относительный путь директории.
+	access accessRules
 }
 
 func NewDocRepository(dir string, cacheTTL time.Duration) *DocRepository {
 	return &DocRepository{
-		dir: dir,
-		ttl: cacheTTL,
+		dir:         dir,
+		ttl:         cacheTTL,
+		scanTimeout: defaultScanTimeout,
+		types:       DefaultDocumentTypes(),
 	}
 }
 
+// GetSections возвращает все разделы без учёта прав доступа.
+// Для ответа пользователю используйте SectionsFor.
 func (r *DocRepository) GetSections() ([]Section, error) {
-	r.mu.RLock()
-	if time.Since(r.cacheTime) < r.ttl && r.cache != nil {
-		defer r.mu.RUnlock()
-		return r.cache, nil
+	res, err := r.snapshot()
+	if err != nil {
+		return nil, err
 	}
-	r.mu.RUnlock()
+	return res.sections, nil
+}
+
+// SectionsFor возвращает разделы, доступные пользователю u (nil - анонимный).
+func (r *DocRepository) SectionsFor(u *User) ([]Section, error) {
+	res, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]Section, 0, len(res.sections))
+	for _, s := range res.sections {
+		if r.ruleFor(res, s.Path).allows(u) {
+			sections = append(sections, s)
+		}
+	}
+	return sections, nil
+}
+
+// CanAccessFile проверяет, может ли пользователь u открыть файл rel
+// (путь относительно каталога документов, с "/").
+func (r *DocRepository) CanAccessFile(u *User, rel string) bool {
+	return r.CanAccessDir(u, path.Dir(path.Clean("/"+rel)))
+}
+
+// CanAccessDir проверяет, может ли пользователь u открыть директорию dir.
+func (r *DocRepository) CanAccessDir(u *User, dir string) bool {
+	res, err := r.snapshot()
+	if err != nil {
+		// Без результата сканирования правила из .access.yaml неизвестны.
+		return false
+	}
+	return r.ruleFor(res, dir).allows(u)
+}
+
+// SectionName возвращает название раздела, в котором лежит файл rel.
+// Для файлов вне разделов (картинки во вложенных папках и т.п.) - путь директории.
+func (r *DocRepository) SectionName(rel string) string {
+	dir := strings.TrimPrefix(path.Dir(path.Clean("/"+rel)), "/")
+	if res, err := r.snapshot(); err == nil {
+		for _, s := range res.sections {
+			if accessKey(s.Path) == accessKey(dir) {
+				return s.Name
+			}
+		}
+	}
+	if dir == "" {
+		return generalSectionName
+	}
+	return dir
+}
+
+// Search выполняет полнотекстовый поиск по содержимому всех документов без учёта прав доступа.
+func (r *DocRepository) Search(query string, limit int) ([]SearchResult, error) {
+	res, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return res.index.search(query, limit, nil), nil
+}
+
+// SearchFor ищет только среди документов, доступных пользователю u.
+func (r *DocRepository) SearchFor(u *User, query string, limit int) ([]SearchResult, error) {
+	res, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return res.index.search(query, limit, func(d Document) bool {
+		return r.ruleFor(res, path.Dir(d.Path)).allows(u)
+	}), nil
+}
 
-	// Cache expired or empty, refresh
+// startFirstScan запускает сканирование в фоне, если результата ещё нет.
+// Неудачное сканирование повторяется не чаще раза в cache_ttl, как в snapshot.
+func (r *DocRepository) startFirstScan() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.cacheTime.IsZero() && (r.lastAttempt.IsZero() || time.Since(r.lastAttempt) >= r.ttl) {
+		r.startScanLocked()
+	}
+}
 
-	// Double check locking
-	if time.Since(r.cacheTime) < r.ttl && r.cache != nil {
-		return r.cache, nil
+// Status возвращает состояние сканирования каталога.
+func (r *DocRepository) Status() ScanStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	st := r.status
+	st.InProgress = r.inflight != nil
+	return st
+}
+
+// snapshot возвращает секции и поисковый индекс по принципу stale-while-revalidate:
+//
+//   - если кэш есть, он возвращается сразу, даже устаревший; при устаревании
+//     в фоне запускается (единственное) пересканирование;
+//   - если кэша ещё нет (первый запрос), вызывающий ждёт сканирования,
+//     но не дольше scanTimeout.
+func (r *DocRepository) snapshot() (*scanResult, error) {
+	// Обычный случай - свежий кэш: хватает блокировки на чтение.
+	r.mu.RLock()
+	// Пустой каталог - тоже валидный результат, поэтому смотрим на время, а не на r.cache.
+	res, cached := r.cache, !r.cacheTime.IsZero()
+	stale := !r.watching && time.Since(r.lastAttempt) >= r.ttl
+	r.mu.RUnlock()
+	if cached && !stale {
+		metrics.cache.add(1, "hit")
+		return res, nil
 	}
 
-	sections, err := r.scan()
-	if err != nil {
+	r.mu.Lock()
+	// Пока ждали блокировку, сканирование мог запустить другой запрос - проверяем заново.
+	if !r.cacheTime.IsZero() {
+		res := r.cache
+		if !r.watching && time.Since(r.lastAttempt) >= r.ttl {
+			// Устаревшее дерево отдаётся сразу, но это не попадание в кэш.
+			metrics.cache.add(1, "stale")
+			r.startScanLocked()
+		} else {
+			metrics.cache.add(1, "hit")
+		}
+		r.mu.Unlock()
+		return res, nil
+	}
+	call := r.startScanLocked()
+	r.mu.Unlock()
+	metrics.cache.add(1, "miss")
+
+	if err := r.wait(call); err != nil {
 		return nil, err
 	}
 
-	r.cache = sections
-	r.cacheTime = time.Now()
-	return sections, nil
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cache, nil
+}
+
+// Refresh пересканирует каталог и дожидается результата (не дольше scanTimeout).
+// Если сканирование уже идёт, новое не запускается - ждём текущее.
+// Чтение кэша на время сканирования не блокируется.
+func (r *DocRepository) Refresh() error {
+	r.mu.Lock()
+	call := r.startScanLocked()
+	r.mu.Unlock()
+
+	return r.wait(call)
+}
+
+// wait дожидается завершения сканирования, но не дольше scanTimeout.
+// Зависшее сканирование продолжает выполняться в фоне и не даёт запустить новое.
+func (r *DocRepository) wait(call *scanCall) error {
+	timer := time.NewTimer(r.scanTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-timer.C:
+		return fmt.Errorf("scan of docs directory timed out after %s", r.scanTimeout)
+	}
+}
+
+// startScanLocked запускает фоновое сканирование, если оно ещё не идёт,
+// и возвращает текущее. Должна вызываться под r.mu.Lock().
+func (r *DocRepository) startScanLocked() *scanCall {
+	if r.inflight != nil {
+		return r.inflight
+	}
+
+	call := &scanCall{done: make(chan struct{})}
+	r.inflight = call
+	r.lastAttempt = time.Now()
+	var prevPDFs map[string]pdfData
+	if r.cache != nil {
+		prevPDFs = r.cache.pdfs
+	}
+
+	go func() {
+		start := time.Now()
+
+		// Контекст прерывает обход между файлами; от зависшего системного вызова
+		// он не спасёт, поэтому ожидающих дополнительно ограничивает wait().
+		ctx, cancel := context.WithTimeout(context.Background(), r.scanTimeout)
+		res, err := r.scan(ctx, prevPDFs)
+		cancel()
+		metrics.observeScan(res, time.Since(start))
+
+		r.mu.Lock()
+		r.status.LastDuration = time.Since(start)
+		if err != nil {
+			// Оставляем последнее удачное дерево, ошибку показываем в health.
+			if r.status.LastError == nil {
+				r.status.FailingSince = time.Now()
+			}
+			r.status.LastError = err
+			r.status.LastErrorTime = time.Now()
+			log.Printf("Error scanning docs directory: %v", err)
+		} else {
+			r.recordChangesLocked(res, time.Now())
+			r.cache = res
+			r.cacheTime = time.Now()
+			r.status.LastScan = r.cacheTime
+			r.status.LastError = nil
+			r.status.FailingSince = time.Time{}
+			r.status.Sections = len(res.sections)
+			r.status.Documents = 0
+			for _, s := range res.sections {
+				r.status.Documents += len(s.Documents)
+			}
+		}
+		r.inflight = nil
+		r.mu.Unlock()
+
+		call.err = err
+		close(call.done)
+	}()
+
+	return call
 }
 
 // scan выполняет рекурсивный обход каталога документов.
+// prevPDFs - данные PDF с прошлого сканирования, они только читаются.
 //
-//  * Файлы .pdf в корне r.dir попадают в секцию "Общее".
-//  * Каждая поддиректория (любого уровня), в которой есть хотя бы один .pdf
+//  * Документы (файлы с расширениями из r.types) в корне r.dir попадают в секцию "Общее".
+//  * Каждая поддиректория (любого уровня), в которой есть хотя бы один документ
 //    или README.md, становится отдельной секцией с именем вида "HR/2025".
 //  * README.md в каждой директории рендерится в HTML, а относительные
 //    ссылки/картинки переписываются на базу "/docs/<relative-dir>/...".
-func (r *DocRepository) scan() ([]Section, error) {
+//  * Из каждого .pdf извлекается текст, который попадает в поисковый индекс,
+//    и сведения из словаря Info (название, автор, дата создания, число страниц).
+func (r *DocRepository) scan(ctx context.Context, prevPDFs map[string]pdfData) (*scanResult, error) {
 	// Проверим, что корневая директория доступна.
 	if _, err := os.Stat(r.dir); err != nil {
 		return nil, fmt.Errorf("could not stat docs directory: %w", err)
@@ -92,9 +445,78 @@ func (r *DocRepository) scan() ([]Section, error) {
 		// Ключ - относительный путь директории (с файловыми разделителями),
 		// значение - собираемая секция.
 		sectionsMap = make(map[string]*Section)
+
+		index = newSearchIndex()
+		pdfs  = make(map[string]pdfData)
+
+		// Описания документов из файлов-спутников, ключ - путь директории.
+		metaByDir = make(map[string]dirMetadata)
+
+		access = make(accessRules)
 	)
 
+	// addDocument добавляет документ в список секции. Для PDF и Markdown его текст
+	// (извлечённый заново или взятый из кэша) попадает в поисковый индекс,
+	// а сведения из самого PDF (название, автор, число страниц) - в Document.
+	addDocument := func(path, rel string, d fs.DirEntry, dt DocumentType, ext, section string, docs *[]Document) {
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("Error reading file info %s: %v", path, err)
+			return
+		}
+
+		dir := filepath.Dir(path)
+		meta, ok := metaByDir[dir]
+		if !ok {
+			meta = loadDirMetadata(dir)
+			metaByDir[dir] = meta
+		}
+
+		// Собираем URL по относительному пути внутри /docs/.
+		doc := Document{
+			Name:         d.Name(),
+			URL:          r.basePath + "/docs/" + filepath.ToSlash(rel),
+			Path:         filepath.ToSlash(rel),
+			Size:         info.Size(),
+			ModTime:      info.ModTime(),
+			Type:         strings.TrimPrefix(ext, "."),
+			Icon:         dt.Icon,
+			DocumentMeta: meta.lookup(d.Name()),
+		}
+
+		// Markdown-документы открываются отрендеренной страницей, их текст тоже ищется.
+		if ext == markdownExt {
+			doc.URL = r.basePath + "/view/" + filepath.ToSlash(rel)
+			source, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("Error reading markdown document %s: %v", path, err)
+			}
+			*docs = append(*docs, doc)
+			index.add(section, doc, []string{markdownText(source)})
+			return
+		}
+
+		if ext != ".pdf" {
+			*docs = append(*docs, doc)
+			return
+		}
+
+		data := cachedPDF(path, info, prevPDFs, pdfs)
+		doc.PDFTitle = data.info.Title
+		doc.Author = data.info.Author
+		doc.Created = data.info.Created
+		doc.Pages = data.info.Pages
+
+		*docs = append(*docs, doc)
+		index.add(section, doc, data.pages)
+	}
+
 	walkFn := func(path string, d fs.DirEntry, err error) error {
+		// Прерываем обход по таймауту сканирования.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
 		if err != nil {
 			log.Printf("Error accessing %s: %v", path, err)
 			return nil // пропускаем проблемные узлы, но не останавливаем обход
@@ -118,13 +540,25 @@ func (r *DocRepository) scan() ([]Section, error) {
 		lowerName := strings.ToLower(d.Name())
 		dirRel := filepath.Dir(rel) // относительный путь директории
 
+		if lowerName == accessFileName {
+			rule, err := loadAccessFile(path)
+			if err != nil {
+				// Испорченный файл не должен открывать раздел: закрываем его для всех.
+				log.Printf("Error reading %s: %v; section is closed until fixed", path, err)
+				rule = &accessRule{}
+			}
+			access.set(filepath.ToSlash(dirRel), rule)
+			return nil
+		}
+
+		dt, ext, isDoc := r.types.lookup(d.Name())
+		// README.md описывает секцию и документом не считается, даже если .md есть в r.types.
+		isDoc = isDoc && lowerName != "readme.md"
+
 		// Файлы в корне r.dir → секция "Общее".
 		if dirRel == "." {
-			if strings.HasSuffix(lowerName, ".pdf") {
-				generalDocs = append(generalDocs, Document{
-					Name: d.Name(),
-					URL:  "/docs/" + d.Name(),
-				})
+			if isDoc {
+				addDocument(path, rel, d, dt, ext, generalSectionName, &generalDocs)
 			}
 			return nil
 		}
@@ -132,26 +566,23 @@ func (r *DocRepository) scan() ([]Section, error) {
 		// Все остальные файлы относятся к некоторой поддиректории.
 		sec, ok := sectionsMap[dirRel]
 		if !ok {
-			sec = &Section{Name: filepath.ToSlash(dirRel)}
+			sec = &Section{Name: filepath.ToSlash(dirRel), Path: filepath.ToSlash(dirRel)}
 			sectionsMap[dirRel] = sec
 		}
 
-		if strings.HasSuffix(lowerName, ".pdf") {
-			// Собираем URL по относительному пути внутри /docs/.
-			sec.Documents = append(sec.Documents, Document{
-				Name: d.Name(),
-				URL:  "/docs/" + filepath.ToSlash(rel),
-			})
+		if isDoc {
+			addDocument(path, rel, d, dt, ext, sec.Name, &sec.Documents)
 			return nil
 		}
 
 		if lowerName == "readme.md" {
-			readmeHTML, err := renderReadme(path, filepath.ToSlash(dirRel))
+			source, err := os.ReadFile(path)
 			if err != nil {
 				log.Printf("Error reading README in %s: %v", dirRel, err)
 				return nil
 			}
-			sec.Readme = readmeHTML
+			sec.Readme = renderReadme(source, r.basePath, filepath.ToSlash(dirRel))
+			sec.ReadmeSource = string(source)
 		}
 
 		return nil
@@ -161,13 +592,13 @@ func (r *DocRepository) scan() ([]Section, error) {
 		return nil, fmt.Errorf("could not walk docs directory: %w", err)
 	}
 
+	index.finalize()
+
 	// Собираем итоговый срез секций.
 	if len(generalDocs) > 0 {
-		// Отсортируем документы в "Общее" по имени.
-		sort.Slice(generalDocs, func(i, j int) bool {
-			return strings.ToLower(generalDocs[i].Name) < strings.ToLower(generalDocs[j].Name)
-		})
-		sections = append(sections, Section{Name: "Общее", Documents: generalDocs})
+		// Отсортируем документы в "Общее" по названию.
+		sortDocuments(generalDocs)
+		sections = append(sections, Section{Name: generalSectionName, Documents: generalDocs})
 	}
 
 	// Секции из поддиректорий: сортируем по имени секции и по имени документа внутри.
@@ -183,72 +614,17 @@ func (r *DocRepository) scan() ([]Section, error) {
 			continue
 		}
 
-		sort.Slice(sec.Documents, func(i, j int) bool {
-			return strings.ToLower(sec.Documents[i].Name) < strings.ToLower(sec.Documents[j].Name)
-		})
+		sortDocuments(sec.Documents)
 
 		sections = append(sections, *sec)
 	}
 
-	return sections, nil
+	return &scanResult{sections: sections, index: index, pdfs: pdfs, access: access}, nil
 }
 
-// renderReadme читает README.md по заданному пути и рендерит его в HTML,
-// переписывая относительные ссылки/картинки на базу "/docs/<relDir>/".
-// relDir - относительный путь директории внутри r.dir, в формате с "/".
-func renderReadme(path string, relDir string) (template.HTML, error) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-
-	md := goldmark.New()
-	ctx := parser.NewContext()
-
-	reader := text.NewReader(content)
-	doc := md.Parser().Parse(reader, parser.WithContext(ctx))
-
-	basePrefix := "/docs/" + relDir + "/"
-
-	// Проходим по AST и переписываем относительные URL.
-	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		if !entering {
-			return ast.WalkContinue, nil
-		}
-
-		rewrite := func(dest []byte) []byte {
-			url := string(dest)
-			if isRelativeURL(url) {
-				return []byte(basePrefix + url)
-			}
-			return dest
-		}
-
-		if img, ok := n.(*ast.Image); ok {
-			img.Destination = rewrite(img.Destination)
-		}
-		if link, ok := n.(*ast.Link); ok {
-			link.Destination = rewrite(link.Destination)
-		}
-
-		return ast.WalkContinue, nil
+// sortDocuments сортирует документы по отображаемому названию без учёта регистра.
+func sortDocuments(docs []Document) {
+	sort.Slice(docs, func(i, j int) bool {
+		return strings.ToLower(docs[i].DisplayName()) < strings.ToLower(docs[j].DisplayName())
 	})
-
-	var buf bytes.Buffer
-	if err := md.Renderer().Render(&buf, content, doc); err != nil {
-		// Fallback: эскейпнем исходный Markdown как текст, если рендеринг не удался.
-		return template.HTML(template.HTMLEscapeString(string(content))), nil
-	}
-
-	return template.HTML(buf.String()), nil
-}
-
-// isRelativeURL возвращает true, если URL выглядит как относительный путь
-// внутри README (не начинается с '/' или http/https).
-func isRelativeURL(u string) bool {
-	lower := strings.ToLower(u)
-	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
-		return false
-	}
-	return !strings.HasPrefix(lower, "/")
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -45,14 +46,118 @@ func TestDocRepository_CacheTTL(t *testing.T) {
 		t.Fatalf("expected cached 1 section within TTL, got %d", len(sections2))
 	}
 
-	// Wait for TTL to expire and expect cache refresh (no sections, так как файл удален).
+	// Wait for TTL to expire: the stale tree is still served immediately,
+	// while the rescan runs in the background.
 	time.Sleep(60 * time.Millisecond)
 
 	sections3, err := repo.GetSections()
 	if err != nil {
 		t.Fatalf("GetSections (third) failed: %v", err)
 	}
-	if len(sections3) != 0 {
-		t.Fatalf("expected 0 sections after TTL expiration, got %d", len(sections3))
+	if len(sections3) != 1 {
+		t.Fatalf("expected stale 1 section right after TTL expiration, got %d", len(sections3))
+	}
+
+	// Eventually the background rescan replaces the cache (no sections, так как файл удален).
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sections4, err := repo.GetSections()
+		if err != nil {
+			t.Fatalf("GetSections (fourth) failed: %v", err)
+		}
+		if len(sections4) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 0 sections after background refresh, got %d", len(sections4))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test that a failed rescan keeps the last good tree and is reported in Status.
+func TestDocRepository_ScanErrorKeepsLastGoodTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	docsDir := filepath.Join(tmpDir, "docs")
+	if err := os.Mkdir(docsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(docsDir, "doc1.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(docsDir, time.Hour)
+	if _, err := repo.GetSections(); err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+
+	// Share disappears.
+	if err := os.RemoveAll(docsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Refresh(); err == nil {
+		t.Fatal("expected Refresh to fail for missing directory")
+	}
+
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections after failed scan returned error: %v", err)
+	}
+	if len(sections) != 1 {
+		t.Fatalf("expected last good tree with 1 section, got %d", len(sections))
+	}
+
+	st := repo.Status()
+	if st.LastError == nil || st.LastErrorTime.IsZero() {
+		t.Fatalf("expected scan error in status, got %+v", st)
+	}
+	if st.LastScan.IsZero() {
+		t.Errorf("expected time of last successful scan, got zero")
+	}
+}
+
+// Test that concurrent requests on an empty cache share a single scan.
+func TestDocRepository_SingleScanForConcurrentRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc1.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.GetSections(); err != nil {
+				t.Errorf("GetSections failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	first := repo.Status().LastScan
+	if _, err := repo.GetSections(); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Status().LastScan != first {
+		t.Errorf("expected no rescan within TTL")
+	}
+}
+
+// Test that waiting for a scan is bounded by scanTimeout.
+func TestDocRepository_ScanTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc1.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Hour)
+	repo.scanTimeout = time.Nanosecond
+
+	if _, err := repo.GetSections(); err == nil {
+		t.Fatal("expected timeout error")
 	}
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DocumentType - тип документа, который показывается в каталоге.
+type DocumentType struct {
+	// Иконка перед ссылкой на документ.
+	Icon string
+	// Content-Type при отдаче через /docs/.
+	ContentType string
+	// Inline - открывать в браузере (Content-Disposition: inline),
+	// иначе - предлагать сохранить файл (attachment).
+	Inline bool
+}
+
+// DocumentTypes - допустимые типы документов, ключ - расширение в нижнем регистре с точкой (".pdf").
+type DocumentTypes map[string]DocumentType
+
+// yamlDocumentType mirrors one entry of document_types in config.yaml.
+type yamlDocumentType struct {
+	Icon        string `yaml:"icon"`
+	ContentType string `yaml:"content_type"`
+	Inline      *bool  `yaml:"inline"`
+}
+
+// DefaultDocumentTypes returns document types that are shown when config.yaml does not list them.
+func DefaultDocumentTypes() DocumentTypes {
+	return DocumentTypes{
+		".pdf":  {Icon: "📄", ContentType: "application/pdf", Inline: true},
+		".docx": {Icon: "📝", ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		".doc":  {Icon: "📝", ContentType: "application/msword"},
+		".xlsx": {Icon: "📊", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		".xls":  {Icon: "📊", ContentType: "application/vnd.ms-excel"},
+		".odt":  {Icon: "📝", ContentType: "application/vnd.oasis.opendocument.text"},
+		".ods":  {Icon: "📊", ContentType: "application/vnd.oasis.opendocument.spreadsheet"},
+		".rtf":  {Icon: "📝", ContentType: "application/rtf"},
+		".txt":  {Icon: "📃", ContentType: "text/plain; charset=utf-8", Inline: true},
+		".md":   {Icon: "📘", ContentType: "text/markdown; charset=utf-8", Inline: true},
+	}
+}
+
+// normalizeExt приводит расширение к виду ".pdf".
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// parseDocumentTypes строит DocumentTypes из секции document_types config.yaml.
+// Не указанные поля берутся из встроенных значений для известных расширений.
+func parseDocumentTypes(yt map[string]yamlDocumentType) (DocumentTypes, error) {
+	defaults := DefaultDocumentTypes()
+	types := make(DocumentTypes, len(yt))
+
+	for rawExt, y := range yt {
+		ext := normalizeExt(rawExt)
+		if len(ext) < 2 || strings.ContainsAny(ext[1:], `./\`) {
+			return nil, fmt.Errorf("invalid extension in document_types: %q", rawExt)
+		}
+
+		dt, known := defaults[ext]
+		if !known {
+			dt = DocumentType{Icon: "📄"}
+		}
+		if y.Icon != "" {
+			dt.Icon = y.Icon
+		}
+		if y.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(y.ContentType); err != nil {
+				return nil, fmt.Errorf("invalid content_type for %s in document_types: %q: %w", ext, y.ContentType, err)
+			}
+			dt.ContentType = y.ContentType
+		}
+		if y.Inline != nil {
+			dt.Inline = *y.Inline
+		}
+		if dt.ContentType == "" {
+			dt.ContentType = mime.TypeByExtension(ext)
+		}
+
+		types[ext] = dt
+	}
+
+	return types, nil
+}
+
+// lookup возвращает тип документа по имени файла.
+func (t DocumentTypes) lookup(name string) (DocumentType, string, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	dt, ok := t[ext]
+	return dt, ext, ok
+}
+
+// docsFileHandler отдаёт файлы из каталога документов, выставляя для известных
+// типов документов Content-Type и Content-Disposition (inline/attachment с
+// корректным, в т.ч. кириллическим, именем файла). Остальные файлы
+// (картинки из README и т.п.) отдаются как есть.
+// Файлы закрытых для пользователя разделов и служебные файлы (.access.yaml,
+// описания meta.yaml и *.yaml) отвечают 404, чтобы по ответу нельзя было понять,
+// что файл существует. Листингов директорий нет: в них видны имена закрытых
+// подразделов и служебных файлов, а перечень документов - на главной.
+// Запросы файлов пишутся в журнал скачиваний audit, а скачивания документов
+// учитываются в статистике stats, если они включены.
+func docsFileHandler(repo *DocRepository, audit *auditLog, stats *statsStore) http.Handler {
+	fileServer := http.FileServer(filesOnlyFS{http.Dir(repo.dir)})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || r.URL.Path == "" {
+			http.NotFound(w, r)
+			return
+		}
+		name := path.Base(r.URL.Path)
+
+		allowed := !isServiceFile(name, repo.types) && repo.CanAccessFile(userFromRequest(r), r.URL.Path)
+
+		rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		fullPath := filepath.Join(repo.dir, filepath.FromSlash(rel))
+		if !allowed {
+			http.NotFound(w, r)
+			audit.record(r, repo, rel, fullPath, auditResultDenied, http.StatusNotFound, 0)
+			return
+		}
+
+		dt, _, isDoc := repo.types.lookup(name)
+		if isDoc {
+			if dt.ContentType != "" {
+				w.Header().Set("Content-Type", dt.ContentType)
+			}
+			disposition := "attachment"
+			if dt.Inline {
+				disposition = "inline"
+			}
+			w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+		}
+
+		if audit == nil && stats == nil {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		lrw := &loggingResponseWriter{ResponseWriter: w}
+		fileServer.ServeHTTP(lrw, r)
+		if lrw.status == 0 {
+			lrw.status = http.StatusOK
+		}
+		audit.record(r, repo, rel, fullPath, auditResult(lrw.status), lrw.status, lrw.bytes)
+		if isDoc {
+			stats.countRequest(r, rel, lrw.status)
+		}
+	})
+}
+
+// isServiceFile сообщает, что файл name - служебный: правила доступа или
+// описание документов. Такие файлы через /docs/ не отдаются, если только
+// .yaml не объявлен типом документов. Точки и пробелы в конце имени
+// отбрасываются, как в accessKey: Windows открывает ".access.yaml." как ".access.yaml".
+func isServiceFile(name string, types DocumentTypes) bool {
+	lower := strings.ToLower(strings.TrimRight(name, ". "))
+	if lower == accessFileName || lower == dirMetaFileName {
+		return true
+	}
+	_, isDoc := types[sidecarSuffix]
+	return strings.HasSuffix(lower, sidecarSuffix) && !isDoc
+}
+
+// filesOnlyFS - каталог документов для http.FileServer, в котором директории
+// не открываются: без листингов и без перенаправлений, выдающих их существование.
+type filesOnlyFS struct {
+	http.FileSystem
+}
+
+func (fsys filesOnlyFS) Open(name string) (http.File, error) {
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDocRepository_NonPDFDocuments(t *testing.T) {
+	tmpDir := t.TempDir()
+	hrDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(hrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{
+		"order.pdf",
+		"HR/staff.XLSX",
+		"HR/rules.odt",
+		"HR/notes.txt",
+		"HR/photo.png",
+		"HR/README.md",
+	}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("expected 2 sections, got %d", len(sections))
+	}
+
+	hr := sections[1]
+	if len(hr.Documents) != 3 {
+		t.Fatalf("expected 3 documents in HR (png and README are not documents), got %+v", hr.Documents)
+	}
+	byName := make(map[string]Document)
+	for _, d := range hr.Documents {
+		byName[d.Name] = d
+	}
+	staff := byName["staff.XLSX"]
+	if staff.Type != "xlsx" || staff.Icon != "📊" || staff.URL != "/docs/HR/staff.XLSX" {
+		t.Errorf("unexpected xlsx document: %+v", staff)
+	}
+	if byName["notes.txt"].Type != "txt" || byName["rules.odt"].Type != "odt" {
+		t.Errorf("unexpected documents: %+v", hr.Documents)
+	}
+
+	// Only configured types are shown.
+	repo = NewDocRepository(tmpDir, time.Minute)
+	repo.types = DocumentTypes{".odt": {Icon: "O"}}
+	sections, err = repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+	if len(sections) != 1 || len(sections[0].Documents) != 1 || sections[0].Documents[0].Name != "rules.odt" {
+		t.Fatalf("expected only rules.odt, got %+v", sections)
+	}
+}
+
+func TestDocsFileHandler_SetsContentHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"Приказ 1.pdf", "staff.xlsx", "logo.png"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := http.StripPrefix("/docs/", docsFileHandler(NewDocRepository(tmpDir, time.Minute), nil, nil))
+
+	cases := []struct {
+		url         string
+		contentType string
+		disposition string
+	}{
+		{"/docs/%D0%9F%D1%80%D0%B8%D0%BA%D0%B0%D0%B7%201.pdf", "application/pdf",
+			"inline; filename*=utf-8''%D0%9F%D1%80%D0%B8%D0%BA%D0%B0%D0%B7%201.pdf"},
+		{"/docs/staff.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			`attachment; filename=staff.xlsx`},
+		{"/docs/logo.png", "image/png", ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.url, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", c.url, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != c.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", c.url, got, c.contentType)
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != c.disposition {
+			t.Errorf("%s: Content-Disposition = %q, want %q", c.url, got, c.disposition)
+		}
+	}
+}
+
+func TestLoadConfig_DocumentTypes(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := []byte(`
+document_types:
+  PDF: {}
+  ".md": { icon: "M", inline: true }
+  ".docx": { icon: "W", content_type: "application/octet-stream" }
+`)
+	if err := os.WriteFile(cfgPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.DocumentTypes) != 3 {
+		t.Fatalf("expected configured types to replace defaults, got %+v", cfg.DocumentTypes)
+	}
+	if pdf := cfg.DocumentTypes[".pdf"]; pdf.ContentType != "application/pdf" || !pdf.Inline || pdf.Icon != "📄" {
+		t.Errorf("expected built-in values for .pdf, got %+v", pdf)
+	}
+	if md := cfg.DocumentTypes[".md"]; md.Icon != "M" || !md.Inline {
+		t.Errorf("unexpected .md type: %+v", md)
+	}
+	if docx := cfg.DocumentTypes[".docx"]; docx.ContentType != "application/octet-stream" || docx.Inline {
+		t.Errorf("unexpected .docx type: %+v", docx)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(`document_types: { "tar.gz": {} }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(cfgPath); err == nil {
+		t.Fatalf("expected error for invalid extension")
+	}
+}
+
+func TestIsServiceFile(t *testing.T) {
+	types := DefaultDocumentTypes()
+	for name, want := range map[string]bool{
+		".access.yaml":  true,
+		".access.yaml.": true,
+		"Meta.YAML":     true,
+		"meta.yaml ":    true,
+		"meta.yaml. . ": true,
+		"plan.pdf.yaml": true,
+		"plan.pdf":      false,
+		"scheme.png":    false,
+	} {
+		if got := isServiceFile(name, types); got != want {
+			t.Errorf("isServiceFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	// YAML files declared as documents are served, except the service ones.
+	types[".yaml"] = DocumentType{Icon: "⚙️"}
+	if isServiceFile("settings.yaml", types) || !isServiceFile("meta.yaml", types) {
+		t.Errorf("unexpected result with .yaml as a document type")
+	}
+}
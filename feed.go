@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// feedEntries - сколько последних изменений показывается в ленте.
+const feedEntries = 50
+
+// feedTagPrefix - начало идентификаторов ленты и записей (tag: URI, RFC 4151)
+// для сайта с адресом origin ("https://intranet") и base_path. Владелец метки -
+// имя сервера, а base_path входит в путь: ленты разных сайтов не смешиваются
+// у читателя, подписанного на обе. Порт и схема в метку не входят.
+func feedTagPrefix(origin, basePath string) string {
+	host := origin
+	if u, err := url.Parse(origin); err == nil && u.Hostname() != "" {
+		host = strings.ToLower(u.Hostname())
+	}
+	prefix := "tag:" + host + ",2025:"
+	if basePath != "" {
+		prefix += strings.TrimPrefix(basePath, "/") + "/"
+	}
+	return prefix
+}
+
+// Заголовки записей ленты по виду изменения.
+var feedEntryTitles = map[string]string{
+	changeAdded:    "Добавлен",
+	changeModified: "Изменён",
+	changeRemoved:  "Удалён",
+	changeUpdated:  "Обновлён",
+}
+
+// atomFeed - лента в формате Atom (RFC 4287).
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated time.Time   `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title    string       `xml:"title"`
+	ID       string       `xml:"id"`
+	Updated  time.Time    `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Category atomCategory `xml:"category"`
+	Summary  string       `xml:"summary,omitempty"`
+}
+
+// feedHandler отдаёт ленту новых, изменённых и удалённых документов в формате
+// Atom: GET /feed.atom - по всем разделам, /feed.atom?section=HR - по разделу
+// вместе с подразделами. В ленту попадают только разделы, доступные пользователю.
+// publicURL - адрес сайта для ссылок и идентификаторов ("https://intranet"). Без него
+// адрес берётся из запроса, но только пришедшего через прокси из trusted: заголовок
+// Host задаёт клиент, и прямой запрос мог бы подменить ссылки в ленте.
+func feedHandler(repo *DocRepository, branding Branding, publicURL string, trusted trustedProxies) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ссылки в ленте абсолютные: читатели лент открывают их вне сайта.
+		origin := publicURL
+		if origin == "" {
+			if !trusted.contains(remoteHost(r)) {
+				log.Printf("Feed request from %s bypassed trusted_proxies; set public_url to serve it", remoteHost(r))
+				http.NotFound(w, r)
+				return
+			}
+			origin = requestScheme(r) + "://" + r.Host
+		}
+
+		u := userFromRequest(r)
+		section := strings.Trim(path.Clean("/"+r.URL.Query().Get("section")), "/")
+		if section != "" && !repo.CanAccessDir(u, section) {
+			http.NotFound(w, r)
+			return
+		}
+
+		changes, err := repo.ChangesFor(u)
+		if err != nil {
+			http.Error(w, "Could not load documents", http.StatusInternalServerError)
+			log.Printf("Error getting document changes: %v", err)
+			return
+		}
+
+		site := origin + repo.basePath
+		self := site + "/feed.atom"
+		tag := feedTagPrefix(origin, repo.basePath)
+		id := tag + "feed"
+		title := branding.SiteName
+		if section != "" {
+			self += "?section=" + url.QueryEscape(section)
+			id += "/" + tagPath(section)
+			title += " — " + section
+		}
+
+		feed := atomFeed{
+			Title:   title,
+			ID:      id,
+			Updated: repo.Status().LastScan,
+			Author:  atomPerson{Name: branding.OrgName},
+			Links: []atomLink{
+				{Href: self, Rel: "self", Type: "application/atom+xml"},
+				{Href: site + "/", Rel: "alternate", Type: "text/html"},
+			},
+		}
+		for _, c := range changes {
+			if len(feed.Entries) == feedEntries {
+				break
+			}
+			if section != "" && c.SectionPath() != section && !isSubsection(c.SectionPath(), section) {
+				continue
+			}
+			feed.Entries = append(feed.Entries, newFeedEntry(c, origin, site, tag))
+		}
+		if len(feed.Entries) > 0 {
+			feed.Updated = feed.Entries[0].Updated
+		}
+		if feed.Updated.IsZero() {
+			feed.Updated = startTime
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		if _, err := w.Write([]byte(xml.Header)); err != nil {
+			return
+		}
+		if err := xml.NewEncoder(w).Encode(feed); err != nil {
+			log.Printf("Error writing feed: %v", err)
+		}
+	})
+}
+
+// newFeedEntry - запись ленты об изменении c. origin - схема и хост сайта
+// (ссылки на документы уже содержат base_path), site - адрес главной страницы,
+// tag - начало идентификатора записи (feedTagPrefix).
+func newFeedEntry(c DocChange, origin, site, tag string) atomEntry {
+	d := c.Document
+	// Пробелы и кириллицу в пути кодируем: не все читатели лент делают это сами.
+	docURL := origin + (&url.URL{Path: d.URL}).EscapedPath()
+
+	e := atomEntry{
+		Title:    feedEntryTitles[c.Kind] + ": " + d.DisplayName(),
+		Updated:  c.Time,
+		Link:     atomLink{Href: docURL, Rel: "alternate"},
+		Category: atomCategory{Term: c.SectionName()},
+	}
+	// Одна и та же редакция документа - одна запись, даже если после
+	// перезапуска она попала в ленту повторно (как changeUpdated).
+	e.ID = fmt.Sprintf("%sdocs/%s@%s", tag, tagPath(d.Path), d.ModTime.UTC().Format(time.RFC3339Nano))
+
+	summary := []string{"Раздел: " + c.SectionName()}
+	if c.Kind == changeRemoved {
+		e.ID = fmt.Sprintf("%sremoved/%s@%s", tag, tagPath(d.Path), c.Time.UTC().Format(time.RFC3339Nano))
+		e.Link.Href = site + "/"
+	} else {
+		summary = append(summary, d.Details())
+	}
+	if ref := d.Reference(); ref != "" {
+		summary = append(summary, ref)
+	}
+	e.Summary = strings.Join(summary, " · ")
+	if d.Summary != "" {
+		e.Summary += "\n" + d.Summary
+	}
+	return e
+}
+
+// tagPath кодирует путь документа или раздела для tag: URI.
+func tagPath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getFeed(t *testing.T, h http.Handler, url string, u *User) (*httptest.ResponseRecorder, atomFeed) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if u != nil {
+		req = req.WithContext(contextWithUser(req.Context(), u))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var feed atomFeed
+	if rec.Code == http.StatusOK {
+		if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("invalid feed %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, feed
+}
+
+func TestFeedHandler(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "plan.pdf", "Кадры/old.pdf")
+	repo := NewDocRepository(dir, time.Minute)
+	repo.basePath = "/normdocs"
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	writeReloadTestDocs(t, dir, "Кадры/2025/new order.pdf")
+	if err := os.Remove(filepath.Join(dir, "Кадры", "old.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without public_url the address is taken from requests passed by a trusted proxy
+	// (httptest requests come from 192.0.2.1).
+	proxies, err := parseTrustedProxies([]string{"192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := feedHandler(repo, DefaultBranding(), "", proxies)
+	rec, feed := getFeed(t, h, "http://docs.local/feed.atom", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if feed.ID != "tag:docs.local,2025:normdocs/feed" || feed.Title != DefaultBranding().SiteName {
+		t.Errorf("unexpected feed header: id %q, title %q", feed.ID, feed.Title)
+	}
+	// 2 changes on top of the 2 documents from the first scan.
+	if len(feed.Entries) != 4 {
+		t.Fatalf("expected 4 entries, got %+v", feed.Entries)
+	}
+
+	added := feed.Entries[0]
+	if added.Title != "Добавлен: new order.pdf" || added.Category.Term != "Кадры/2025" {
+		t.Errorf("unexpected entry: %+v", added)
+	}
+	if want := "http://docs.local/normdocs/docs/%D0%9A%D0%B0%D0%B4%D1%80%D1%8B/2025/new%20order.pdf"; added.Link.Href != want {
+		t.Errorf("link = %q, want %q", added.Link.Href, want)
+	}
+	if want := "tag:docs.local,2025:normdocs/docs/%D0%9A%D0%B0%D0%B4%D1%80%D1%8B/2025/new%20order.pdf@"; !strings.HasPrefix(added.ID, want) {
+		t.Errorf("id = %q, want prefix %q", added.ID, want)
+	}
+	removed := feed.Entries[1]
+	if removed.Title != "Удалён: old.pdf" || removed.Link.Href != "http://docs.local/normdocs/" {
+		t.Errorf("unexpected entry: %+v", removed)
+	}
+	if !feed.Updated.Equal(added.Updated) {
+		t.Errorf("feed updated = %s, want the newest entry %s", feed.Updated, added.Updated)
+	}
+
+	// A section feed includes its sub-sections: both changes and old.pdf from the first scan.
+	_, feed = getFeed(t, h, "http://docs.local/feed.atom?section=Кадры", nil)
+	if len(feed.Entries) != 3 || !strings.HasSuffix(feed.Title, "Кадры") || feed.ID != "tag:docs.local,2025:normdocs/feed/%D0%9A%D0%B0%D0%B4%D1%80%D1%8B" {
+		t.Errorf("unexpected section feed: %+v", feed)
+	}
+	_, feed = getFeed(t, h, "http://docs.local/feed.atom?section=Связь", nil)
+	if len(feed.Entries) != 0 {
+		t.Errorf("expected an empty feed for an unknown section, got %+v", feed.Entries)
+	}
+}
+
+func TestFeedHandler_PublicURL(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "plan.pdf")
+	repo := NewDocRepository(dir, time.Minute)
+	repo.basePath = "/normdocs"
+
+	// Links follow public_url and IDs stay the same whatever host the reader used.
+	h := feedHandler(repo, DefaultBranding(), "https://intranet", nil)
+	_, a := getFeed(t, h, "http://10.0.0.5:8080/feed.atom", nil)
+	_, b := getFeed(t, h, "http://docs.local/feed.atom", nil)
+	if len(a.Entries) != 1 || len(b.Entries) != 1 {
+		t.Fatalf("expected one entry, got %+v and %+v", a.Entries, b.Entries)
+	}
+	if a.Entries[0].ID != b.Entries[0].ID || a.ID != b.ID {
+		t.Errorf("IDs depend on the host: %q and %q", a.Entries[0].ID, b.Entries[0].ID)
+	}
+	if a.ID != "tag:intranet,2025:normdocs/feed" || !strings.HasPrefix(a.Entries[0].ID, "tag:intranet,2025:normdocs/docs/plan.pdf@") {
+		t.Errorf("IDs do not name the public host and base path: %q, %q", a.ID, a.Entries[0].ID)
+	}
+	if want := "https://intranet/normdocs/docs/plan.pdf"; a.Entries[0].Link.Href != want || b.Entries[0].Link.Href != want {
+		t.Errorf("links = %q and %q, want %q", a.Entries[0].Link.Href, b.Entries[0].Link.Href, want)
+	}
+	if a.Links[0].Href != "https://intranet/normdocs/feed.atom" {
+		t.Errorf("self link = %q", a.Links[0].Href)
+	}
+}
+
+func TestFeedHandler_UntrustedHost(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "plan.pdf")
+	repo := NewDocRepository(dir, time.Minute)
+
+	// Without public_url the Host header of a direct request is not trusted for links.
+	proxies, err := parseTrustedProxies([]string{"10.0.0.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trusted := range []trustedProxies{nil, proxies} {
+		if rec, _ := getFeed(t, feedHandler(repo, DefaultBranding(), "", trusted), "http://evil.example/feed.atom", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("trusted %v: expected 404 for a direct request, got %d", trusted, rec.Code)
+		}
+	}
+}
+
+func TestFeedHandler_RespectsAccess(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	h := feedHandler(repo, DefaultBranding(), "https://intranet", nil)
+
+	if rec, _ := getFeed(t, h, "/feed.atom?section=HR", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("anonymous section feed of HR: expected 404, got %d", rec.Code)
+	}
+
+	_, feed := getFeed(t, h, "/feed.atom", nil)
+	for _, e := range feed.Entries {
+		if e.Category.Term == "HR" || e.Category.Term == "Board" {
+			t.Errorf("closed section in anonymous feed: %+v", e)
+		}
+	}
+
+	_, feed = getFeed(t, h, "/feed.atom?section=HR", &User{Name: "ivanov", Groups: []string{"HR"}})
+	if len(feed.Entries) != 2 {
+		t.Errorf("expected HR and HR/Open documents, got %+v", feed.Entries)
+	}
+}
+
+func TestIndexTemplate_FeedLinks(t *testing.T) {
+	tmpl := testPageTemplate(t, "index.html")
+	sections := []Section{{Name: "HR", Path: "HR"}}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, indexPage{Sections: sections, FeedEnabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `href="/feed.atom"`) || !strings.Contains(b.String(), `href="/feed.atom?section=HR"`) {
+		t.Errorf("expected feed links:\n%s", b.String())
+	}
+
+	// Without public_url or trusted_proxies the feed is disabled and not advertised.
+	b.Reset()
+	if err := tmpl.Execute(&b, indexPage{Sections: sections}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "feed.atom") {
+		t.Errorf("expected no feed links when the feed is disabled:\n%s", b.String())
+	}
+}
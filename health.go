@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version - версия сборки, задаётся при сборке:
+// go build -ldflags "-X main.version=1.4.0".
+var version = ""
+
+// startTime - время запуска процесса, для uptime в /healthz и /readyz.
+var startTime = time.Now()
+
+// buildVersion возвращает версию сборки; без -ldflags - ревизию из VCS, если она известна.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+				return "dev-" + s.Value[:12]
+			}
+		}
+	}
+	return "dev"
+}
+
+// healthReport - ответ /healthz и /readyz в JSON (?format=json).
+type healthReport struct {
+	// Status - "ok" или "fail".
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	Version       string    `json:"version"`
+	StartTime     time.Time `json:"start_time"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+
+	Docs      *docsHealth      `json:"docs,omitempty"`
+	AccessLog *accessLogHealth `json:"access_log,omitempty"`
+}
+
+// docsHealth - состояние каталога документов и его сканирования.
+type docsHealth struct {
+	Dir        string `json:"dir"`
+	Accessible bool   `json:"accessible"`
+	DirError   string `json:"dir_error,omitempty"`
+
+	LastScan                *time.Time `json:"last_scan"`
+	LastScanAgeSeconds      *int64     `json:"last_scan_age_seconds"`
+	LastScanDurationSeconds float64    `json:"last_scan_duration_seconds"`
+	ScanInProgress          bool       `json:"scan_in_progress"`
+
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	// FailingSince и FailingSeconds - сколько сканирование завершается ошибкой подряд:
+	// по ним мониторинг отличает кратковременный сбой от недоступной шары.
+	FailingSince   *time.Time `json:"failing_since,omitempty"`
+	FailingSeconds int64      `json:"failing_seconds,omitempty"`
+
+	Sections  int `json:"sections"`
+	Documents int `json:"documents"`
+}
+
+// accessLogHealth - состояние access-лога.
+type accessLogHealth struct {
+	File         string     `json:"file"`
+	SizeBytes    int64      `json:"size_bytes"`
+	LastRotation *time.Time `json:"last_rotation,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	ErrorTime    *time.Time `json:"error_time,omitempty"`
+}
+
+func newHealthReport(now time.Time) healthReport {
+	return healthReport{
+		Status:        "ok",
+		Version:       buildVersion(),
+		StartTime:     startTime,
+		UptimeSeconds: int64(now.Sub(startTime).Seconds()),
+	}
+}
+
+// wantsJSON сообщает, что клиент просит подробный ответ в JSON.
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeHealth отдаёт отчёт: в JSON или, для простых проверок, текстом ("ok" или ошибка).
+func writeHealth(w http.ResponseWriter, r *http.Request, rep healthReport) {
+	status := http.StatusOK
+	if rep.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		writeJSON(w, status, rep)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	if rep.Error != "" {
+		_, _ = w.Write([]byte(rep.Error))
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
+
+// healthHandler - проверка живости (/healthz): процесс работает и отвечает на
+// запросы. От каталога документов не зависит, чтобы недоступная шара не
+// приводила к перезапуску службы.
+func healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, r, newHealthReport(time.Now()))
+	})
+}
+
+// readyHandler - проверка готовности (/readyz): каталог документов доступен и
+// последнее сканирование успешно. Пока идёт первое сканирование, сервер тоже
+// не готов. Ошибки access-лога попадают в отчёт, но на готовность не влияют:
+// документы при этом отдаются.
+func readyHandler(docsDir string, repo *DocRepository, logWriter *rotatingWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		rep := newHealthReport(now)
+		st := repo.Status()
+
+		docs := &docsHealth{
+			Dir:                     docsDir,
+			Accessible:              true,
+			LastScan:                timeOrNil(st.LastScan),
+			LastScanDurationSeconds: st.LastDuration.Seconds(),
+			ScanInProgress:          st.InProgress,
+			Sections:                st.Sections,
+			Documents:               st.Documents,
+		}
+		if !st.LastScan.IsZero() {
+			age := int64(now.Sub(st.LastScan).Seconds())
+			docs.LastScanAgeSeconds = &age
+		}
+		rep.Docs = docs
+
+		if _, err := os.Stat(docsDir); err != nil {
+			docs.Accessible, docs.DirError = false, err.Error()
+			rep.Status, rep.Error = "fail", "docs directory is not accessible"
+		}
+		// Пользователи при этом продолжают получать последнее удачное дерево,
+		// но мониторинг должен узнать, что оно устаревает.
+		if st.LastError != nil {
+			docs.LastError = st.LastError.Error()
+			docs.LastErrorTime = timeOrNil(st.LastErrorTime)
+			docs.FailingSince = timeOrNil(st.FailingSince)
+			docs.FailingSeconds = int64(now.Sub(st.FailingSince).Seconds())
+			if rep.Error == "" {
+				rep.Status, rep.Error = "fail", fmt.Sprintf("last docs scan failed at %s: %v",
+					st.LastErrorTime.Format(time.RFC3339), st.LastError)
+			}
+		}
+		// Без отслеживания (watch: off) дерево сканируется при первом запросе,
+		// а до готовности запросов нет - поэтому первое сканирование запускает проверка.
+		if st.LastScan.IsZero() {
+			repo.startFirstScan()
+			if rep.Error == "" {
+				rep.Status, rep.Error = "fail", "initial docs scan has not finished"
+			}
+		}
+
+		if logWriter != nil {
+			ls := logWriter.Status()
+			rep.AccessLog = &accessLogHealth{
+				File:         ls.Filename,
+				SizeBytes:    ls.Size,
+				LastRotation: timeOrNil(ls.LastRotation),
+			}
+			if ls.LastError != nil {
+				rep.AccessLog.Error = ls.LastError.Error()
+				rep.AccessLog.ErrorTime = timeOrNil(ls.LastErrorTime)
+			}
+		}
+
+		writeHealth(w, r, rep)
+	})
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -1,19 +1,21 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHealthHandler_OK(t *testing.T) {
-	dir := t.TempDir()
-
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	rec := httptest.NewRecorder()
 
-	h := healthHandler(dir)
+	h := healthHandler()
 	h.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusOK {
@@ -24,17 +26,155 @@ func TestHealthHandler_OK(t *testing.T) {
 	}
 }
 
-func TestHealthHandler_MissingDir(t *testing.T) {
+func TestHealthHandler_JSON(t *testing.T) {
+	old := version
+	version = "1.4.0"
+	defer func() { version = old }()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz?format=json", nil)
+	rec := httptest.NewRecorder()
+	healthHandler().ServeHTTP(rec, req)
+
+	var rep healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if rep.Status != "ok" || rep.Version != "1.4.0" || rep.StartTime.IsZero() {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+	// Liveness does not depend on the docs directory.
+	if rep.Docs != nil {
+		t.Errorf("expected no docs details in liveness, got %+v", rep.Docs)
+	}
+}
+
+func TestReadyHandler_OK(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "HR"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "HR", "plan.pdf"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewDocRepository(dir, time.Minute)
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	logWriter, err := newRotatingWriter(filepath.Join(dir, "access.log"), maxLogSizeBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logWriter.Close()
+	logWriter.Write([]byte("line\n"))
+
+	h := readyHandler(dir, repo, logWriter)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("expected 200 ok, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var rep healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if rep.Docs == nil || !rep.Docs.Accessible || rep.Docs.LastScan == nil || rep.Docs.LastScanAgeSeconds == nil {
+		t.Fatalf("unexpected docs details: %s", rec.Body.String())
+	}
+	if rep.Docs.Sections != 1 || rep.Docs.Documents != 1 {
+		t.Errorf("expected 1 section and 1 document, got %d and %d", rep.Docs.Sections, rep.Docs.Documents)
+	}
+	if rep.AccessLog == nil || rep.AccessLog.SizeBytes != 5 || rep.AccessLog.Error != "" {
+		t.Errorf("unexpected access log details: %+v", rep.AccessLog)
+	}
+}
+
+func TestReadyHandler_NotReadyBeforeFirstScan(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, dir, "HR/plan.pdf")
+	// With watch: off nothing scans the tree until a request needs it.
+	repo := NewDocRepository(dir, time.Minute)
+	h := readyHandler(dir, repo, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "initial docs scan") {
+		t.Fatalf("expected 503 before the first scan, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// The probe itself starts the scan, so the server becomes ready without traffic.
+	deadline := time.Now().Add(5 * time.Second)
+	for repo.Status().LastScan.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("the probe did not start the first scan")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after the first scan, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReadyHandler_MissingDir(t *testing.T) {
 	base := t.TempDir()
 	missing := filepath.Join(base, "does-not-exist")
 
-	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	rec := httptest.NewRecorder()
 
-	h := healthHandler(missing)
+	h := readyHandler(missing, NewDocRepository(missing, time.Minute), nil)
 	h.ServeHTTP(rec, req)
 
-	if rec.Code != http.StatusInternalServerError {
-		t.Fatalf("expected status 500, got %d", rec.Code)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rec.Code)
+	}
+}
+
+func TestReadyHandler_ReportsScanError(t *testing.T) {
+	dir := t.TempDir()
+
+	// Repository points to a missing directory, so its scan fails
+	// while the directory checked by os.Stat is fine.
+	repo := NewDocRepository(filepath.Join(dir, "missing"), time.Minute)
+	if _, err := repo.GetSections(); err == nil {
+		t.Fatal("expected scan error")
+	}
+	first := repo.Status().FailingSince
+	if err := repo.Refresh(); err == nil {
+		t.Fatal("expected scan error")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+
+	readyHandler(dir, repo, nil).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "last docs scan failed") {
+		t.Fatalf("expected scan error in body, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	readyHandler(dir, repo, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz?format=json", nil))
+	var rep healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if rep.Status != "fail" || rep.Docs.LastError == "" || rep.Docs.FailingSince == nil || rep.Docs.LastScan != nil {
+		t.Errorf("unexpected report: %s", rec.Body.String())
+	}
+	// Consecutive failures keep the time of the first one.
+	if !rep.Docs.FailingSince.Equal(first) {
+		t.Errorf("failing_since = %s, want %s", rep.Docs.FailingSince, first)
 	}
 }
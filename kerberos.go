@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Заголовки и схема HTTP-аутентификации Negotiate (SPNEGO, RFC 4559).
+const (
+	negotiateScheme     = "Negotiate"
+	authorizationHeader = "Authorization"
+	authenticateHeader  = "WWW-Authenticate"
+)
+
+// KerberosConfig - вход без пароля (Integrated Windows Authentication):
+// браузер на компьютере в домене присылает билет Kerberos для службы HTTP/<имя сервера>.
+type KerberosConfig struct {
+	// Keytab - файл с ключом учётной записи службы (ktpass /out ...).
+	Keytab string
+	// ServicePrincipal - SPN службы ("HTTP/docs.example.local"), если в keytab их несколько.
+	// Пусто - подходит любой ключ из keytab.
+	ServicePrincipal string
+	// Realm - область, пользователям которой разрешён вход ("EXAMPLE.LOCAL").
+	// Пусто - область службы из keytab. Логин не содержит области, поэтому
+	// ivanov@OTHER.REALM из доверенного домена иначе вошёл бы как ivanov.
+	Realm string
+	// MaxClockSkew - допустимое расхождение часов клиента и сервера.
+	MaxClockSkew time.Duration
+}
+
+// yamlKerberosConfig mirrors auth.kerberos in config.yaml.
+type yamlKerberosConfig struct {
+	Keytab           string `yaml:"keytab"`
+	ServicePrincipal string `yaml:"service_principal"`
+	Realm            string `yaml:"realm"`
+	MaxClockSkew     string `yaml:"max_clock_skew"`
+}
+
+func parseKerberosConfig(y yamlKerberosConfig) (KerberosConfig, error) {
+	cfg := KerberosConfig{
+		Keytab:           y.Keytab,
+		ServicePrincipal: y.ServicePrincipal,
+		Realm:            y.Realm,
+		MaxClockSkew:     5 * time.Minute,
+	}
+	if y.MaxClockSkew != "" {
+		d, err := parseDurationField("auth.kerberos.max_clock_skew", y.MaxClockSkew)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.MaxClockSkew = d
+	}
+	if cfg.Keytab == "" {
+		return cfg, fmt.Errorf("auth.kerberos: keytab is required")
+	}
+	return cfg, nil
+}
+
+// kerberosAuthenticator проверяет билеты Kerberos из заголовка "Authorization: Negotiate ...".
+type kerberosAuthenticator struct {
+	settings *service.Settings
+	realm    string
+}
+
+// newKerberosAuthenticator читает keytab; ошибка здесь - ошибка конфигурации.
+func newKerberosAuthenticator(cfg KerberosConfig) (*kerberosAuthenticator, error) {
+	kt, err := keytab.Load(cfg.Keytab)
+	if err != nil {
+		return nil, fmt.Errorf("load kerberos keytab %q: %w", cfg.Keytab, err)
+	}
+
+	realm := cfg.Realm
+	if realm == "" {
+		if realm = keytabRealm(kt, cfg.ServicePrincipal); realm == "" {
+			return nil, fmt.Errorf("kerberos keytab %q has no key for %q; set auth.kerberos.realm", cfg.Keytab, cfg.ServicePrincipal)
+		}
+	}
+
+	opts := []func(*service.Settings){service.MaxClockSkew(cfg.MaxClockSkew)}
+	if cfg.ServicePrincipal != "" {
+		opts = append(opts, service.KeytabPrincipal(cfg.ServicePrincipal))
+	}
+	return &kerberosAuthenticator{settings: service.NewSettings(kt, opts...), realm: realm}, nil
+}
+
+// keytabRealm возвращает область ключа службы spn из keytab (пустой spn - первого ключа).
+func keytabRealm(kt *keytab.Keytab, spn string) string {
+	for _, e := range kt.Entries {
+		if spn == "" || strings.EqualFold(strings.Join(e.Principal.Components, "/"), spn) {
+			return e.Principal.Realm
+		}
+	}
+	return ""
+}
+
+// negotiateToken возвращает токен из заголовка Authorization, если клиент прислал Negotiate.
+func negotiateToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(authorizationHeader), " ")
+	if !ok || !strings.EqualFold(scheme, negotiateScheme) {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Authenticate проверяет токен SPNEGO (или "голый" токен Kerberos) и возвращает
+// пользователя: логин - имя принципала без области в нижнем регистре
+// ("Ivanov@EXAMPLE.LOCAL" -> "ivanov"), как и при входе по паролю через LDAP.
+// Принципалы других областей (доверенных доменов) не принимаются.
+func (k *kerberosAuthenticator) Authenticate(token string) (*User, error) {
+	b, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decode negotiate token: %w", err)
+	}
+
+	var mech spnego.KRB5Token
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(b); err == nil {
+		if !st.Init {
+			return nil, fmt.Errorf("unexpected SPNEGO response token")
+		}
+		// Сюда же попадает NTLM, который Windows присылает, если билет Kerberos получить не удалось.
+		if err := mech.Unmarshal(st.NegTokenInit.MechTokenBytes); err != nil {
+			return nil, fmt.Errorf("SPNEGO token does not contain a Kerberos ticket: %w", err)
+		}
+	} else if err := mech.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("unmarshal negotiate token: %w", err)
+	}
+	if !mech.IsAPReq() {
+		return nil, fmt.Errorf("negotiate token is not a Kerberos AP-REQ")
+	}
+
+	ok, creds, err := service.VerifyAPREQ(&mech.APReq, k.settings)
+	if err != nil {
+		return nil, fmt.Errorf("verify kerberos ticket: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("kerberos ticket is not valid")
+	}
+
+	if !strings.EqualFold(creds.Domain(), k.realm) {
+		return nil, fmt.Errorf("kerberos principal %s@%s is outside realm %s", creds.UserName(), creds.Domain(), k.realm)
+	}
+	name, _, _ := strings.Cut(creds.UserName(), "@")
+	u := &User{Name: strings.ToLower(name)}
+	// В билетах Active Directory есть PAC с ФИО пользователя.
+	if ad := creds.GetADCredentials(); ad.FullName != "" {
+		u.DisplayName = ad.FullName
+	}
+	return u, nil
+}
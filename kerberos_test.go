@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	testRealm = "EXAMPLE.LOCAL"
+	testSPN   = "HTTP/docs.example.local"
+)
+
+// writeTestKeytab generates a keytab for the HTTP service principal, like ktpass would.
+func writeTestKeytab(t *testing.T, password string) (string, *keytab.Keytab) {
+	t.Helper()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, password, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "http.keytab")
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, kt
+}
+
+// negotiateHeader plays the KDC and the browser: it issues a service ticket for
+// user encrypted with the service key from kt and wraps it into a SPNEGO token.
+func negotiateHeader(t *testing.T, kt *keytab.Keytab, user string) string {
+	t.Helper()
+	return negotiateHeaderFromRealm(t, kt, user, testRealm)
+}
+
+// negotiateHeaderFromRealm is negotiateHeader for a user of another realm
+// (a trusted domain): the ticket is still for the service in testRealm.
+func negotiateHeaderFromRealm(t *testing.T, kt *keytab.Keytab, user, realm string) string {
+	t.Helper()
+	cname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{user}}
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: strings.Split(testSPN, "/")}
+
+	now := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cname, realm, sname, testRealm, types.NewKrbFlags(), kt,
+		etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("issue ticket: %v", err)
+	}
+
+	cl := client.NewWithPassword(user, realm, "unused", config.New())
+	init, err := spnego.NewNegTokenInitKRB5(cl, tkt, sessionKey)
+	if err != nil {
+		t.Fatalf("build SPNEGO token: %v", err)
+	}
+	st := spnego.SPNEGOToken{Init: true, NegTokenInit: init}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return negotiateScheme + " " + base64.StdEncoding.EncodeToString(b)
+}
+
+// fakeDirectory returns fixed groups for any user.
+type fakeDirectory struct{ groups []string }
+
+func (f fakeDirectory) Lookup(_ context.Context, username string) (*User, error) {
+	return &User{Name: username, DisplayName: "Иванов И.И.", Groups: f.groups}, nil
+}
+
+func TestKerberosAuthenticator_ValidTicket(t *testing.T) {
+	path, kt := writeTestKeytab(t, "service-password")
+	k, err := newKerberosAuthenticator(KerberosConfig{Keytab: path, ServicePrincipal: testSPN, MaxClockSkew: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("newKerberosAuthenticator failed: %v", err)
+	}
+
+	header := negotiateHeader(t, kt, "Ivanov")
+	u, err := k.Authenticate(strings.TrimPrefix(header, negotiateScheme+" "))
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if u.Name != "ivanov" {
+		t.Errorf("expected principal to be mapped to login ivanov, got %+v", u)
+	}
+
+	// A ticket encrypted with another key (e.g. after the keytab was regenerated) is rejected.
+	_, otherKT := writeTestKeytab(t, "another-password")
+	header = negotiateHeader(t, otherKT, "ivanov")
+	if _, err := k.Authenticate(strings.TrimPrefix(header, negotiateScheme+" ")); err == nil {
+		t.Errorf("expected error for ticket encrypted with a different key")
+	}
+
+	// A user of a trusted domain would otherwise log in as the local ivanov.
+	header = negotiateHeaderFromRealm(t, kt, "ivanov", "OTHER.REALM")
+	if _, err := k.Authenticate(strings.TrimPrefix(header, negotiateScheme+" ")); err == nil {
+		t.Errorf("expected error for a principal of another realm")
+	}
+	k, err = newKerberosAuthenticator(KerberosConfig{Keytab: path, Realm: "OTHER.REALM", MaxClockSkew: 5 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = negotiateHeaderFromRealm(t, kt, "ivanov", "OTHER.REALM")
+	if u, err := k.Authenticate(strings.TrimPrefix(header, negotiateScheme+" ")); err != nil || u.Name != "ivanov" {
+		t.Errorf("expected the configured realm to be accepted, got %+v, %v", u, err)
+	}
+
+	// NTLM tokens sent by machines outside the domain are not accepted.
+	ntlm := base64.StdEncoding.EncodeToString([]byte("NTLMSSP\x00\x01\x00\x00\x00"))
+	if _, err := k.Authenticate(ntlm); err == nil {
+		t.Errorf("expected error for NTLM token")
+	}
+}
+
+func TestAuthenticator_KerberosLoginFlow(t *testing.T) {
+	path, kt := writeTestKeytab(t, "service-password")
+	k, err := newKerberosAuthenticator(KerberosConfig{Keytab: path, MaxClockSkew: 5 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &authenticator{
+		mode:      authModeRequired,
+		sessions:  newSessionStore(time.Hour),
+		kerberos:  k,
+		directory: fakeDirectory{groups: []string{"HR"}},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", a.loginHandler(testPageTemplate(t, "login.html")))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		u := userFromRequest(r)
+		w.Write([]byte("hello " + u.Name + " " + strings.Join(u.Groups, ",")))
+	})
+	h := a.Middleware(mux)
+
+	// The login page asks the browser for a Kerberos ticket; without password
+	// authentication there is no form.
+	rec := doRequest(h, http.MethodGet, "/login?next=%2FHR", nil)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(authenticateHeader) != negotiateScheme {
+		t.Fatalf("expected Negotiate challenge, got %d %q", rec.Code, rec.Header().Get(authenticateHeader))
+	}
+	if strings.Contains(rec.Body.String(), `name="password"`) {
+		t.Errorf("expected no password form without LDAP")
+	}
+
+	// The browser retries with a ticket and gets a session.
+	req := httptest.NewRequest(http.MethodGet, "/login?next=%2FHR", nil)
+	req.Header.Set(authorizationHeader, negotiateHeader(t, kt, "ivanov"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/HR" {
+		t.Fatalf("expected redirect after Kerberos login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName {
+		t.Fatalf("expected session cookie, got %+v", cookies)
+	}
+	if rec := doRequest(h, http.MethodGet, "/", nil, cookies[0]); rec.Body.String() != "hello ivanov HR" {
+		t.Fatalf("expected user with directory groups, got %q", rec.Body.String())
+	}
+
+	// An invalid ticket is not retried: the page is shown without another challenge.
+	req = httptest.NewRequest(http.MethodGet, "/login", nil)
+	req.Header.Set(authorizationHeader, negotiateScheme+" bm90IGEgdG9rZW4=")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get(authenticateHeader) != "" {
+		t.Fatalf("expected login page without challenge, got %d %q", rec.Code, rec.Header().Get(authenticateHeader))
+	}
+
+	// API clients are told that Negotiate is supported.
+	rec = doRequest(h, http.MethodGet, "/api/v1/sections", nil)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(authenticateHeader) != negotiateScheme {
+		t.Fatalf("expected 401 with Negotiate for API, got %d %q", rec.Code, rec.Header().Get(authenticateHeader))
+	}
+}
+
+func TestLoadConfig_Kerberos(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := []byte(`
+auth:
+  mode: required
+  kerberos:
+    keytab: "http.keytab"
+    service_principal: "HTTP/docs.example.local"
+`)
+	if err := os.WriteFile(cfgPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Auth.Kerberos == nil || cfg.Auth.Kerberos.Keytab != "http.keytab" || cfg.Auth.Kerberos.MaxClockSkew != 5*time.Minute {
+		t.Fatalf("unexpected kerberos config: %+v", cfg.Auth.Kerberos)
+	}
+
+	if _, err := newAuthenticator(cfg.Auth); err == nil {
+		t.Errorf("expected error for missing keytab file")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig - проверка паролей через LDAP / Active Directory.
+type LDAPConfig struct {
+	// URL сервера: ldap://dc.example.local:389 или ldaps://dc.example.local:636.
+	URL string
+	// BindDN/BindPassword - служебная учётная запись для поиска пользователей.
+	// Если BindDN пуст, поиск выполняется от имени самого пользователя,
+	// который входит как UserBind (например "%s@example.local").
+	BindDN       string
+	BindPassword string
+	UserBind     string
+	// BaseDN - где искать пользователей и группы.
+	BaseDN string
+	// UserFilter - фильтр поиска пользователя, %s - логин.
+	UserFilter string
+	// GroupFilter - фильтр поиска групп пользователя, %s - DN пользователя.
+	// Если пуст, группы берутся из атрибута memberOf (Active Directory).
+	GroupFilter string
+	// DisplayNameAttribute - атрибут с ФИО пользователя.
+	DisplayNameAttribute string
+
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// CAFile - сертификат УЦ для проверки сертификата сервера LDAP (PEM).
+	CAFile  string
+	Timeout time.Duration
+}
+
+// yamlLDAPConfig mirrors auth.ldap in config.yaml.
+type yamlLDAPConfig struct {
+	URL                  string `yaml:"url"`
+	BindDN               string `yaml:"bind_dn"`
+	BindPassword         string `yaml:"bind_password"`
+	UserBind             string `yaml:"user_bind"`
+	BaseDN               string `yaml:"base_dn"`
+	UserFilter           string `yaml:"user_filter"`
+	GroupFilter          string `yaml:"group_filter"`
+	DisplayNameAttribute string `yaml:"display_name_attribute"`
+	StartTLS             bool   `yaml:"start_tls"`
+	InsecureSkipVerify   bool   `yaml:"insecure_skip_verify"`
+	CAFile               string `yaml:"ca_file"`
+	Timeout              string `yaml:"timeout"`
+}
+
+func parseLDAPConfig(y yamlLDAPConfig) (LDAPConfig, error) {
+	cfg := LDAPConfig{
+		URL:                  y.URL,
+		BindDN:               y.BindDN,
+		BindPassword:         y.BindPassword,
+		UserBind:             y.UserBind,
+		BaseDN:               y.BaseDN,
+		UserFilter:           y.UserFilter,
+		GroupFilter:          y.GroupFilter,
+		DisplayNameAttribute: y.DisplayNameAttribute,
+		StartTLS:             y.StartTLS,
+		InsecureSkipVerify:   y.InsecureSkipVerify,
+		CAFile:               y.CAFile,
+		Timeout:              10 * time.Second,
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(sAMAccountName=%s)"
+	}
+	if cfg.DisplayNameAttribute == "" {
+		cfg.DisplayNameAttribute = "displayName"
+	}
+	if y.Timeout != "" {
+		d, err := parseDurationField("auth.ldap.timeout", y.Timeout)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Timeout = d
+	}
+
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return cfg, fmt.Errorf("auth.ldap: url and base_dn are required")
+	}
+	if cfg.BindDN == "" && cfg.UserBind == "" {
+		return cfg, fmt.Errorf("auth.ldap: either bind_dn or user_bind is required")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return cfg, fmt.Errorf("auth.ldap: user_filter must contain %%s: %q", cfg.UserFilter)
+	}
+	return cfg, nil
+}
+
+type ldapAuthenticator struct {
+	cfg LDAPConfig
+}
+
+func newLDAPAuthenticator(cfg LDAPConfig) *ldapAuthenticator {
+	return &ldapAuthenticator{cfg: cfg}
+}
+
+// Authenticate проверяет пароль bind'ом от имени пользователя и читает его группы.
+func (l *ldapAuthenticator) Authenticate(_ context.Context, username, password string) (*User, error) {
+	// Пустой пароль LDAP трактует как анонимный bind, который "успешен" для любого DN.
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" || password == "" {
+		return nil, errInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Подключаемся служебной учёткой, а если её нет - сразу пользователем.
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind as %q: %w", l.cfg.BindDN, err)
+		}
+	} else {
+		if err := conn.Bind(l.userBindName(username), password); err != nil {
+			return nil, bindError(err)
+		}
+	}
+
+	entry, err := l.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(entry.DN, password); err != nil {
+			return nil, bindError(err)
+		}
+		// Группы ищем снова от имени служебной учётки: у пользователя может не быть прав.
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind as %q: %w", l.cfg.BindDN, err)
+		}
+	}
+
+	return l.user(conn, username, entry)
+}
+
+// userBindName подставляет логин в user_bind. Шаблон DN ("uid=%s,ou=people,...")
+// получает логин с экранированием: иначе "petrov,ou=admins" подменил бы DN.
+func (l *ldapAuthenticator) userBindName(username string) string {
+	if strings.Contains(l.cfg.UserBind, "=") {
+		username = ldap.EscapeDN(username)
+	}
+	return fmt.Sprintf(l.cfg.UserBind, username)
+}
+
+// Lookup находит пользователя по логину без проверки пароля - для входа через Kerberos,
+// когда пароль уже проверил контроллер домена. Нужна служебная учётная запись (bind_dn).
+func (l *ldapAuthenticator) Lookup(_ context.Context, username string) (*User, error) {
+	if l.cfg.BindDN == "" {
+		return nil, fmt.Errorf("ldap lookup of %q requires bind_dn", username)
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("ldap service bind as %q: %w", l.cfg.BindDN, err)
+	}
+	entry, err := l.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	return l.user(conn, username, entry)
+}
+
+// user собирает пользователя из найденной записи каталога.
+func (l *ldapAuthenticator) user(conn *ldap.Conn, username string, entry *ldap.Entry) (*User, error) {
+	groups, err := l.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{
+		Name:        username,
+		DisplayName: entry.GetAttributeValue(l.cfg.DisplayNameAttribute),
+		Groups:      groups,
+	}, nil
+}
+
+func (l *ldapAuthenticator) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: l.cfg.InsecureSkipVerify}
+	if l.cfg.CAFile != "" {
+		pem, err := os.ReadFile(l.cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ldap ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ldap ca_file %q", l.cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	conn, err := ldap.DialURL(l.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("connect to ldap %s: %w", l.cfg.URL, err)
+	}
+	conn.SetTimeout(l.cfg.Timeout)
+
+	if l.cfg.StartTLS {
+		if u, err := url.Parse(l.cfg.URL); err == nil {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindError отличает неверный пароль от недоступности сервера.
+func bindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return errInvalidCredentials
+	}
+	return fmt.Errorf("ldap bind: %w", err)
+}
+
+func (l *ldapAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(
+		l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(l.cfg.Timeout/time.Second), false,
+		fmt.Sprintf(l.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{l.cfg.DisplayNameAttribute, "memberOf"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("ldap user filter matches more than one entry for %q", username)
+		}
+		return nil, fmt.Errorf("ldap search for %q: %w", username, err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, errInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// groups возвращает имена (CN) групп пользователя.
+func (l *ldapAuthenticator) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	dns := entry.GetAttributeValues("memberOf")
+
+	if l.cfg.GroupFilter != "" {
+		req := ldap.NewSearchRequest(
+			l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, int(l.cfg.Timeout/time.Second), false,
+			fmt.Sprintf(l.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"cn"},
+			nil,
+		)
+		res, err := conn.Search(req)
+		if err != nil {
+			return nil, fmt.Errorf("ldap group search for %q: %w", entry.DN, err)
+		}
+		for _, g := range res.Entries {
+			dns = append(dns, g.DN)
+		}
+	}
+
+	var groups []string
+	seen := make(map[string]bool)
+	for _, dn := range dns {
+		name := groupName(dn)
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// groupName возвращает CN группы из её DN ("CN=HR,OU=Groups,DC=example,DC=local" -> "HR").
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
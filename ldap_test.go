@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// testLDAPEntry is a directory entry of the in-process LDAP stand-in.
+type testLDAPEntry struct {
+	dn       string
+	password string
+	// aliases are other bind names of the entry (e.g. UPN "user@example.local").
+	aliases []string
+	attrs   map[string][]string
+}
+
+// testLDAPServer is a minimal LDAP server: simple bind, search with a single
+// equality filter, unbind. Searches require a successful bind.
+type testLDAPServer struct {
+	url     string
+	entries []testLDAPEntry
+}
+
+func startTestLDAPServer(t *testing.T, entries []testLDAPEntry) *testLDAPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testLDAPServer{url: "ldap://" + ln.Addr().String(), entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testLDAPServer) lookup(name string) *testLDAPEntry {
+	for i, e := range s.entries {
+		if strings.EqualFold(e.dn, name) {
+			return &s.entries[i]
+		}
+		for _, a := range e.aliases {
+			if strings.EqualFold(a, name) {
+				return &s.entries[i]
+			}
+		}
+	}
+	return nil
+}
+
+var testLDAPFilterRe = regexp.MustCompile(`^\(([A-Za-z]+)=(.*)\)$`)
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if e := s.lookup(name); e != nil && password != "" && e.password == password {
+				bound = true
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, testLDAPResult(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				s.write(conn, id, testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			m := testLDAPFilterRe.FindStringSubmatch(filter)
+			if err != nil || m == nil {
+				s.write(conn, id, testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform))
+				continue
+			}
+			for _, e := range s.entries {
+				for name, values := range e.attrs {
+					if !strings.EqualFold(name, m[1]) {
+						continue
+					}
+					for _, v := range values {
+						if strings.EqualFold(v, m[2]) {
+							s.write(conn, id, testLDAPSearchEntry(e))
+						}
+					}
+				}
+			}
+			s.write(conn, id, testLDAPResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) write(conn net.Conn, id int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	envelope.AppendChild(op)
+	_, _ = conn.Write(envelope.Bytes())
+}
+
+func testLDAPResult(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return op
+}
+
+func testLDAPSearchEntry(e testLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func TestLDAPAuthenticator_ServiceAccountAndMemberOf(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{
+		{dn: "CN=svc-docsrv,OU=Service,DC=example,DC=local", password: "svc-secret"},
+		{
+			dn:       "CN=Ivanov Ivan,OU=Users,DC=example,DC=local",
+			password: "secret",
+			attrs: map[string][]string{
+				"sAMAccountName": {"ivanov"},
+				"displayName":    {"Иванов Иван Иванович"},
+				"memberOf": {
+					"CN=HR,OU=Groups,DC=example,DC=local",
+					"CN=Staff,OU=Groups,DC=example,DC=local",
+				},
+			},
+		},
+	})
+
+	auth := newLDAPAuthenticator(LDAPConfig{
+		URL:                  srv.url,
+		BindDN:               "CN=svc-docsrv,OU=Service,DC=example,DC=local",
+		BindPassword:         "svc-secret",
+		BaseDN:               "DC=example,DC=local",
+		UserFilter:           "(sAMAccountName=%s)",
+		DisplayNameAttribute: "displayName",
+		Timeout:              5 * time.Second,
+	})
+
+	u, err := auth.Authenticate(t.Context(), " Ivanov ", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if u.Name != "ivanov" || u.DisplayName != "Иванов Иван Иванович" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if len(u.Groups) != 2 || !u.InGroup("hr") || !u.InGroup("Staff") {
+		t.Errorf("unexpected groups: %v", u.Groups)
+	}
+
+	for _, c := range []struct{ user, password string }{
+		{"ivanov", "wrong"},
+		{"nobody", "secret"},
+		// An empty password would be an anonymous bind.
+		{"ivanov", ""},
+	} {
+		if _, err := auth.Authenticate(t.Context(), c.user, c.password); !errors.Is(err, errInvalidCredentials) {
+			t.Errorf("%s/%q: expected errInvalidCredentials, got %v", c.user, c.password, err)
+		}
+	}
+}
+
+func TestLDAPAuthenticator_UserBindAndGroupSearch(t *testing.T) {
+	userDN := "uid=petrov,ou=people,dc=example,dc=local"
+	srv := startTestLDAPServer(t, []testLDAPEntry{
+		{
+			dn:       userDN,
+			password: "pass",
+			aliases:  []string{"petrov@example.local"},
+			attrs:    map[string][]string{"uid": {"petrov"}, "cn": {"Petrov"}},
+		},
+		{dn: "cn=IT,ou=groups,dc=example,dc=local", attrs: map[string][]string{"cn": {"IT"}, "member": {userDN}}},
+		{dn: "cn=Other,ou=groups,dc=example,dc=local", attrs: map[string][]string{"cn": {"Other"}, "member": {"uid=x,dc=example,dc=local"}}},
+	})
+
+	auth := newLDAPAuthenticator(LDAPConfig{
+		URL:                  srv.url,
+		UserBind:             "%s@example.local",
+		BaseDN:               "dc=example,dc=local",
+		UserFilter:           "(uid=%s)",
+		GroupFilter:          "(member=%s)",
+		DisplayNameAttribute: "cn",
+		Timeout:              5 * time.Second,
+	})
+
+	u, err := auth.Authenticate(t.Context(), "petrov", "pass")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if u.DisplayName != "Petrov" || len(u.Groups) != 1 || u.Groups[0] != "IT" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+
+	if _, err := auth.Authenticate(t.Context(), "petrov", "wrong"); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("expected errInvalidCredentials, got %v", err)
+	}
+}
+
+func TestLDAPAuthenticator_UserBindDNIsEscaped(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{
+		{
+			dn:       "uid=petrov,ou=people,dc=example,dc=local",
+			password: "pass",
+			attrs:    map[string][]string{"uid": {"petrov"}, "cn": {"Petrov"}},
+		},
+		{
+			dn:       "uid=admin,ou=service,ou=people,dc=example,dc=local",
+			password: "secret",
+			attrs:    map[string][]string{"uid": {"admin,ou=service"}},
+		},
+	})
+
+	auth := newLDAPAuthenticator(LDAPConfig{
+		URL:                  srv.url,
+		UserBind:             "uid=%s,ou=people,dc=example,dc=local",
+		BaseDN:               "dc=example,dc=local",
+		UserFilter:           "(uid=%s)",
+		DisplayNameAttribute: "cn",
+		Timeout:              5 * time.Second,
+	})
+
+	if u, err := auth.Authenticate(t.Context(), "petrov", "pass"); err != nil || u.Name != "petrov" {
+		t.Fatalf("expected petrov to log in, got %+v, %v", u, err)
+	}
+	// Without escaping the login would bind as another entry of the directory.
+	if _, err := auth.Authenticate(t.Context(), "admin,ou=service", "secret"); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("expected errInvalidCredentials for a DN in the login, got %v", err)
+	}
+	if _, err := auth.Authenticate(t.Context(), "petrov", ""); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("expected errInvalidCredentials for an empty password, got %v", err)
+	}
+}
+
+func TestLDAPAuthenticator_ServerUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	auth := newLDAPAuthenticator(LDAPConfig{URL: "ldap://" + addr, UserBind: "%s", BaseDN: "dc=x", UserFilter: "(uid=%s)", Timeout: time.Second})
+	_, err = auth.Authenticate(t.Context(), "user", "pass")
+	if err == nil || errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("expected connection error, got %v", err)
+	}
+}
@@ -17,6 +17,21 @@ type rotatingWriter struct {
 	file     *os.File
 	size     int64
 	mu       sync.Mutex
+
+	// Состояние для /readyz.
+	lastRotation  time.Time
+	lastError     error
+	lastErrorTime time.Time
+}
+
+// rotatingWriterStatus - состояние журнала: текущий файл, его размер и последняя ошибка записи.
+type rotatingWriterStatus struct {
+	Filename     string
+	Size         int64
+	LastRotation time.Time
+	// LastError - ошибка последней записи, открытия или ротации; nil, если запись идёт нормально.
+	LastError     error
+	LastErrorTime time.Time
 }
 
 func newRotatingWriter(filename string, maxSize int64) (*rotatingWriter, error) {
@@ -67,6 +82,8 @@ func (rw *rotatingWriter) rotate() error {
 		}
 		return fmt.Errorf("failed to rename log file: %w", err)
 	}
+	metrics.logRotations.add(1, filepath.Base(rw.filename))
+	rw.lastRotation = time.Now()
 
 	return rw.open()
 }
@@ -77,16 +94,19 @@ func (rw *rotatingWriter) Write(p []byte) (int, error) {
 
 	if rw.file == nil {
 		if err := rw.open(); err != nil {
+			rw.setError(err)
 			return 0, err
 		}
 	}
 
+	var rotateErr error
 	if rw.size+int64(len(p)) > rw.maxSize {
-		if err := rw.rotate(); err != nil {
+		if rotateErr = rw.rotate(); rotateErr != nil {
 			// If rotation fails, we try to write to the current file anyway
 			// or fallback to stderr if completely broken.
 			// For now, just log to stderr that rotation failed
-			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", rotateErr)
+			rw.setError(rotateErr)
 		}
 	}
 
@@ -95,15 +115,64 @@ func (rw *rotatingWriter) Write(p []byte) (int, error) {
 		if err := rw.open(); err != nil {
 			// Last resort: write to stderr.
 			fmt.Fprintf(os.Stderr, "log writer unusable, writing to stderr: %v\n", err)
+			rw.setError(err)
 			return os.Stderr.Write(p)
 		}
 	}
 
 	n, err := rw.file.Write(p)
 	rw.size += int64(n)
+	switch {
+	case err != nil:
+		rw.setError(err)
+	case rotateErr == nil:
+		// Запись снова идёт нормально.
+		rw.lastError = nil
+	}
 	return n, err
 }
 
+// setError запоминает ошибку записи; должна вызываться под lock.
+func (rw *rotatingWriter) setError(err error) {
+	rw.lastError = err
+	rw.lastErrorTime = time.Now()
+}
+
+// Status возвращает текущее состояние журнала.
+func (rw *rotatingWriter) Status() rotatingWriterStatus {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	return rotatingWriterStatus{
+		Filename:      rw.filename,
+		Size:          rw.size,
+		LastRotation:  rw.lastRotation,
+		LastError:     rw.lastError,
+		LastErrorTime: rw.lastErrorTime,
+	}
+}
+
+// setFilename переключает запись на другой файл (log_file изменён в config.yaml).
+// Если новый файл не открывается, запись продолжается в прежний.
+func (rw *rotatingWriter) setFilename(filename string) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if filename == rw.filename {
+		return nil
+	}
+	oldName, oldFile, oldSize := rw.filename, rw.file, rw.size
+	rw.filename = filename
+	if err := rw.open(); err != nil {
+		rw.filename, rw.file, rw.size = oldName, oldFile, oldSize
+		return err
+	}
+	if oldFile != nil {
+		_ = oldFile.Close()
+	}
+	return nil
+}
+
 func (rw *rotatingWriter) Close() error {
 	rw.mu.Lock()
 	defer rw.mu.Unlock()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -53,3 +54,65 @@ func TestRotatingWriter(t *testing.T) {
 		t.Errorf("expected current file size 10, got %d", info.Size())
 	}
 }
+
+func TestRotatingWriter_SetFilename(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.log"), filepath.Join(dir, "logs", "b.log")
+	rw, err := newRotatingWriter(first, maxLogSizeBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	rw.Write([]byte("one\n"))
+	if err := rw.setFilename(second); err != nil {
+		t.Fatalf("setFilename failed: %v", err)
+	}
+	rw.Write([]byte("two\n"))
+
+	if data, _ := os.ReadFile(first); string(data) != "one\n" {
+		t.Errorf("first log = %q", data)
+	}
+	if data, _ := os.ReadFile(second); string(data) != "two\n" {
+		t.Errorf("second log = %q", data)
+	}
+
+	// A file that cannot be opened leaves the writer on the current one.
+	if err := rw.setFilename(dir); err == nil {
+		t.Fatal("expected error for a directory")
+	}
+	rw.Write([]byte("three\n"))
+	if data, _ := os.ReadFile(second); string(data) != "two\nthree\n" {
+		t.Errorf("second log = %q", data)
+	}
+}
+
+func TestRotatingWriter_Status(t *testing.T) {
+	dir := t.TempDir()
+	rw, err := newRotatingWriter(filepath.Join(dir, "access.log"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	rw.Write([]byte("12345678"))
+	rw.Write([]byte("12345678"))
+	st := rw.Status()
+	if st.LastRotation.IsZero() || st.Size != 8 || st.LastError != nil {
+		t.Errorf("unexpected status after rotation: %+v", st)
+	}
+
+	// The directory disappears: the writer reports the error.
+	rw.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+	rw.Write([]byte("1"))
+	if st := rw.Status(); st.LastError == nil || st.LastErrorTime.IsZero() {
+		t.Errorf("expected a write error in status: %+v", st)
+	}
+}
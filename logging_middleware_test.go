@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Test that loggingMiddleware logs regular requests and captures status/bytes.
@@ -73,3 +77,150 @@ func TestLoggingMiddleware_SkipsHealthz(t *testing.T) {
 		t.Fatalf("expected no log output for /healthz, got %q", buf.String())
 	}
 }
+
+// Probes are not logged under base_path either.
+func TestLoggingMiddleware_SkipsReadyzUnderBasePath(t *testing.T) {
+	buf := withTestAccessLog(t, "{{.URI}}")
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h := loggingMiddleware(basePathMiddleware("/normdocs", routeMiddleware(mux, mux)))
+
+	for _, target := range []string{"/readyz", "/normdocs/readyz"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log output for /readyz, got %q", buf.String())
+	}
+}
+
+// withTestAccessLog captures access log output in the given format for the duration of the test.
+func withTestAccessLog(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	f, err := parseAccessLogFormat(format)
+	if err != nil {
+		t.Fatalf("parseAccessLogFormat(%q) failed: %v", format, err)
+	}
+	var buf bytes.Buffer
+	accessLog, accessLogFmt = log.New(&buf, "", 0), f
+	t.Cleanup(func() { accessLog, accessLogFmt = nil, accessLogFormat{} })
+	return &buf
+}
+
+// loggedAsUser plays the auth middleware: it puts a user into the request context.
+func loggedAsUser(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), &User{Name: name})))
+	})
+}
+
+func TestLoggingMiddleware_JSONFormat(t *testing.T) {
+	buf := withTestAccessLog(t, "json")
+	h := loggingMiddleware(loggedAsUser("ivanov", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/a.pdf?x=1", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.20")
+	req.Header.Set("User-Agent", "test-agent")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var e accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	id := rec.Header().Get(requestIDHeader)
+	if len(id) != 16 || e.RequestID != id {
+		t.Errorf("expected generated request ID %q in response and log, got %q", id, e.RequestID)
+	}
+	if e.User != "ivanov" || e.ClientIP != "10.0.0.5" || e.RemoteAddr != "10.0.0.5" || e.ForwardedFor != "192.168.1.20" ||
+		e.Method != http.MethodGet || e.URI != "/docs/a.pdf?x=1" || e.Status != http.StatusOK || e.Bytes != 5 ||
+		e.UserAgent != "test-agent" || e.Duration < 0 || e.Time.IsZero() {
+		t.Errorf("unexpected log entry: %+v", e)
+	}
+}
+
+func TestLoggingMiddleware_TemplateFormat(t *testing.T) {
+	buf := withTestAccessLog(t, `{{.RequestID}} {{.User}} {{.Method}} {{.URI}} {{.Status}} {{.Bytes}} {{printf "%.0f" .Duration}}`)
+	h := loggingMiddleware(loggedAsUser("petrov", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	// A request ID set by the proxy is kept; garbage is replaced.
+	req.Header.Set(requestIDHeader, "abc-123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got := buf.String(); got != "abc-123 petrov GET /missing 404 19 0\n" {
+		t.Errorf("unexpected template output: %q", got)
+	}
+
+	buf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if strings.HasPrefix(buf.String(), "bad") {
+		t.Errorf("expected invalid request ID to be replaced, got %q", buf.String())
+	}
+}
+
+func TestLoggingMiddleware_CombinedFormatWithUser(t *testing.T) {
+	buf := withTestAccessLog(t, "combined")
+	h := loggingMiddleware(loggedAsUser("sidorov", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.HasPrefix(buf.String(), `10.0.0.5 - sidorov "GET / HTTP/1.1" 200 0 `) {
+		t.Errorf("unexpected combined line: %q", buf.String())
+	}
+}
+
+func TestLoadConfig_LogFormat(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) (Config, error) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return LoadConfig(cfgPath)
+	}
+
+	cfg, err := write(`port: "8080"`)
+	if err != nil || cfg.LogFormat.name != logFormatCombined || !cfg.LogFormat.timestamped() {
+		t.Errorf("expected combined format by default, got %+v (%v)", cfg.LogFormat, err)
+	}
+	cfg, err = write(`log_format: json`)
+	if err != nil || cfg.LogFormat.name != logFormatJSON || cfg.LogFormat.timestamped() {
+		t.Errorf("expected json format, got %+v (%v)", cfg.LogFormat, err)
+	}
+	if _, err := write(`log_format: "{{.ClientIp}} {{.Status}}"`); err == nil {
+		t.Errorf("expected error for unknown field in log_format template")
+	}
+	if _, err := write(`log_format: "{{.Status"`); err == nil {
+		t.Errorf("expected error for malformed log_format template")
+	}
+}
+
+// setWriteDeadlineThrough calls http.ResponseController.SetWriteDeadline from
+// a handler behind the wrappers of wrap on a real server and returns its error.
+func setWriteDeadlineThrough(t *testing.T, wrap func(http.Handler) http.Handler, path string) error {
+	t.Helper()
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs <- http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return <-errs
+}
+
+func TestLoggingMiddleware_ResponseController(t *testing.T) {
+	if err := setWriteDeadlineThrough(t, loggingMiddleware, "/"); err != nil {
+		t.Errorf("SetWriteDeadline through loggingMiddleware: %v", err)
+	}
+}
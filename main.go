@@ -2,38 +2,75 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"flag"
 	"fmt"
-	"html/template"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kardianos/service"
 )
 
-//go:embed templates/index.html static/*
+//go:embed templates/*.html static/*
 var content embed.FS
 
-var accessLog *log.Logger
-
 const (
 	exitCodeConfig         = 1
 	exitCodeServiceControl = 2
 	exitCodeRun            = 3
 )
 
+// indexPage - данные шаблона index.html.
+type indexPage struct {
+	Sections []Section
+	// User - вошедший пользователь; nil для анонимного.
+	User *User
+	// LoginEnabled - аутентификация включена (показывать "Войти"/"Выйти").
+	LoginEnabled bool
+	// StatsEnabled - ведётся статистика скачиваний (ссылка на /stats).
+	StatsEnabled bool
+	// ZipEnabled - разделы можно скачать архивом (/zip/).
+	ZipEnabled bool
+	// FeedEnabled - лента изменений доступна (/feed.atom).
+	FeedEnabled bool
+	// HasSubsections - пути разделов, у которых есть подразделы.
+	HasSubsections map[string]bool
+	// Popular - самые скачиваемые за месяц документы.
+	Popular []popularDocument
+}
+
 // Program structures.
 // Define Start and Stop methods.
 type program struct {
 	server *http.Server
-	cfg    Config
+	// cfg - конфигурация, с которой служба запущена; настройки сервера
+	// (порт, TLS, тайм-ауты) и хранилища берутся только из неё.
+	cfg Config
+
+	// configPath и loadConfig - откуда и как перечитывать конфигурацию
+	// (config.yaml с учётом флагов командной строки).
+	configPath string
+	loadConfig func() (Config, error)
+
+	// redirectServer перенаправляет HTTP на HTTPS (tls.redirect_http_port).
+	redirectServer *http.Server
 
 	rotWriter *rotatingWriter
+	auth      *authenticator
+	acks      *ackStore
+	audit     *auditLog
+	stats     *statsStore
+
+	// site - текущие каталог документов и обработчики; заменяется при перечитывании.
+	site       atomic.Pointer[site]
+	reloadMu   sync.Mutex
+	stopReload context.CancelFunc
 }
 
 func (p *program) Start(s service.Service) error {
@@ -56,19 +93,157 @@ func (p *program) Start(s service.Service) error {
 	if err != nil {
 		return err
 	}
-	accessLog = log.New(p.rotWriter, "", log.LstdFlags)
+	flags := 0
+	if p.cfg.LogFormat.timestamped() {
+		flags = log.LstdFlags
+	}
+	accessLog = log.New(p.rotWriter, "", flags)
+	accessLogFmt = p.cfg.LogFormat
+
+	// Authentication (optional).
+	p.auth, err = newAuthenticator(p.cfg.Auth)
+	if err != nil {
+		return err
+	}
+	if p.auth != nil {
+		p.auth.publicMetrics = p.cfg.MetricsPublic
+	}
+
+	// HTTPS (optional): the certificate is loaded now so that a bad one fails the start.
+	var tlsConfig *tls.Config
+	if p.cfg.TLS != nil {
+		tlsConfig, err = newServerTLSConfig(*p.cfg.TLS)
+		if err != nil {
+			return err
+		}
+	}
 
+	// Read acknowledgements store (optional).
+	if p.cfg.AckDB != "" {
+		p.acks, err = openAckStore(p.cfg.AckDB)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Download audit log (optional).
+	if p.cfg.AuditLog != "" {
+		p.audit, err = openAuditLog(p.cfg.AuditLog)
+		if err != nil {
+			p.closeStores()
+			return err
+		}
+	}
+
+	// Download statistics (optional).
+	if p.cfg.StatsDB != "" {
+		p.stats, err = openStatsStore(p.cfg.StatsDB)
+		if err != nil {
+			p.closeStores()
+			return err
+		}
+	}
+
+	// Documents, templates and routes; replaced as a whole when the config is reloaded.
+	st, err := p.newSite(p.cfg)
+	if err != nil {
+		// Служба не запустится: базы не должны остаться заблокированными до выхода процесса.
+		p.closeStores()
+		return err
+	}
+	p.site.Store(st)
+
+	// Wrap mux with access logging middleware so that все запросы логируются единообразно.
+	p.server = &http.Server{
+		Addr:              ":" + p.cfg.Port,
+		Handler:           loggingMiddleware(http.HandlerFunc(p.serveSite)),
+		ReadTimeout:       p.cfg.ReadTimeout,
+		WriteTimeout:      p.cfg.WriteTimeout,
+		IdleTimeout:       p.cfg.IdleTimeout,
+		ReadHeaderTimeout: p.cfg.ReadHeaderTimeout,
+		TLSConfig:         tlsConfig,
+	}
+
+	// Start Server in goroutine
+	go func() {
+		log.Printf("Serving documents from %s", p.cfg.DocsDir)
+		var err error
+		if tlsConfig != nil {
+			log.Printf("Server starting on https://localhost:%s", p.cfg.Port)
+			// The certificate comes from TLSConfig.GetCertificate.
+			err = p.server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server starting on http://localhost:%s", p.cfg.Port)
+			err = p.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("Listen error: %v", err)
+		}
+	}()
+
+	if p.cfg.TLS != nil && p.cfg.TLS.RedirectHTTPPort != "" {
+		p.redirectServer = &http.Server{
+			Addr:              ":" + p.cfg.TLS.RedirectHTTPPort,
+			Handler:           httpsRedirectHandler(p.cfg.Port),
+			ReadTimeout:       p.cfg.ReadTimeout,
+			WriteTimeout:      p.cfg.WriteTimeout,
+			IdleTimeout:       p.cfg.IdleTimeout,
+			ReadHeaderTimeout: p.cfg.ReadHeaderTimeout,
+		}
+		go func() {
+			log.Printf("Redirecting http://localhost:%s to HTTPS", p.cfg.TLS.RedirectHTTPPort)
+			if err := p.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Listen error: %v", err)
+			}
+		}()
+	}
+
+	// Reload the config on SIGHUP and when config.yaml changes.
+	if p.loadConfig != nil {
+		var reloadCtx context.Context
+		reloadCtx, p.stopReload = context.WithCancel(context.Background())
+		p.watchConfig(reloadCtx)
+	}
+
+	return nil
+}
+
+// newSite строит из cfg каталог документов, шаблоны и обработчики запросов.
+// Хранилища, аутентификация и сам сервер при этом не пересоздаются.
+func (p *program) newSite(cfg Config) (*site, error) {
 	// Doc Repository
-	repo := NewDocRepository(p.cfg.DocsDir, p.cfg.CacheTTL)
+	repo := NewDocRepository(cfg.DocsDir, cfg.CacheTTL)
+	repo.scanTimeout = cfg.ScanTimeout
+	repo.types = cfg.DocumentTypes
+	repo.accessRules = cfg.Access
+	repo.basePath = cfg.BasePath
+	// При перечитывании конфигурации лента изменений продолжается, а не начинается
+	// заново; историю прежнего сайта reload передаёт при подмене.
+	if old := p.site.Load(); old != nil && old.cfg.DocsDir == cfg.DocsDir {
+		repo.continueChanges(old.repo)
+	}
+	if len(cfg.Access) > 0 && p.auth == nil {
+		log.Printf("Warning: access rules are configured, but auth is off; restricted sections are hidden from everyone")
+	}
 
 	// Parse Template
-	tmpl, err := template.ParseFS(content, "templates/index.html")
+	pages := newPageTemplates(cfg.TemplatesDir, cfg.BasePath, cfg.Branding)
+	tmpl, err := pages.page("index.html")
+	if err != nil {
+		return nil, err
+	}
+	viewTmpl, err := pages.page("view.html")
+	if err != nil {
+		return nil, err
+	}
+	statsTmpl, err := pages.page("stats.html")
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return nil, err
 	}
 
 	// Handlers
 	mux := http.NewServeMux()
+	feedEnabled := cfg.PublicURL != "" || len(cfg.TrustedProxies) > 0
 
 	// Handler - List
 	indexHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,52 +252,123 @@ func (p *program) Start(s service.Service) error {
 			return
 		}
 
-		sections, err := repo.GetSections()
+		sections, err := repo.SectionsFor(userFromRequest(r))
 		if err != nil {
 			http.Error(w, "Could not load documents", http.StatusInternalServerError)
 			log.Printf("Error getting sections: %v", err)
 			return
 		}
 
+		page := indexPage{Sections: sections, User: userFromRequest(r), LoginEnabled: p.auth != nil, StatsEnabled: p.stats != nil,
+			ZipEnabled: cfg.ZipMaxSize > 0, FeedEnabled: feedEnabled, HasSubsections: sectionsWithSubsections(sections)}
+		if p.stats != nil {
+			// Без статистики главная всё равно должна открываться.
+			if page.Popular, err = popularDocuments(p.stats, sections, time.Now()); err != nil {
+				log.Printf("Error reading download statistics: %v", err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, sections); err != nil {
+		if err := tmpl.Execute(w, page); err != nil {
 			log.Printf("Error executing template: %v", err)
 			return
 		}
 	})
 	mux.Handle("/", indexHandler)
 
-	// Handler - Static (CSS)
-	staticServer := http.FileServer(http.FS(content))
+	// Handler - Static (CSS); files from static_dir override the embedded ones.
+	staticServer := http.FileServer(http.FS(staticFS{dir: cfg.StaticDir}))
 	mux.Handle("/static/", staticServer)
 
-	// Health check endpoint
-	mux.Handle("/healthz", healthHandler(p.cfg.DocsDir))
+	// Liveness and readiness probes
+	mux.Handle("/healthz", healthHandler())
+	mux.Handle("/readyz", readyHandler(cfg.DocsDir, repo, p.rotWriter))
 
-	// Handler - Serve documents
-	docFS := http.FileServer(http.Dir(p.cfg.DocsDir))
-	mux.Handle("/docs/", http.StripPrefix("/docs/", docFS))
+	// Prometheus metrics
+	mux.Handle("GET /metrics", metricsHandler(metrics))
 
-	// Wrap mux with access logging middleware so that все запросы логируются единообразно.
-	p.server = &http.Server{
-		Addr:              ":" + p.cfg.Port,
-		Handler:           loggingMiddleware(mux),
-		ReadTimeout:       p.cfg.ReadTimeout,
-		WriteTimeout:      p.cfg.WriteTimeout,
-		IdleTimeout:       p.cfg.IdleTimeout,
-		ReadHeaderTimeout: p.cfg.ReadHeaderTimeout,
+	// Full-text search inside PDF contents
+	mux.Handle("/search", searchHandler(repo))
+
+	// JSON API
+	apiSections := apiSectionsHandler(repo)
+	mux.Handle("GET /api/v1/sections", apiSections)
+	mux.Handle("GET /api/v1/sections/{path...}", apiSections)
+
+	// Atom feed of new, changed and removed documents. Its absolute links need the site
+	// address: public_url or the Host header passed by a trusted proxy.
+	if feedEnabled {
+		mux.Handle("GET /feed.atom", feedHandler(repo, cfg.Branding, cfg.PublicURL, cfg.TrustedProxies))
+	} else {
+		log.Printf("Atom feed needs the public address of the site; set public_url to enable /feed.atom")
 	}
 
-	// Start Server in goroutine
-	go func() {
-		log.Printf("Server starting on http://localhost:%s", p.cfg.Port)
-		log.Printf("Serving documents from %s", p.cfg.DocsDir)
-		if err := p.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Listen error: %v", err)
+	// Markdown documents rendered as pages
+	mux.Handle("GET /view/{path...}", viewHandler(repo, p.stats, viewTmpl))
+
+	// Read acknowledgements and reports
+	if p.acks != nil {
+		mux.Handle("/ack", ackHandler(repo, p.acks, p.auth == nil))
+		if cfg.AckViewers != nil {
+			mux.Handle("GET /reports/acks", ackReportHandler(repo, p.acks, cfg.AckEmployeesFile, cfg.AckViewers))
+		} else {
+			log.Printf("Read acknowledgements are stored in %s; set ack_viewers to enable /reports/acks", p.cfg.AckDB)
 		}
-	}()
+	}
 
-	return nil
+	// Download statistics
+	if p.stats != nil {
+		mux.Handle("GET /stats", statsHandler(repo, p.stats, statsTmpl))
+	}
+
+	// Download audit log query for security officers
+	if p.audit != nil {
+		if cfg.AuditViewers != nil {
+			mux.Handle("GET /reports/downloads", auditReportHandler(p.audit, cfg.AuditViewers))
+		} else {
+			log.Printf("Download audit log is written to %s; set audit_viewers to enable /reports/downloads", p.cfg.AuditLog)
+		}
+	}
+
+	// Login page and logout
+	if p.auth != nil {
+		loginTmpl, err := pages.page("login.html")
+		if err != nil {
+			return nil, err
+		}
+		mux.Handle("/login", p.auth.loginHandler(loginTmpl))
+		mux.Handle("POST /logout", p.auth.logoutHandler())
+		if p.auth.oidc != nil {
+			mux.Handle("GET "+oidcLoginPath, p.auth.oidcLoginHandler())
+			mux.Handle("GET "+oidcCallbackPath, p.auth.oidcCallbackHandler())
+		}
+	}
+
+	// Whole sections as ZIP archives; write_timeout is the one the server was started with.
+	if cfg.ZipMaxSize > 0 {
+		mux.Handle("GET /zip/{path...}", zipHandler(repo, p.audit, p.stats, cfg.ZipMaxSize, p.cfg.WriteTimeout))
+	}
+
+	// Handler - Serve documents
+	mux.Handle("/docs/", http.StripPrefix("/docs/", docsFileHandler(repo, p.audit, p.stats)))
+
+	// Authentication puts the user into the request context before the mux.
+	var handler http.Handler = mux
+	if p.auth != nil {
+		handler = p.auth.Middleware(handler)
+	}
+	handler = routeMiddleware(mux, handler)
+	// Behind a reverse proxy: the client address, scheme and the site prefix.
+	handler = proxyMiddleware(cfg.TrustedProxies, basePathMiddleware(cfg.BasePath, handler))
+
+	// Watch docs directory so that changes show up without waiting for cache_ttl.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	if err := repo.Watch(watchCtx, cfg.Watch, cfg.WatchPollInterval); err != nil {
+		stopWatch()
+		return nil, err
+	}
+
+	return &site{cfg: cfg, repo: repo, handler: handler, stopWatch: stopWatch}, nil
 }
 
 func (p *program) Stop(s service.Service) error {
@@ -135,6 +381,23 @@ func (p *program) Stop(s service.Service) error {
 			log.Printf("Server forced to shutdown: %v", err)
 		}
 	}
+	if p.redirectServer != nil {
+		if err := p.redirectServer.Shutdown(ctx); err != nil {
+			log.Printf("Redirect server forced to shutdown: %v", err)
+		}
+	}
+
+	if p.stopReload != nil {
+		p.stopReload()
+	}
+	// Дожидаемся перечитывания, если оно идёт, чтобы не оставить работающее наблюдение.
+	p.reloadMu.Lock()
+	if st := p.site.Load(); st != nil {
+		st.close()
+	}
+	p.reloadMu.Unlock()
+
+	p.closeStores()
 
 	if p.rotWriter != nil {
 		p.rotWriter.Close()
@@ -144,27 +407,72 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// closeStores закрывает хранилища, открытые при запуске: ознакомления, статистику и журнал скачиваний.
+func (p *program) closeStores() {
+	if p.acks != nil {
+		if err := p.acks.Close(); err != nil {
+			log.Printf("Error closing ack database: %v", err)
+		}
+		p.acks = nil
+	}
+
+	if err := p.stats.Close(); err != nil {
+		log.Printf("Error closing stats database: %v", err)
+	}
+	p.stats = nil
+
+	if err := p.audit.Close(); err != nil {
+		log.Printf("Error closing audit log: %v", err)
+	}
+	p.audit = nil
+}
+
 func main() {
 	// Flags
 	configPath := flag.String("config", "config.yaml", "Path to config file")
 	docsDirOverride := flag.String("dir", "", "Directory containing PDF files (overrides config)")
 	portOverride := flag.String("port", "", "Server port (overrides config)")
 	svcFlag := flag.String("service", "", "Control the system service: install, uninstall, start, stop")
+	checkConfigFlag := flag.Bool("check-config", false, "Validate the configuration, print the effective values with their sources and exit")
 	flag.Parse()
 
-	// Load config (defaults + optional YAML file).
-	cfg, err := LoadConfig(*configPath)
+	// The service changes its working directory on start, so the config is
+	// reloaded by absolute path.
+	absConfigPath, err := filepath.Abs(*configPath)
 	if err != nil {
-		log.Printf("failed to load config: %v", err)
+		log.Printf("failed to resolve config path: %v", err)
 		os.Exit(exitCodeConfig)
 	}
 
-	// Apply CLI overrides on top of config.
+	// Load config: defaults < config.yaml < DOCSRV_* environment variables < flags.
+	flagOverrides := map[string]string{}
 	if *docsDirOverride != "" {
-		cfg.DocsDir = *docsDirOverride
+		flagOverrides["docs_dir"] = *docsDirOverride
 	}
 	if *portOverride != "" {
-		cfg.Port = *portOverride
+		flagOverrides["port"] = *portOverride
+	}
+	loadConfig := func() (Config, error) {
+		cfg, _, err := LoadLayeredConfig(absConfigPath, os.Environ(), flagOverrides)
+		return cfg, err
+	}
+
+	if *checkConfigFlag {
+		cfg, sources, err := LoadLayeredConfig(absConfigPath, os.Environ(), flagOverrides)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+			os.Exit(exitCodeConfig)
+		}
+		if !runCheckConfig(os.Stdout, cfg, sources) {
+			os.Exit(exitCodeConfig)
+		}
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("failed to load config: %v", err)
+		os.Exit(exitCodeConfig)
 	}
 
 	// Service configuration uses the same flags that were passed on install,
@@ -185,7 +493,9 @@ func main() {
 	}
 
 	prg := &program{
-		cfg: cfg,
+		cfg:        cfg,
+		configPath: absConfigPath,
+		loadConfig: loadConfig,
 	}
 
 	s, err := service.New(prg, svcConfig)
@@ -209,76 +519,3 @@ func main() {
 		os.Exit(exitCodeRun)
 	}
 }
-
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	status int
-	bytes  int
-}
-
-// healthHandler проверяет доступность каталога документов и возвращает 200 OK,
-// если всё в порядке. Используется для простого мониторинга сервиса.
-func healthHandler(docsDir string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if _, err := os.Stat(docsDir); err != nil {
-			http.Error(w, "docs directory is not accessible", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		_, _ = w.Write([]byte("ok"))
-	})
-}
-
-func (lrw *loggingResponseWriter) WriteHeader(statusCode int) {
-	lrw.status = statusCode
-	lrw.ResponseWriter.WriteHeader(statusCode)
-}
-
-func (lrw *loggingResponseWriter) Write(p []byte) (int, error) {
-	if lrw.status == 0 {
-		// Если явно не вызывали WriteHeader, считаем статус 200.
-		lrw.status = http.StatusOK
-	}
-	n, err := lrw.ResponseWriter.Write(p)
-	lrw.bytes += n
-	return n, err
-}
-
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		lrw := &loggingResponseWriter{ResponseWriter: w}
-		next.ServeHTTP(lrw, r)
-
-		if accessLog != nil {
-			// /healthz обычно дергается очень часто мониторингом, поэтому
-			// по умолчанию не логируем его, чтобы не засорять access.log.
-			if r.URL.Path == "/healthz" {
-				return
-			}
-
-			duration := time.Since(start)
-
-			remote := r.RemoteAddr
-			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-				remote = host
-			}
-
-			// Формат, близкий к nginx combined log (без времени, его пишет log.Logger):
-			// $remote_addr - - "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time
-			accessLog.Printf("%s - - \"%s %s %s\" %d %d \"%s\" \"%s\" %.3f",
-				remote,
-				r.Method,
-				r.URL.RequestURI(),
-				r.Proto,
-				lrw.status,
-				lrw.bytes,
-				r.Referer(),
-				r.UserAgent(),
-				duration.Seconds(),
-			)
-		}
-	})
-}
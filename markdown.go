@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Расширение Markdown-документов, которые показываются как HTML-страницы (/view/...).
+const markdownExt = ".md"
+
+// tocEntry - пункт оглавления Markdown-страницы.
+type tocEntry struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// markdownDoc - результат разбора Markdown-файла.
+type markdownDoc struct {
+	HTML template.HTML
+	// Title - текст первого заголовка первого уровня.
+	Title string
+	// TOC - заголовки второго и третьего уровня.
+	TOC []tocEntry
+}
+
+// renderReadme рендерит содержимое README.md в HTML,
+// переписывая относительные ссылки/картинки на базу "<basePath>/docs/<relDir>/".
+// relDir - относительный путь директории внутри r.dir, в формате с "/".
+func renderReadme(content []byte, basePath, relDir string) template.HTML {
+	return renderMarkdown(content, basePath, relDir, false).HTML
+}
+
+// renderMarkdown рендерит Markdown в HTML. Относительные ссылки переписываются
+// на "<basePath>/docs/<relDir>/...", а ссылки на другие .md - на их страницы
+// "<basePath>/view/<relDir>/...". С anchors у заголовков появляются id
+// и ссылки-якоря, а из них собирается оглавление.
+func renderMarkdown(content []byte, basePath, relDir string, anchors bool) markdownDoc {
+	var md goldmark.Markdown
+	if anchors {
+		md = goldmark.New(goldmark.WithParserOptions(parser.WithAutoHeadingID()))
+	} else {
+		// Без id: на главной странице несколько README, и их id пересекались бы.
+		md = goldmark.New()
+	}
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+
+	reader := text.NewReader(content)
+	doc := md.Parser().Parse(reader, parser.WithContext(ctx))
+
+	basePrefix := basePath + "/docs/"
+	viewPrefix := basePath + "/view/"
+	if relDir != "." && relDir != "" {
+		basePrefix += relDir + "/"
+		viewPrefix += relDir + "/"
+	}
+
+	var result markdownDoc
+	var headings []*ast.Heading
+
+	// Проходим по AST и переписываем относительные URL.
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		rewrite := func(dest []byte, page bool) []byte {
+			u := string(dest)
+			if !isRelativeURL(u) {
+				return dest
+			}
+			if page && isMarkdownURL(u) {
+				return []byte(viewPrefix + u)
+			}
+			return []byte(basePrefix + u)
+		}
+
+		switch node := n.(type) {
+		case *ast.Image:
+			node.Destination = rewrite(node.Destination, false)
+		case *ast.Link:
+			node.Destination = rewrite(node.Destination, true)
+		case *ast.Heading:
+			headings = append(headings, node)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, h := range headings {
+		title := headingText(h, content)
+		if h.Level == 1 && result.Title == "" {
+			result.Title = title
+		}
+		if !anchors {
+			continue
+		}
+
+		id, ok := h.AttributeString("id")
+		if !ok {
+			continue
+		}
+		idStr := string(id.([]byte))
+
+		if h.Level == 2 || h.Level == 3 {
+			result.TOC = append(result.TOC, tocEntry{Level: h.Level, ID: idStr, Text: title})
+		}
+
+		anchor := ast.NewLink()
+		anchor.Destination = []byte("#" + idStr)
+		anchor.SetAttributeString("class", []byte("heading-anchor"))
+		anchor.SetAttributeString("aria-hidden", []byte("true"))
+		anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+		h.AppendChild(h, anchor)
+	}
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, content, doc); err != nil {
+		// Fallback: эскейпнем исходный Markdown как текст, если рендеринг не удался.
+		result.HTML = template.HTML(template.HTMLEscapeString(string(content)))
+		return result
+	}
+
+	result.HTML = template.HTML(buf.String())
+	return result
+}
+
+// markdownText возвращает текст Markdown-документа без разметки (для поискового индекса).
+func markdownText(content []byte) string {
+	doc := goldmark.New().Parser().Parse(text.NewReader(content))
+
+	var sb strings.Builder
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			sb.Write(node.Segment.Value(content))
+			sb.WriteByte(' ')
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := node.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				sb.Write(seg.Value(content))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return sb.String()
+}
+
+// headingText собирает текст заголовка без разметки.
+func headingText(h *ast.Heading, source []byte) string {
+	var sb strings.Builder
+	_ = ast.Walk(h, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			sb.Write(node.Segment.Value(source))
+		case *ast.String:
+			sb.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(sb.String())
+}
+
+// headingIDs генерирует id заголовков. В отличие от встроенного в goldmark
+// генератора, сохраняет буквы любых алфавитов, иначе у всех русских
+// заголовков были бы id вида "heading-1".
+type headingIDs struct {
+	used map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: make(map[string]bool)}
+}
+
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var sb strings.Builder
+	for _, r := range strings.TrimSpace(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(normalizeRune(r))
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			sb.WriteByte('-')
+		}
+	}
+
+	id := sb.String()
+	if id == "" {
+		id = "heading"
+	}
+	unique := id
+	for i := 1; s.used[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+	s.used[unique] = true
+	return []byte(unique)
+}
+
+func (s *headingIDs) Put(value []byte) {
+	s.used[string(value)] = true
+}
+
+// isRelativeURL возвращает true, если URL выглядит как относительный путь
+// внутри README (не якорь, не абсолютный путь и не URL со схемой: http:, mailto: и т.п.).
+func isRelativeURL(u string) bool {
+	if u == "" || strings.HasPrefix(u, "#") || strings.HasPrefix(u, "/") {
+		return false
+	}
+	if parsed, err := url.Parse(u); err == nil && parsed.Scheme != "" {
+		return false
+	}
+	return true
+}
+
+// isMarkdownURL возвращает true, если относительная ссылка ведёт на .md-файл.
+func isMarkdownURL(u string) bool {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	return strings.EqualFold(path.Ext(u), markdownExt)
+}
+
+// viewPage - данные шаблона view.html.
+type viewPage struct {
+	Title   string
+	Section string
+	// FileURL - ссылка на исходный .md-файл.
+	FileURL string
+	Meta    DocumentMeta
+	markdownDoc
+}
+
+// viewHandler показывает Markdown-документ из каталога документов как HTML-страницу
+// в оформлении сайта: GET /view/{path...}, где path - путь к .md-файлу внутри docs_dir.
+// Просмотр страницы учитывается в статистике так же, как скачивание файла.
+func viewHandler(repo *DocRepository, stats *statsStore, tmpl *pageTemplate) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := r.PathValue("path")
+		if _, ext, ok := repo.types.lookup(rel); !ok || ext != markdownExt {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !repo.CanAccessFile(userFromRequest(r), rel) {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Localize отбрасывает абсолютные пути и выход за пределы каталога ("..").
+		local, err := filepath.Localize(rel)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fullPath := filepath.Join(repo.dir, local)
+
+		source, err := os.ReadFile(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, "Could not read document", http.StatusInternalServerError)
+			log.Printf("Error reading markdown document %s: %v", fullPath, err)
+			return
+		}
+
+		relDir := path.Dir(rel)
+		page := viewPage{
+			Section:     relDir,
+			FileURL:     repo.basePath + "/docs/" + rel,
+			Meta:        loadDirMetadata(filepath.Dir(fullPath)).lookup(path.Base(rel)),
+			markdownDoc: renderMarkdown(source, repo.basePath, relDir, true),
+		}
+		if relDir == "." {
+			page.Section = generalSectionName
+		}
+
+		// Название: из описания, затем первый заголовок, затем имя файла.
+		page.Title = page.Meta.Title
+		if page.Title == "" {
+			page.Title = page.markdownDoc.Title
+		}
+		if page.Title == "" {
+			page.Title = path.Base(rel)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, page); err != nil {
+			log.Printf("Error executing template: %v", err)
+			return
+		}
+		stats.countRequest(r, rel, http.StatusOK)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMarkdown_AnchorsTOCAndLinks(t *testing.T) {
+	source := []byte(`# Инструкция
+
+Текст со [ссылкой на раздел](#порядок-работы), [другой инструкцией](other.md#шаг-1),
+[бланком](forms/blank.docx), [почтой](mailto:hr@example.com) и ![схемой](img/scheme.png).
+
+## Порядок работы
+
+### Шаг 1
+
+## Порядок работы
+`)
+
+	doc := renderMarkdown(source, "", "HR/2025", true)
+
+	if doc.Title != "Инструкция" {
+		t.Errorf("expected title from first heading, got %q", doc.Title)
+	}
+	wantTOC := []tocEntry{
+		{Level: 2, ID: "порядок-работы", Text: "Порядок работы"},
+		{Level: 3, ID: "шаг-1", Text: "Шаг 1"},
+		{Level: 2, ID: "порядок-работы-1", Text: "Порядок работы"},
+	}
+	if len(doc.TOC) != len(wantTOC) {
+		t.Fatalf("expected TOC %+v, got %+v", wantTOC, doc.TOC)
+	}
+	for i := range wantTOC {
+		if doc.TOC[i] != wantTOC[i] {
+			t.Errorf("TOC[%d]: expected %+v, got %+v", i, wantTOC[i], doc.TOC[i])
+		}
+	}
+
+	html := string(doc.HTML)
+	for _, want := range []string{
+		`href="#%D0%BF%D0%BE%D1%80%D1%8F%D0%B4%D0%BE%D0%BA-%D1%80%D0%B0%D0%B1%D0%BE%D1%82%D1%8B"`,
+		`href="/view/HR/2025/other.md#%D1%88%D0%B0%D0%B3-1"`,
+		`href="/docs/HR/2025/forms/blank.docx"`,
+		`href="mailto:hr@example.com"`,
+		`src="/docs/HR/2025/img/scheme.png"`,
+		`<h2 id="порядок-работы">`,
+		`class="heading-anchor"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %s in HTML:\n%s", want, html)
+		}
+	}
+
+	// README on the index page gets no ids, anchors or TOC.
+	readme := renderMarkdown(source, "", "HR", false)
+	if len(readme.TOC) != 0 || strings.Contains(string(readme.HTML), "id=") {
+		t.Errorf("expected no anchors in README, got %s", readme.HTML)
+	}
+}
+
+func TestMarkdownDocuments_ListedSearchedAndViewed(t *testing.T) {
+	tmpDir := t.TempDir()
+	hrDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(hrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"HR/README.md": "# Отдел кадров",
+		"HR/guide.md":  "# Памятка\n\n## Отпуск\n\nЗаявление на отпуск подаётся за две недели.\n",
+		"HR/guide.md.yaml": `
+number: "7"
+summary: "Краткая памятка"
+`,
+		"HR/plan.pdf": "pdf",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+	if len(sections) != 1 || len(sections[0].Documents) != 2 {
+		t.Fatalf("expected guide.md and plan.pdf in HR, got %+v", sections)
+	}
+	guide := sections[0].Documents[0]
+	if guide.Name != "guide.md" || guide.URL != "/view/HR/guide.md" || guide.Type != "md" {
+		t.Errorf("unexpected markdown document: %+v", guide)
+	}
+
+	results, err := repo.Search("заявление отпуск", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].URL != "/view/HR/guide.md" {
+		t.Fatalf("expected markdown document in search results, got %+v", results)
+	}
+
+	tmpl := testPageTemplate(t, "view.html")
+	mux := http.NewServeMux()
+	mux.Handle("GET /view/{path...}", viewHandler(repo, nil, tmpl))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/view/HR/guide.md", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<title>Памятка — Справочная система</title>",
+		`<div class="toc-title">Содержание</div>`,
+		// html/template percent-encodes the fragment "#отпуск".
+		`<a href="#%d0%be%d1%82%d0%bf%d1%83%d1%81%d0%ba">Отпуск</a>`,
+		"Краткая памятка",
+		`href="/docs/HR/guide.md"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in page:\n%s", want, body)
+		}
+	}
+
+	for _, url := range []string{"/view/HR/missing.md", "/view/HR/plan.pdf", "/view/..%2fsecret.md"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", url, rec.Code)
+		}
+	}
+}
+
+func TestIsRelativeURL(t *testing.T) {
+	cases := map[string]bool{
+		"plan.pdf":              true,
+		"../IT/net.md":          true,
+		"#section":              false,
+		"/docs/HR/plan.pdf":     false,
+		"https://example.com/x": false,
+		"mailto:hr@example.com": false,
+		"":                      false,
+	}
+	for u, want := range cases {
+		if got := isRelativeURL(u); got != want {
+			t.Errorf("isRelativeURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
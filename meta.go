@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Файлы-спутники с описанием документов:
+//
+//   - <file>.pdf.yaml рядом с документом - описание одного документа;
+//   - meta.yaml в директории - описания нескольких документов, ключ - имя файла.
+//
+// Если для документа есть оба варианта, используется <file>.pdf.yaml.
+const (
+	dirMetaFileName = "meta.yaml"
+	sidecarSuffix   = ".yaml"
+)
+
+// Статусы документа.
+const (
+	docStatusActive   = "active"
+	docStatusRepealed = "repealed"
+)
+
+// Форматы даты принятия, которые понимает файл-спутник.
+var metaDateLayouts = []string{"2006-01-02", "02.01.2006"}
+
+// DocumentMeta - описание документа из файла-спутника.
+type DocumentMeta struct {
+	Title     string
+	Number    string
+	Adopted   time.Time
+	Authority string
+	Status    string
+	Tags      []string
+	Summary   string
+}
+
+// yamlDocumentMeta mirrors the sidecar YAML structure with a string date.
+type yamlDocumentMeta struct {
+	Title     string   `yaml:"title"`
+	Number    string   `yaml:"number"`
+	Adopted   string   `yaml:"date"`
+	Authority string   `yaml:"authority"`
+	Status    string   `yaml:"status"`
+	Tags      []string `yaml:"tags"`
+	Summary   string   `yaml:"summary"`
+}
+
+func (ym yamlDocumentMeta) parse() (DocumentMeta, error) {
+	meta := DocumentMeta{
+		Title:     strings.TrimSpace(ym.Title),
+		Number:    strings.TrimSpace(ym.Number),
+		Authority: strings.TrimSpace(ym.Authority),
+		Status:    strings.ToLower(strings.TrimSpace(ym.Status)),
+		Tags:      ym.Tags,
+		Summary:   strings.TrimSpace(ym.Summary),
+	}
+
+	switch meta.Status {
+	case "", docStatusActive, docStatusRepealed:
+	default:
+		return meta, fmt.Errorf("invalid status %q (expected %s or %s)", ym.Status, docStatusActive, docStatusRepealed)
+	}
+
+	if ym.Adopted != "" {
+		var err error
+		for _, layout := range metaDateLayouts {
+			if meta.Adopted, err = time.Parse(layout, strings.TrimSpace(ym.Adopted)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return meta, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or DD.MM.YYYY)", ym.Adopted)
+		}
+	}
+
+	return meta, nil
+}
+
+// Reference возвращает реквизиты документа одной строкой,
+// например "ФТС России · № 123 от 15.01.2025".
+func (m DocumentMeta) Reference() string {
+	var parts []string
+	if m.Authority != "" {
+		parts = append(parts, m.Authority)
+	}
+
+	var number string
+	if m.Number != "" {
+		number = "№ " + m.Number
+	}
+	if !m.Adopted.IsZero() {
+		number = strings.TrimSpace(number + " от " + m.Adopted.Format("02.01.2006"))
+	}
+	if number != "" {
+		parts = append(parts, number)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// Repealed сообщает, что документ утратил силу.
+func (m DocumentMeta) Repealed() bool {
+	return m.Status == docStatusRepealed
+}
+
+// dirMetadata - описания документов одной директории, ключ - имя файла в нижнем регистре.
+type dirMetadata map[string]DocumentMeta
+
+// loadDirMetadata читает meta.yaml и все файлы-спутники <file>.yaml в директории.
+// Ошибки в отдельных файлах логируются и не прерывают сканирование.
+func loadDirMetadata(dir string) dirMetadata {
+	result := make(dirMetadata)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Error reading metadata in %s: %v", dir, err)
+		return result
+	}
+
+	// Сначала общий meta.yaml, чтобы файлы-спутники могли его перекрыть.
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(e.Name(), dirMetaFileName) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		var all map[string]yamlDocumentMeta
+		if err := readYAMLFile(path, &all); err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			continue
+		}
+		for name, ym := range all {
+			meta, err := ym.parse()
+			if err != nil {
+				log.Printf("Error in %s for %s: %v", path, name, err)
+				continue
+			}
+			result[strings.ToLower(name)] = meta
+		}
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.EqualFold(name, dirMetaFileName) || !strings.HasSuffix(strings.ToLower(name), sidecarSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		var ym yamlDocumentMeta
+		if err := readYAMLFile(path, &ym); err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			continue
+		}
+		meta, err := ym.parse()
+		if err != nil {
+			log.Printf("Error in %s: %v", path, err)
+			continue
+		}
+		docName := name[:len(name)-len(sidecarSuffix)]
+		result[strings.ToLower(docName)] = meta
+	}
+
+	return result
+}
+
+// lookup возвращает описание документа по имени файла.
+func (m dirMetadata) lookup(name string) DocumentMeta {
+	return m[strings.ToLower(name)]
+}
+
+func readYAMLFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, v)
+}
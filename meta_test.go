@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDocRepository_LoadsSidecarMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	hrDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(hrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"prikaz_123_final2.pdf": "pdf",
+		"vacation.pdf":          "pdf",
+		"old.pdf":               "pdf",
+		"plain.pdf":             "pdf",
+		// Per-file sidecar.
+		"prikaz_123_final2.pdf.yaml": `
+title: "О порядке приёма на службу"
+number: "123-к"
+date: 2025-01-15
+authority: "Мурманская таможня"
+status: active
+tags: [кадры, приём]
+summary: "Порядок оформления вновь принятых сотрудников"
+`,
+		// Per-directory metadata.
+		"meta.yaml": `
+vacation.pdf:
+  title: "График отпусков"
+  date: "20.12.2024"
+old.pdf:
+  title: "Архивный приказ"
+  status: repealed
+prikaz_123_final2.pdf:
+  title: "Будет перекрыто файлом-спутником"
+plain.pdf:
+  title: "Неверный статус"
+  status: unknown
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(hrDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+	if len(sections) != 1 {
+		t.Fatalf("expected 1 section, got %d", len(sections))
+	}
+
+	docs := sections[0].Documents
+	if len(docs) != 4 {
+		t.Fatalf("expected 4 documents (sidecars are not documents), got %d", len(docs))
+	}
+
+	byName := make(map[string]Document)
+	for _, d := range docs {
+		byName[d.Name] = d
+	}
+
+	prikaz := byName["prikaz_123_final2.pdf"]
+	if prikaz.Title != "О порядке приёма на службу" {
+		t.Errorf("sidecar must override meta.yaml, got title %q", prikaz.Title)
+	}
+	if prikaz.Number != "123-к" || prikaz.Authority != "Мурманская таможня" || prikaz.Status != docStatusActive {
+		t.Errorf("unexpected metadata: %+v", prikaz.DocumentMeta)
+	}
+	if !prikaz.Adopted.Equal(time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected adoption date: %s", prikaz.Adopted)
+	}
+	if len(prikaz.Tags) != 2 || prikaz.Summary == "" {
+		t.Errorf("expected tags and summary, got %+v", prikaz.DocumentMeta)
+	}
+	if got, want := prikaz.Reference(), "Мурманская таможня · № 123-к от 15.01.2025"; got != want {
+		t.Errorf("Reference: expected %q, got %q", want, got)
+	}
+
+	vacation := byName["vacation.pdf"]
+	if vacation.DisplayName() != "График отпусков" || vacation.Adopted.Day() != 20 {
+		t.Errorf("unexpected meta.yaml metadata: %+v", vacation.DocumentMeta)
+	}
+
+	if !byName["old.pdf"].Repealed() {
+		t.Errorf("expected old.pdf to be repealed")
+	}
+
+	// Invalid metadata is ignored, the document falls back to its file name.
+	if plain := byName["plain.pdf"]; plain.DisplayName() != "plain.pdf" {
+		t.Errorf("expected invalid metadata to be ignored, got %+v", plain.DocumentMeta)
+	}
+
+	// Documents are sorted by display name, not by file name.
+	var order []string
+	for _, d := range docs {
+		order = append(order, d.Name)
+	}
+	want := []string{"plain.pdf", "old.pdf", "vacation.pdf", "prikaz_123_final2.pdf"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected documents sorted by title %v, got %v", want, order)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Метрики в текстовом формате Prometheus (GET /metrics). Клиентская библиотека
+// Prometheus не используется: нужны только счётчики, гистограммы и значения.
+
+// Границы корзин гистограмм, в секундах.
+var (
+	requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	scanDurationBuckets    = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120}
+)
+
+// metrics - метрики сервера. Глобальные, как и accessLog: их пишут middleware,
+// DocRepository и rotatingWriter, которые ничего не знают друг о друге.
+var metrics = newServerMetrics()
+
+type serverMetrics struct {
+	requests        *counterVec
+	requestDuration *histogramVec
+	scans           *counterVec
+	scanDuration    *histogramVec
+	documents       *gaugeVec
+	sections        *gaugeVec
+	cache           *counterVec
+	logRotations    *counterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: newCounterVec("docsrv_http_requests_total",
+			"HTTP requests by route and status.", "route", "status"),
+		requestDuration: newHistogramVec("docsrv_http_request_duration_seconds",
+			"HTTP request latency by route and status.", requestDurationBuckets, "route", "status"),
+		scans: newCounterVec("docsrv_scans_total",
+			"Docs directory scans by result.", "result"),
+		scanDuration: newHistogramVec("docsrv_scan_duration_seconds",
+			"Docs directory scan duration.", scanDurationBuckets),
+		documents: newGaugeVec("docsrv_documents",
+			"Documents found by the last successful scan."),
+		sections: newGaugeVec("docsrv_sections",
+			"Sections found by the last successful scan."),
+		cache: newCounterVec("docsrv_cache_requests_total",
+			"Document tree lookups: fresh cache (hit), outdated cache served while it is rescanned (stale), waiting for a scan (miss).", "result"),
+		logRotations: newCounterVec("docsrv_log_rotations_total",
+			"Log file rotations.", "file"),
+	}
+}
+
+// observeRequest учитывает обработанный HTTP-запрос.
+func (m *serverMetrics) observeRequest(route string, status int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	s := strconv.Itoa(status)
+	m.requests.add(1, route, s)
+	m.requestDuration.observe(d.Seconds(), route, s)
+}
+
+// observeScan учитывает сканирование каталога; res - nil при ошибке.
+func (m *serverMetrics) observeScan(res *scanResult, d time.Duration) {
+	m.scanDuration.observe(d.Seconds())
+	if res == nil {
+		m.scans.add(1, "error")
+		return
+	}
+	m.scans.add(1, "ok")
+
+	docs := 0
+	for _, s := range res.sections {
+		docs += len(s.Documents)
+	}
+	m.documents.set(float64(docs))
+	m.sections.set(float64(len(res.sections)))
+}
+
+func (m *serverMetrics) writeTo(w io.Writer) error {
+	for _, c := range []interface{ write(io.Writer) error }{
+		m.requests, m.requestDuration, m.scans, m.scanDuration,
+		m.documents, m.sections, m.cache, m.logRotations,
+	} {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlMetricsConfig - секция metrics в config.yaml.
+type yamlMetricsConfig struct {
+	// Public открывает /metrics без входа, например для Prometheus без учётной записи.
+	Public bool `yaml:"public"`
+}
+
+// metricsHandler отдаёт метрики: GET /metrics.
+func metricsHandler(m *serverMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.writeTo(w)
+	})
+}
+
+// routeMiddleware записывает шаблон маршрута ServeMux ("GET /view/{path...}")
+// в requestInfo для метрик и access-лога. Шаблон вычисляется до аутентификации,
+// чтобы запросы, отклонённые ею, учитывались под своим маршрутом, а не как "unmatched".
+func routeMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := requestInfoFrom(r.Context()); info != nil {
+			_, info.Route = mux.Handler(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricVec - общая часть метрик с метками: значения по набору значений меток.
+type metricVec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*T
+	// keys - значения меток для каждого ключа values.
+	keys map[string][]string
+}
+
+func newMetricVec[T any](name, help, kind string, labels []string) metricVec[T] {
+	return metricVec[T]{name: name, help: help, kind: kind, labels: labels,
+		values: make(map[string]*T), keys: make(map[string][]string)}
+}
+
+// get возвращает значение для набора меток, создавая его при необходимости.
+// Должна вызываться под v.mu.
+func (v *metricVec[T]) get(create func() *T, lvs []string) *T {
+	key := strings.Join(lvs, "\xff")
+	val, ok := v.values[key]
+	if !ok {
+		val = create()
+		v.values[key] = val
+		v.keys[key] = append([]string(nil), lvs...)
+	}
+	return val
+}
+
+// each вызывает fn для всех наборов меток по порядку. Должна вызываться под v.mu.
+func (v *metricVec[T]) each(fn func(labels string, val *T) error) error {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(formatLabels(v.labels, v.keys[k]), v.values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *metricVec[T]) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	return err
+}
+
+func newFloat() *float64 { return new(float64) }
+
+// counterVec - счётчик с метками.
+type counterVec struct{ metricVec[float64] }
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{newMetricVec[float64](name, help, "counter", labels)}
+}
+
+func (c *counterVec) add(delta float64, lvs ...string) {
+	c.mu.Lock()
+	*c.get(newFloat, lvs) += delta
+	c.mu.Unlock()
+}
+
+// value возвращает текущее значение счётчика (для тестов и отладки).
+func (c *counterVec) value(lvs ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.values[strings.Join(lvs, "\xff")]; ok {
+		return *v
+	}
+	return 0
+}
+
+func (c *counterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	return c.each(func(labels string, v *float64) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatValue(*v))
+		return err
+	})
+}
+
+// gaugeVec - текущее значение с метками.
+type gaugeVec struct{ metricVec[float64] }
+
+func newGaugeVec(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{newMetricVec[float64](name, help, "gauge", labels)}
+}
+
+func (g *gaugeVec) set(value float64, lvs ...string) {
+	g.mu.Lock()
+	*g.get(newFloat, lvs) = value
+	g.mu.Unlock()
+}
+
+func (g *gaugeVec) write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	return g.each(func(labels string, v *float64) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatValue(*v))
+		return err
+	})
+}
+
+// histogramVec - гистограмма с метками.
+type histogramVec struct {
+	metricVec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	// counts[i] - число наблюдений <= buckets[i] (не накопительно).
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{metricVec: newMetricVec[histogram](name, help, "histogram", labels), buckets: buckets}
+}
+
+func (h *histogramVec) observe(value float64, lvs ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist := h.get(func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} }, lvs)
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.count++
+	hist.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	return h.each(func(labels string, hist *histogram) error {
+		// Метка le добавляется к остальным: {route="/",le="0.5"}.
+		withLE := func(le string) string {
+			if labels == "" {
+				return `{le="` + le + `"}`
+			}
+			return labels[:len(labels)-1] + `,le="` + le + `"}`
+		}
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += hist.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLE(formatValue(b)), cumulative); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, withLE("+Inf"), hist.count,
+			h.name, labels, formatValue(hist.sum),
+			h.name, labels, hist.count)
+		return err
+	})
+}
+
+// formatLabels возвращает метки в виде {a="1",b="2"} ("" без меток).
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func metricsText(t *testing.T, m *serverMetrics) string {
+	t.Helper()
+	var b strings.Builder
+	if err := m.writeTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestServerMetrics_TextFormat(t *testing.T) {
+	m := newServerMetrics()
+	m.observeRequest("GET /view/{path...}", http.StatusOK, 30*time.Millisecond)
+	m.observeRequest("GET /view/{path...}", http.StatusOK, 2*time.Second)
+	m.observeRequest("", http.StatusNotFound, time.Millisecond)
+	m.logRotations.add(1, `odd "name".log`)
+
+	text := metricsText(t, m)
+	for _, want := range []string{
+		"# TYPE docsrv_http_requests_total counter\n",
+		`docsrv_http_requests_total{route="GET /view/{path...}",status="200"} 2` + "\n",
+		`docsrv_http_requests_total{route="unmatched",status="404"} 1` + "\n",
+		"# TYPE docsrv_http_request_duration_seconds histogram\n",
+		`docsrv_http_request_duration_seconds_bucket{route="GET /view/{path...}",status="200",le="0.025"} 0` + "\n",
+		`docsrv_http_request_duration_seconds_bucket{route="GET /view/{path...}",status="200",le="0.05"} 1` + "\n",
+		`docsrv_http_request_duration_seconds_bucket{route="GET /view/{path...}",status="200",le="2.5"} 2` + "\n",
+		`docsrv_http_request_duration_seconds_bucket{route="GET /view/{path...}",status="200",le="+Inf"} 2` + "\n",
+		`docsrv_http_request_duration_seconds_sum{route="GET /view/{path...}",status="200"} 2.03` + "\n",
+		`docsrv_http_request_duration_seconds_count{route="GET /view/{path...}",status="200"} 2` + "\n",
+		`docsrv_log_rotations_total{file="odd \"name\".log"} 1` + "\n",
+		// Metrics without observations are still described.
+		"# TYPE docsrv_scan_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in metrics output:\n%s", want, text)
+		}
+	}
+}
+
+func TestLoggingMiddleware_CountsRequestsByRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /view/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	})
+	// A middleware that answers before the mux (like auth) still gets the route.
+	deny := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("deny") {
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	h := loggingMiddleware(routeMiddleware(mux, deny))
+	accessLog = nil
+
+	route := "GET /view/{path...}"
+	ok, denied, unmatched := metrics.requests.value(route, "200"), metrics.requests.value(route, "401"),
+		metrics.requests.value("unmatched", "404")
+
+	for _, target := range []string{"/view/a.md", "/view/b.md", "/view/a.md?deny", "/other"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	if got := metrics.requests.value(route, "200") - ok; got != 2 {
+		t.Errorf("expected 2 successful view requests, got %v", got)
+	}
+	if got := metrics.requests.value(route, "401") - denied; got != 1 {
+		t.Errorf("expected 1 denied view request, got %v", got)
+	}
+	if got := metrics.requests.value("unmatched", "404") - unmatched; got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+}
+
+func TestDocRepository_Metrics(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pdf", "HR/b.pdf", "HR/c.pdf"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, misses, scans := metrics.cache.value("hit"), metrics.cache.value("miss"), metrics.scans.value("ok")
+
+	repo := NewDocRepository(dir, time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := repo.GetSections(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := metrics.cache.value("miss") - misses; got != 1 {
+		t.Errorf("expected 1 cache miss, got %v", got)
+	}
+	if got := metrics.cache.value("hit") - hits; got != 2 {
+		t.Errorf("expected 2 cache hits, got %v", got)
+	}
+	if got := metrics.scans.value("ok") - scans; got < 1 {
+		t.Errorf("expected a successful scan, got %v", got)
+	}
+	text := metricsText(t, metrics)
+	if !strings.Contains(text, "docsrv_documents 3\n") || !strings.Contains(text, "docsrv_sections 2\n") {
+		t.Errorf("expected document and section counts in metrics:\n%s", text)
+	}
+}
+
+func TestDocRepository_StaleMetric(t *testing.T) {
+	repo := NewDocRepository(t.TempDir(), time.Hour)
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	hits, stale := metrics.cache.value("hit"), metrics.cache.value("stale")
+
+	// An outdated tree is served at once while it is rescanned, but it is not a hit.
+	repo.mu.Lock()
+	repo.lastAttempt = time.Now().Add(-2 * time.Hour)
+	repo.mu.Unlock()
+	if _, err := repo.GetSections(); err != nil {
+		t.Fatal(err)
+	}
+	if got := metrics.cache.value("stale") - stale; got != 1 {
+		t.Errorf("expected 1 stale lookup, got %v", got)
+	}
+	if got := metrics.cache.value("hit") - hits; got != 0 {
+		t.Errorf("expected no cache hits, got %v", got)
+	}
+
+	// Once the rescan has finished, the cache is fresh again.
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetSections(); err != nil {
+		t.Fatal(err)
+	}
+	if got := metrics.cache.value("hit") - hits; got != 1 {
+		t.Errorf("expected 1 cache hit after the rescan, got %v", got)
+	}
+}
+
+func TestRotatingWriter_CountsRotations(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rotation-metrics.log")
+	rw, err := newRotatingWriter(filename, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	// The second write does not fit and rotates the file.
+	for i := 0; i < 2; i++ {
+		if _, err := rw.Write([]byte("1234567890")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := metrics.logRotations.value("rotation-metrics.log"); got != 1 {
+		t.Errorf("expected 1 rotation, got %v", got)
+	}
+}
+
+func TestMetricsHandler_RequiresLoginUnlessPublic(t *testing.T) {
+	for _, mode := range []string{authModeOptional, authModeRequired} {
+		for _, public := range []bool{false, true} {
+			a := &authenticator{mode: mode, sessions: newSessionStore(time.Hour), publicMetrics: public}
+			mux := http.NewServeMux()
+			mux.Handle("GET /metrics", metricsHandler(newServerMetrics()))
+			h := a.Middleware(mux)
+
+			rec := doRequest(h, http.MethodGet, "/metrics", nil)
+			want := http.StatusUnauthorized
+			if public {
+				want = http.StatusOK
+			}
+			if rec.Code != want {
+				t.Errorf("mode %s, public %v: anonymous /metrics returned %d, want %d", mode, public, rec.Code, want)
+			}
+
+			sid, _, err := a.sessions.Create(&User{Name: "ivanov"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec = doRequest(h, http.MethodGet, "/metrics", nil, &http.Cookie{Name: sessionCookieName, Value: sid})
+			if rec.Code != http.StatusOK {
+				t.Errorf("mode %s, public %v: signed-in /metrics returned %d", mode, public, rec.Code)
+			}
+		}
+	}
+}
+
+func TestLoadConfig_MetricsPublic(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MetricsPublic {
+		t.Fatal("expected /metrics to require login by default")
+	}
+	if err := os.WriteFile(cfgPath, []byte("metrics:\n  public: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = LoadConfig(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.MetricsPublic {
+		t.Fatal("expected metrics.public to be applied")
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Адреса входа через OpenID Connect.
+const (
+	oidcLoginPath    = "/oidc/login"
+	oidcCallbackPath = "/oidc/callback"
+)
+
+// oidcStateTTL - сколько ждать возврата пользователя со страницы входа провайдера.
+const oidcStateTTL = 10 * time.Minute
+
+// maxOIDCStates - сколько незавершённых входов хранится одновременно: /oidc/login
+// открыт без входа, и без ограничения его запросы заняли бы всю память.
+const maxOIDCStates = 10000
+
+// oidcStateCookieName - cookie со state незавершённого входа. Она привязывает
+// возврат от провайдера к браузеру, который начал вход: иначе чужую ссылку
+// /oidc/callback с кодом и state можно подсунуть жертве, и та войдёт под
+// учётной записью злоумышленника (login CSRF).
+const oidcStateCookieName = "docsrv_oidc_state"
+
+// OIDCConfig - вход через OpenID Connect (Keycloak и т.п.) по схеме
+// authorization code + PKCE.
+type OIDCConfig struct {
+	// Issuer - адрес провайдера, например "https://sso.example.local/realms/corp".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL - полный адрес /oidc/callback этого сервера, как он зарегистрирован у провайдера.
+	RedirectURL string
+	// Name - название провайдера на кнопке входа.
+	Name   string
+	Scopes []string
+
+	// Из каких утверждений (claims) ID-токена брать логин, ФИО и группы.
+	// Путь к вложенному утверждению записывается через точку: "realm_access.roles".
+	UsernameClaim    string
+	DisplayNameClaim string
+	GroupsClaim      string
+	// GroupMap переименовывает группы из токена в группы правил доступа
+	// ("/Отдел кадров" -> "HR"). Группы, которых нет в GroupMap, берутся как есть.
+	GroupMap map[string]string
+
+	Timeout time.Duration
+}
+
+// yamlOIDCConfig mirrors auth.oidc in config.yaml.
+type yamlOIDCConfig struct {
+	Issuer           string            `yaml:"issuer"`
+	ClientID         string            `yaml:"client_id"`
+	ClientSecret     string            `yaml:"client_secret"`
+	RedirectURL      string            `yaml:"redirect_url"`
+	Name             string            `yaml:"name"`
+	Scopes           []string          `yaml:"scopes"`
+	UsernameClaim    string            `yaml:"username_claim"`
+	DisplayNameClaim string            `yaml:"display_name_claim"`
+	GroupsClaim      string            `yaml:"groups_claim"`
+	GroupMap         map[string]string `yaml:"group_map"`
+	Timeout          string            `yaml:"timeout"`
+}
+
+func parseOIDCConfig(y yamlOIDCConfig) (OIDCConfig, error) {
+	cfg := OIDCConfig{
+		Issuer:           strings.TrimSuffix(y.Issuer, "/"),
+		ClientID:         y.ClientID,
+		ClientSecret:     y.ClientSecret,
+		RedirectURL:      y.RedirectURL,
+		Name:             y.Name,
+		Scopes:           y.Scopes,
+		UsernameClaim:    y.UsernameClaim,
+		DisplayNameClaim: y.DisplayNameClaim,
+		GroupsClaim:      y.GroupsClaim,
+		GroupMap:         y.GroupMap,
+		Timeout:          10 * time.Second,
+	}
+	if cfg.Name == "" {
+		cfg.Name = "OpenID Connect"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.DisplayNameClaim == "" {
+		cfg.DisplayNameClaim = "name"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if y.Timeout != "" {
+		d, err := parseDurationField("auth.oidc.timeout", y.Timeout)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Timeout = d
+	}
+
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, fmt.Errorf("auth.oidc: issuer, client_id and redirect_url are required")
+	}
+	if u, err := url.Parse(cfg.RedirectURL); err != nil || !u.IsAbs() {
+		return cfg, fmt.Errorf("auth.oidc: redirect_url must be an absolute URL: %q", cfg.RedirectURL)
+	}
+	return cfg, nil
+}
+
+// oidcState - незавершённый вход: что запомнить до возврата пользователя от провайдера.
+type oidcState struct {
+	verifier string
+	nonce    string
+	next     string
+	expires  time.Time
+}
+
+// oidcAuthenticator выполняет вход через провайдера OpenID Connect.
+type oidcAuthenticator struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu sync.Mutex
+	// provider - результат discovery; запрашивается при первом входе, а не при старте,
+	// чтобы недоступность провайдера не мешала запуску сервера.
+	provider *oidc.Provider
+	states   map[string]oidcState
+}
+
+func newOIDCAuthenticator(cfg OIDCConfig) *oidcAuthenticator {
+	return &oidcAuthenticator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		states: make(map[string]oidcState),
+	}
+}
+
+// discover возвращает настройки провайдера, при необходимости запрашивая их.
+// Запрос к провайдеру идёт без блокировки: пока он ждёт тайм-аута, остальные
+// входы и проверка state не должны стоять. Неудачный запрос не запоминается,
+// следующий вход повторит его.
+func (o *oidcAuthenticator) discover(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	p := o.provider
+	o.mu.Unlock()
+	if p != nil {
+		return p, nil
+	}
+
+	p, err := oidc.NewProvider(oidc.ClientContext(ctx, o.client), o.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", o.cfg.Issuer, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Параллельные первые входы могли запросить провайдера одновременно: остаётся первый результат.
+	if o.provider == nil {
+		o.provider = p
+	}
+	return o.provider, nil
+}
+
+func (o *oidcAuthenticator) oauth2Config(p *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		RedirectURL:  o.cfg.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       o.cfg.Scopes,
+	}
+}
+
+// saveState запоминает незавершённый вход и возвращает его ключ (параметр state).
+func (o *oidcAuthenticator) saveState(st oidcState) (string, error) {
+	key, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for k, s := range o.states {
+		if now.After(s.expires) {
+			delete(o.states, k)
+		}
+	}
+	// При переполнении вытесняем самый старый вход: пользователь, не успевший
+	// вернуться, просто начнёт вход заново.
+	if len(o.states) >= maxOIDCStates {
+		var oldest string
+		for k, s := range o.states {
+			if oldest == "" || s.expires.Before(o.states[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(o.states, oldest)
+	}
+	st.expires = now.Add(oidcStateTTL)
+	o.states[key] = st
+	return key, nil
+}
+
+// takeState возвращает и удаляет незавершённый вход: каждый state используется один раз.
+func (o *oidcAuthenticator) takeState(key string) (oidcState, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	st, ok := o.states[key]
+	delete(o.states, key)
+	if !ok || time.Now().After(st.expires) {
+		return oidcState{}, false
+	}
+	return st, true
+}
+
+// authCodeURL начинает вход: возвращает адрес страницы входа провайдера и state.
+func (o *oidcAuthenticator) authCodeURL(ctx context.Context, next string) (string, string, error) {
+	p, err := o.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+	state, err := o.saveState(oidcState{verifier: verifier, nonce: nonce, next: next})
+	if err != nil {
+		return "", "", err
+	}
+	return o.oauth2Config(p).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), state, nil
+}
+
+// errOIDCState - пользователь вернулся с неизвестным или просроченным state.
+var errOIDCState = errors.New("unknown or expired oidc state")
+
+// exchange завершает вход: обменивает код на ID-токен, проверяет его и возвращает
+// пользователя и адрес, куда его вернуть.
+func (o *oidcAuthenticator) exchange(ctx context.Context, state, code string) (*User, string, error) {
+	st, ok := o.takeState(state)
+	if !ok {
+		return nil, "", errOIDCState
+	}
+	p, err := o.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, o.client)
+	token, err := o.oauth2Config(p).Exchange(ctx, code, oauth2.VerifierOption(st.verifier))
+	if err != nil {
+		return nil, "", fmt.Errorf("oidc code exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, "", fmt.Errorf("oidc token response has no id_token")
+	}
+	idToken, err := p.VerifierContext(oidc.ClientContext(ctx, o.client), &oidc.Config{ClientID: o.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("oidc id_token: %w", err)
+	}
+	if idToken.Nonce != st.nonce {
+		return nil, "", fmt.Errorf("oidc id_token nonce mismatch")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", fmt.Errorf("oidc id_token claims: %w", err)
+	}
+	u, err := o.userFromClaims(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, st.next, nil
+}
+
+// userFromClaims строит пользователя по утверждениям ID-токена.
+func (o *oidcAuthenticator) userFromClaims(claims map[string]any) (*User, error) {
+	name, _ := claimValue(claims, o.cfg.UsernameClaim).(string)
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, fmt.Errorf("oidc id_token has no %q claim", o.cfg.UsernameClaim)
+	}
+	displayName, _ := claimValue(claims, o.cfg.DisplayNameClaim).(string)
+
+	var groups []string
+	seen := make(map[string]bool)
+	add := func(g string) {
+		if mapped, ok := o.cfg.GroupMap[g]; ok {
+			g = mapped
+		}
+		if g != "" && !seen[strings.ToLower(g)] {
+			seen[strings.ToLower(g)] = true
+			groups = append(groups, g)
+		}
+	}
+	switch v := claimValue(claims, o.cfg.GroupsClaim).(type) {
+	case string:
+		add(v)
+	case []any:
+		for _, item := range v {
+			if g, ok := item.(string); ok {
+				add(g)
+			}
+		}
+	}
+
+	return &User{Name: name, DisplayName: displayName, Groups: groups}, nil
+}
+
+// claimValue возвращает утверждение по пути через точку ("realm_access.roles").
+func claimValue(claims map[string]any, path string) any {
+	var v any = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// oidcLoginHandler отправляет пользователя на страницу входа провайдера: GET /oidc/login?next=...
+func (a *authenticator) oidcLoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, state, err := a.oidc.authCodeURL(r.Context(), safeNext(r.URL.Query().Get("next")))
+		if err != nil {
+			log.Printf("OIDC login error: %v", err)
+			http.Error(w, "Identity provider is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		// Lax: cookie уходит при возврате от провайдера (переход по ссылке верхнего уровня).
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookieName,
+			Value:    state,
+			Path:     "/",
+			MaxAge:   int(oidcStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   requestScheme(r) == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// oidcCallbackHandler принимает пользователя обратно от провайдера: GET /oidc/callback?code=...&state=...
+func (a *authenticator) oidcCallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		// Вход завершается (или отменяется) один раз, cookie больше не нужна.
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+		if c, err := r.Cookie(oidcStateCookieName); err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(q.Get("state"))) != 1 {
+			// Вход начат в другом браузере: не входим, а начинаем вход заново.
+			log.Printf("OIDC login from %s: state does not match the browser that started the login", r.RemoteAddr)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			// Например, пользователь отказался входить на странице провайдера.
+			log.Printf("OIDC provider returned error %q: %s", e, q.Get("error_description"))
+			a.oidc.takeState(q.Get("state"))
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		u, next, err := a.oidc.exchange(r.Context(), q.Get("state"), q.Get("code"))
+		if err != nil {
+			log.Printf("OIDC login failed from %s: %v", r.RemoteAddr, err)
+			if errors.Is(err, errOIDCState) {
+				// Устаревшая вкладка или повторное открытие ссылки - просто начинаем вход заново.
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Login failed", http.StatusUnauthorized)
+			return
+		}
+
+		if err := a.startSession(w, r, u); err != nil {
+			log.Printf("Error creating session: %v", err)
+			http.Error(w, "Login failed", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	})
+}
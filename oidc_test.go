@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier. The authorization step is played by
+// the test itself via authorize.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, codes: make(map[string]mockCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/auth",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		c, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != c.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     m.sign(c.claims),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// sign creates an RS256 JWT.
+func (m *mockIssuer) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the provider's login page: it checks the authorization request
+// and returns the callback URL with a code for the given user claims.
+func (m *mockIssuer) authorize(authURL string, claims map[string]any) string {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/auth?") || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		m.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	full := map[string]any{
+		"iss":   m.server.URL,
+		"aud":   q.Get("client_id"),
+		"sub":   "user-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	code := "code-" + q.Get("state")
+	m.mu.Lock()
+	m.codes[code] = mockCode{challenge: q.Get("code_challenge"), claims: full}
+	m.mu.Unlock()
+
+	return q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+}
+
+func newOIDCTestServer(t *testing.T, issuer *mockIssuer) http.Handler {
+	t.Helper()
+	cfg, err := parseOIDCConfig(yamlOIDCConfig{
+		Issuer:      issuer.server.URL,
+		ClientID:    "doc-srv",
+		RedirectURL: "https://docs.example.local/oidc/callback",
+		Name:        "Keycloak",
+		GroupMap:    map[string]string{"/Отдел кадров": "HR"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &authenticator{mode: authModeRequired, sessions: newSessionStore(time.Hour), oidc: newOIDCAuthenticator(cfg)}
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", a.loginHandler(testPageTemplate(t, "login.html")))
+	mux.Handle("GET "+oidcLoginPath, a.oidcLoginHandler())
+	mux.Handle("GET "+oidcCallbackPath, a.oidcCallbackHandler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		u := userFromRequest(r)
+		w.Write([]byte(u.Name + "|" + u.DisplayName + "|" + strings.Join(u.Groups, ",")))
+	})
+	return a.Middleware(mux)
+}
+
+func TestAuthenticator_OIDCLoginFlow(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h := newOIDCTestServer(t, issuer)
+
+	// With OIDC as the only provider the login page goes straight to it.
+	rec := doRequest(h, http.MethodGet, "/login?next=%2FHR", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/oidc/login?next=%2FHR" {
+		t.Fatalf("expected redirect to OIDC login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = doRequest(h, http.MethodGet, "/oidc/login?next=%2FHR", nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected redirect to the provider, got %d: %s", rec.Code, rec.Body.String())
+	}
+	state := findCookie(rec, oidcStateCookieName)
+	if state == nil || !state.HttpOnly || state.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expected HttpOnly SameSite=Lax state cookie, got %+v", rec.Result().Cookies())
+	}
+	callback := issuer.authorize(rec.Header().Get("Location"), map[string]any{
+		"preferred_username": "Petrov",
+		"name":               "Петров П.П.",
+		"groups":             []string{"/Отдел кадров", "Bookkeeping"},
+	})
+
+	rec = doRequest(h, http.MethodGet, strings.TrimPrefix(callback, "https://docs.example.local"), nil, state)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/HR" {
+		t.Fatalf("expected redirect after login, got %d %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+	session := findCookie(rec, sessionCookieName)
+	if session == nil {
+		t.Fatalf("expected session cookie, got %+v", rec.Result().Cookies())
+	}
+	if c := findCookie(rec, oidcStateCookieName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("expected the state cookie to be cleared, got %+v", c)
+	}
+	if rec := doRequest(h, http.MethodGet, "/", nil, session); rec.Body.String() != "petrov|Петров П.П.|HR,Bookkeeping" {
+		t.Fatalf("unexpected user: %q", rec.Body.String())
+	}
+
+	// The same state cannot be used twice.
+	rec = doRequest(h, http.MethodGet, strings.TrimPrefix(callback, "https://docs.example.local"), nil, state)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("expected replayed callback to restart login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAuthenticator_OIDCRejectsForeignToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h := newOIDCTestServer(t, issuer)
+
+	rec := doRequest(h, http.MethodGet, "/oidc/login", nil)
+	state := findCookie(rec, oidcStateCookieName)
+	// An ID token issued for another nonce (e.g. injected from another login) is rejected.
+	callback := issuer.authorize(rec.Header().Get("Location"), map[string]any{
+		"preferred_username": "petrov",
+		"nonce":              "other",
+	})
+	rec = doRequest(h, http.MethodGet, strings.TrimPrefix(callback, "https://docs.example.local"), nil, state)
+	if rec.Code != http.StatusUnauthorized || findCookie(rec, sessionCookieName) != nil {
+		t.Fatalf("expected login to fail, got %d %+v", rec.Code, rec.Result().Cookies())
+	}
+
+	// A token without the username claim is rejected too.
+	rec = doRequest(h, http.MethodGet, "/oidc/login", nil)
+	state = findCookie(rec, oidcStateCookieName)
+	callback = issuer.authorize(rec.Header().Get("Location"), map[string]any{"name": "Без логина"})
+	rec = doRequest(h, http.MethodGet, strings.TrimPrefix(callback, "https://docs.example.local"), nil, state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected login to fail without username, got %d", rec.Code)
+	}
+}
+
+func TestAuthenticator_OIDCStateIsBoundToBrowser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	h := newOIDCTestServer(t, issuer)
+
+	// The attacker starts a login and completes it at the provider with their
+	// own account, then makes the victim's browser open the callback.
+	rec := doRequest(h, http.MethodGet, "/oidc/login", nil)
+	callback := strings.TrimPrefix(issuer.authorize(rec.Header().Get("Location"), map[string]any{"preferred_username": "attacker"}), "https://docs.example.local")
+
+	// The victim has no state cookie, or one from their own login.
+	victim := doRequest(h, http.MethodGet, "/oidc/login", nil)
+	for _, cookies := range [][]*http.Cookie{nil, {findCookie(victim, oidcStateCookieName)}} {
+		rec = doRequest(h, http.MethodGet, callback, nil, cookies...)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+			t.Errorf("cookies %+v: expected login to restart, got %d %q", cookies, rec.Code, rec.Header().Get("Location"))
+		}
+		if findCookie(rec, sessionCookieName) != nil {
+			t.Errorf("cookies %+v: session started for a foreign login", cookies)
+		}
+	}
+}
+
+func TestOIDCAuthenticator_StatesAreLimited(t *testing.T) {
+	o := newOIDCAuthenticator(OIDCConfig{})
+	first, err := o.saveState(oidcState{next: "/first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxOIDCStates; i++ {
+		if _, err := o.saveState(oidcState{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(o.states) != maxOIDCStates {
+		t.Errorf("expected %d pending logins, got %d", maxOIDCStates, len(o.states))
+	}
+	if _, ok := o.takeState(first); ok {
+		t.Error("expected the oldest pending login to be evicted")
+	}
+}
+
+func TestOIDCAuthenticator_DiscoveryDoesNotHoldLock(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// The first discovery hangs like an unreachable provider and then fails.
+			close(entered)
+			<-release
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/auth",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	}))
+	defer srv.Close()
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+
+	o := newOIDCAuthenticator(OIDCConfig{Issuer: srv.URL, Timeout: 10 * time.Second})
+	done := make(chan error, 1)
+	go func() {
+		_, err := o.discover(t.Context())
+		done <- err
+	}()
+	<-entered
+
+	// Pending logins can still be saved and checked while discovery waits.
+	states := make(chan bool, 1)
+	go func() {
+		key, err := o.saveState(oidcState{next: "/HR"})
+		_, ok := o.takeState(key)
+		states <- err == nil && ok
+	}()
+	select {
+	case ok := <-states:
+		if !ok {
+			t.Error("expected the pending login to be saved and taken")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("login state is blocked by provider discovery")
+	}
+
+	unblock()
+	if err := <-done; err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+	// A failed discovery is not remembered: the next login retries it.
+	if p, err := o.discover(t.Context()); err != nil || p == nil {
+		t.Fatalf("expected discovery to be retried, got %v", err)
+	}
+}
+
+func findCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCAuthenticator_NestedGroupsClaim(t *testing.T) {
+	o := newOIDCAuthenticator(OIDCConfig{
+		UsernameClaim:    "email",
+		DisplayNameClaim: "name",
+		GroupsClaim:      "realm_access.roles",
+		GroupMap:         map[string]string{"doc-admins": "Руководители"},
+	})
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(`{"email":"Ivanov@example.local","realm_access":{"roles":["doc-admins","HR","hr"]}}`), &claims); err != nil {
+		t.Fatal(err)
+	}
+	u, err := o.userFromClaims(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "ivanov@example.local" || strings.Join(u.Groups, ",") != "Руководители,HR" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+}
+
+func TestLoadConfig_OIDC(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+auth:
+  mode: optional
+  oidc:
+    issuer: "https://sso.example.local/realms/corp/"
+    client_id: "doc-srv"
+    redirect_url: "https://docs.example.local/oidc/callback"
+    group_map: { "/HR": "HR" }
+`)
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	o := cfg.Auth.OIDC
+	if o == nil || o.Issuer != "https://sso.example.local/realms/corp" || o.UsernameClaim != "preferred_username" ||
+		o.GroupsClaim != "groups" || len(o.Scopes) != 3 || o.GroupMap["/HR"] != "HR" {
+		t.Fatalf("unexpected oidc config: %+v", o)
+	}
+
+	write(`auth: { mode: required, oidc: { issuer: "https://sso", client_id: "x", redirect_url: "/oidc/callback" } }`)
+	if _, err := LoadConfig(cfgPath); err == nil {
+		t.Errorf("expected error for relative redirect_url")
+	}
+}
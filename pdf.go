@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfInfo - сведения о документе из словаря Info и дерева страниц PDF.
+type pdfInfo struct {
+	Title   string
+	Author  string
+	Created time.Time
+	Pages   int
+}
+
+// pdfData - всё, что извлекается из PDF при сканировании: сведения о документе
+// и текст постранично. size/modTime используются, чтобы не разбирать файл
+// заново при каждом scan(), если он не менялся.
+type pdfData struct {
+	size    int64
+	modTime time.Time
+	info    pdfInfo
+	pages   []string
+}
+
+// readPDF читает сведения о документе и текст каждой страницы PDF-файла.
+// Библиотека разбора PDF на повреждённых файлах может паниковать,
+// поэтому панику перехватываем и возвращаем как обычную ошибку.
+// Если не удалось извлечь текст, сведения о документе всё равно возвращаются.
+func readPDF(path string) (info pdfInfo, pages []string, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			pages = nil
+			err = fmt.Errorf("parse pdf %q: %v", path, rec)
+		}
+	}()
+
+	f, reader, err := pdf.Open(path)
+	if err != nil {
+		return info, nil, fmt.Errorf("open pdf %q: %w", path, err)
+	}
+	defer f.Close()
+
+	info = readPDFInfo(reader)
+
+	fonts := make(map[string]*pdf.Font)
+	pages = make([]string, 0, info.Pages)
+	for i := 1; i <= info.Pages; i++ {
+		p := reader.Page(i)
+		if p.V.IsNull() {
+			pages = append(pages, "")
+			continue
+		}
+		// Шрифты кэшируем между страницами, чтобы не разбирать CMap повторно.
+		for _, name := range p.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := p.Font(name)
+				fonts[name] = &font
+			}
+		}
+		text, err := p.GetPlainText(fonts)
+		if err != nil {
+			return info, nil, fmt.Errorf("extract text from page %d of %q: %w", i, path, err)
+		}
+		pages = append(pages, text)
+	}
+
+	return info, pages, nil
+}
+
+// readPDFInfo читает словарь Info из trailer и число страниц из корня дерева страниц.
+func readPDFInfo(reader *pdf.Reader) (info pdfInfo) {
+	// Повреждённый словарь Info не должен мешать извлечению текста.
+	defer func() {
+		if rec := recover(); rec != nil {
+			info = pdfInfo{}
+		}
+	}()
+
+	info.Pages = reader.NumPage()
+
+	dict := reader.Trailer().Key("Info")
+	info.Title = strings.TrimSpace(dict.Key("Title").Text())
+	info.Author = strings.TrimSpace(dict.Key("Author").Text())
+	if created, err := parsePDFDate(dict.Key("CreationDate").Text()); err == nil {
+		info.Created = created
+	}
+	return info
+}
+
+// pdfDateRe разбирает дату PDF вида "D:20250115103000+03'00'"
+// (все части после года необязательны).
+var pdfDateRe = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:(Z)|([+-])(\d{2})'?(\d{2})?'?)?`)
+
+// parsePDFDate разбирает дату в формате PDF (PDF 32000-1:2008, 7.9.4).
+func parsePDFDate(s string) (time.Time, error) {
+	m := pdfDateRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid pdf date %q", s)
+	}
+
+	num := func(v string, def int) int {
+		if v == "" {
+			return def
+		}
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+
+	loc := time.UTC
+	if m[8] != "" {
+		offset := num(m[9], 0)*3600 + num(m[10], 0)*60
+		if m[8] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+
+	return time.Date(num(m[1], 0), time.Month(num(m[2], 1)), num(m[3], 1),
+		num(m[4], 0), num(m[5], 0), num(m[6], 0), 0, loc), nil
+}
+
+// cachedPDF возвращает данные PDF из кэша прошлого сканирования (prev), если файл
+// не менялся, иначе разбирает его заново. Результат кладётся в next, чтобы
+// кэш после scan() содержал только существующие файлы.
+func cachedPDF(path string, fi os.FileInfo, prev, next map[string]pdfData) pdfData {
+	if cached, ok := prev[path]; ok && cached.size == fi.Size() && cached.modTime.Equal(fi.ModTime()) {
+		next[path] = cached
+		return cached
+	}
+
+	info, pages, err := readPDF(path)
+	if err != nil {
+		log.Printf("Error reading PDF %s: %v", path, err)
+	}
+
+	data := pdfData{size: fi.Size(), modTime: fi.ModTime(), info: info, pages: pages}
+	next[path] = data
+	return data
+}
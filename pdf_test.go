@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadPDF_InfoAndPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order.pdf")
+	// Title is UTF-16BE with BOM ("Приказ"), as real-world PDFs store non-ASCII text.
+	writeTestPDFWithInfo(t, path, []string{"First page", "Second page", "Third page"},
+		"<< /Title <FEFF041F04400438043A04300437> /Author (Ivanov I.I.) /CreationDate (D:20250115103000+03'00') >>")
+
+	info, pages, err := readPDF(path)
+	if err != nil {
+		t.Fatalf("readPDF failed: %v", err)
+	}
+
+	if info.Title != "Приказ" {
+		t.Errorf("Title: expected Приказ, got %q", info.Title)
+	}
+	if info.Author != "Ivanov I.I." {
+		t.Errorf("Author: expected Ivanov I.I., got %q", info.Author)
+	}
+	if info.Pages != 3 || len(pages) != 3 {
+		t.Errorf("expected 3 pages, got info=%d text=%d", info.Pages, len(pages))
+	}
+	want := time.Date(2025, 1, 15, 7, 30, 0, 0, time.UTC)
+	if !info.Created.Equal(want) {
+		t.Errorf("Created: expected %s, got %s", want, info.Created)
+	}
+}
+
+func TestParsePDFDate(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Time
+	}{
+		{"D:20250115103000Z", time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"D:20250115103000-05'00'", time.Date(2025, 1, 15, 15, 30, 0, 0, time.UTC)},
+		{"D:2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"20240229", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := parsePDFDate(c.in)
+		if err != nil {
+			t.Errorf("parsePDFDate(%q) returned error: %v", c.in, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("parsePDFDate(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+
+	if _, err := parsePDFDate("yesterday"); err == nil {
+		t.Errorf("expected error for invalid date")
+	}
+}
+
+func TestDocRepository_PDFInfoInDocument(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestPDFWithInfo(t, filepath.Join(tmpDir, "scan_0001.pdf"), []string{"one", "two"},
+		"<< /Title (Customs rules) /Author (HR department) >>")
+	if err := os.WriteFile(filepath.Join(tmpDir, "broken.pdf"), []byte("not a pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatalf("GetSections failed: %v", err)
+	}
+	if len(sections) != 1 || len(sections[0].Documents) != 2 {
+		t.Fatalf("unexpected sections: %+v", sections)
+	}
+
+	// Sorted by display name: "broken.pdf" < "Customs rules".
+	broken, doc := sections[0].Documents[0], sections[0].Documents[1]
+	if doc.Name != "scan_0001.pdf" || doc.DisplayName() != "Customs rules" {
+		t.Fatalf("expected PDF title as display name, got %q (%s)", doc.DisplayName(), doc.Name)
+	}
+	if doc.Author != "HR department" || doc.Pages != 2 || doc.Size == 0 || doc.ModTime.IsZero() {
+		t.Errorf("unexpected document info: %+v", doc)
+	}
+	if broken.Pages != 0 || broken.DisplayName() != "broken.pdf" {
+		t.Errorf("expected broken PDF without info, got %+v", broken)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		512:             "512 Б",
+		1536:            "1,5 КБ",
+		340 * 1024:      "340 КБ",
+		1258291:         "1,2 МБ",
+		3 * 1024 * 1024: "3,0 МБ",
+	}
+	for size, want := range cases {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// trustedProxies - адреса обратных прокси (IIS, nginx), заголовкам
+// X-Forwarded-For/Forwarded от которых можно верить.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies разбирает trusted_proxies: CIDR ("10.0.0.0/8") или отдельные адреса.
+func parseTrustedProxies(values []string) (trustedProxies, error) {
+	var res trustedProxies
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted_proxies entry: %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted_proxies entry: %q", v)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func (t trustedProxies) contains(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop - один участник цепочки до сервера: адрес и схема, по которой
+// он обратился к следующему.
+type forwardedHop struct {
+	addr  string
+	proto string
+}
+
+// forwardedHops возвращает цепочку из заголовка Forwarded (RFC 7239), а если его
+// нет - из X-Forwarded-For/X-Forwarded-Proto. Первым идёт исходный клиент.
+func forwardedHops(h http.Header) []forwardedHop {
+	var hops []forwardedHop
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, elem := range splitHeaderList(values) {
+			var hop forwardedHop
+			for _, pair := range strings.Split(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					hop.addr = forwardedAddr(value)
+				case "proto":
+					hop.proto = strings.ToLower(value)
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	addrs := splitHeaderList(h.Values("X-Forwarded-For"))
+	protos := splitHeaderList(h.Values("X-Forwarded-Proto"))
+	for i, a := range addrs {
+		hop := forwardedHop{addr: forwardedAddr(a)}
+		// Если каждый прокси дописывает схему, списки идут параллельно;
+		// иначе схему выставил только внешний прокси.
+		switch {
+		case len(protos) == len(addrs):
+			hop.proto = strings.ToLower(protos[i])
+		case len(protos) > 0:
+			hop.proto = strings.ToLower(protos[0])
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// forwardedAddr убирает из адреса порт и квадратные скобки IPv6: "[2001:db8::1]:4711".
+func forwardedAddr(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
+
+func splitHeaderList(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				res = append(res, part)
+			}
+		}
+	}
+	return res
+}
+
+// proxyMiddleware определяет адрес клиента и схему (http/https) по заголовкам
+// обратного прокси, если запрос пришёл с адреса из trusted. Цепочка адресов
+// просматривается справа налево, пропуская доверенные прокси: левее первого
+// недоверенного адреса записи мог подделать сам клиент.
+func proxyMiddleware(trusted trustedProxies, next http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := requestInfoFrom(r.Context())
+		if info == nil || !trusted.contains(remoteHost(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hops := forwardedHops(r.Header)
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := hops[i]
+			if net.ParseIP(hop.addr) == nil {
+				// "unknown" или скрытый идентификатор: дальше адресам верить нельзя.
+				break
+			}
+			info.ClientIP = hop.addr
+			if hop.proto == "http" || hop.proto == "https" {
+				info.Scheme = hop.proto
+			}
+			if !trusted.contains(hop.addr) {
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestScheme возвращает схему, по которой клиент обратился к серверу
+// (за доверенным прокси - к прокси).
+func requestScheme(r *http.Request) string {
+	if info := requestInfoFrom(r.Context()); info != nil && info.Scheme != "" {
+		return info.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// normalizeBasePath приводит base_path к виду "/normdocs" ("" - корень сайта).
+func normalizeBasePath(s string) (string, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "/")
+	if s == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+	if u, err := url.Parse(s); err != nil || u.Path != s || strings.Contains(s, "//") {
+		return "", fmt.Errorf("invalid base_path: %q", s)
+	}
+	return s, nil
+}
+
+// normalizePublicURL приводит public_url к виду "https://intranet" ("" - не задан).
+// Префикс сайта задаётся отдельно, в base_path.
+func normalizePublicURL(s string) (string, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "/")
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid public_url: %q (expected scheme and host, e.g. https://intranet)", s)
+	}
+	return s, nil
+}
+
+// basePathMiddleware публикует сайт под префиксом base ("/normdocs"): убирает его
+// из пути запроса, чтобы маршруты оставались прежними, и добавляет к абсолютным
+// перенаправлениям. Запросы без префикса обслуживаются как есть - на случай,
+// если прокси сам отрезает префикс.
+func basePathMiddleware(base string, next http.Handler) http.Handler {
+	if base == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base {
+			target := base + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, base+"/"); ok {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath = ""
+			r = r2
+		}
+		next.ServeHTTP(&basePathResponseWriter{ResponseWriter: w, base: base}, r)
+	})
+}
+
+// basePathResponseWriter добавляет префикс к заголовку Location вида "/login".
+type basePathResponseWriter struct {
+	http.ResponseWriter
+	base        string
+	wroteHeader bool
+}
+
+func (w *basePathResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			h.Set("Location", w.base+loc)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *basePathResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap нужен http.ResponseController: через него обработчик продлевает
+// тайм-аут записи долгого ответа.
+func (w *basePathResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"::1":         true,
+		"unknown":     false,
+	} {
+		if got := trusted.contains(host); got != want {
+			t.Errorf("contains(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestProxyMiddleware(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotIP, gotScheme string
+	h := loggingMiddleware(proxyMiddleware(trusted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIP, gotScheme = clientIP(r), requestScheme(r)
+	})))
+
+	cases := []struct {
+		name       string
+		remote     string
+		headers    map[string]string
+		wantIP     string
+		wantScheme string
+	}{
+		{"direct client is not trusted", "192.168.1.20:1234",
+			map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https"}, "192.168.1.20", "http"},
+		{"single proxy", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "192.168.1.20", "X-Forwarded-Proto": "https"}, "192.168.1.20", "https"},
+		// The leftmost entry comes from the client and may be forged.
+		{"chain of proxies", "10.0.0.5:1234",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 192.168.1.20, 10.0.0.7"}, "192.168.1.20", "http"},
+		{"no forwarding headers", "10.0.0.5:1234", nil, "10.0.0.5", "http"},
+		{"forwarded header", "10.0.0.5:1234",
+			map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.0.0.7`}, "2001:db8::1", "https"},
+		{"obfuscated client", "10.0.0.5:1234",
+			map[string]string{"Forwarded": "for=unknown;proto=https, for=10.0.0.7"}, "10.0.0.7", "http"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if gotIP != c.wantIP || gotScheme != c.wantScheme {
+			t.Errorf("%s: got %s %s, want %s %s", c.name, gotIP, gotScheme, c.wantIP, c.wantScheme)
+		}
+	}
+}
+
+func TestProxyMiddleware_AccessLog(t *testing.T) {
+	buf := withTestAccessLog(t, "{{.ClientIP}} {{.RemoteAddr}} {{.URI}}")
+	trusted, err := parseTrustedProxies([]string{"10.0.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := loggingMiddleware(proxyMiddleware(trusted, basePathMiddleware("/normdocs",
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	req := httptest.NewRequest(http.MethodGet, "/normdocs/docs/a.pdf", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.20")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := strings.TrimSpace(buf.String()); got != "192.168.1.20 10.0.0.5 /normdocs/docs/a.pdf" {
+		t.Errorf("unexpected access log line: %q", got)
+	}
+}
+
+func TestBasePathMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("doc " + r.URL.Path))
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login?next=%2Fprivate", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/external", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://idp.example.local/auth", http.StatusFound)
+	})
+	h := basePathMiddleware("/normdocs", mux)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	if rec := get("/normdocs/docs/a.pdf"); rec.Body.String() != "doc /docs/a.pdf" {
+		t.Errorf("expected the prefix to be stripped, got %q", rec.Body.String())
+	}
+	// A proxy that strips the prefix itself.
+	if rec := get("/docs/a.pdf"); rec.Body.String() != "doc /docs/a.pdf" {
+		t.Errorf("expected requests without the prefix to be served, got %q", rec.Body.String())
+	}
+	for target, want := range map[string]string{
+		"/normdocs":          "/normdocs/",
+		"/normdocs/private":  "/normdocs/login?next=%2Fprivate",
+		"/normdocs/external": "https://idp.example.local/auth",
+		// ServeMux adds the trailing slash to /docs.
+		"/normdocs/docs": "/normdocs/docs/",
+	} {
+		if got := get(target).Header().Get("Location"); got != want {
+			t.Errorf("%s: Location = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestBasePathMiddleware_ResponseController(t *testing.T) {
+	wrap := func(h http.Handler) http.Handler { return basePathMiddleware("/normdocs", h) }
+	if err := setWriteDeadlineThrough(t, wrap, "/normdocs/docs/a.pdf"); err != nil {
+		t.Errorf("SetWriteDeadline through basePathMiddleware: %v", err)
+	}
+}
+
+func TestDocRepository_BasePath(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"HR/plan.pdf":  "x",
+		"HR/guide.md":  "# Guide",
+		"HR/README.md": "[План](plan.pdf), [руководство](guide.md)",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := NewDocRepository(dir, time.Minute)
+	repo.basePath = "/normdocs"
+	sections, err := repo.GetSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 1 || len(sections[0].Documents) != 2 {
+		t.Fatalf("unexpected sections: %+v", sections)
+	}
+	urls := map[string]string{}
+	for _, d := range sections[0].Documents {
+		urls[d.Name] = d.URL
+	}
+	if urls["plan.pdf"] != "/normdocs/docs/HR/plan.pdf" || urls["guide.md"] != "/normdocs/view/HR/guide.md" {
+		t.Errorf("expected document URLs under the base path, got %v", urls)
+	}
+	readme := string(sections[0].Readme)
+	if !strings.Contains(readme, `href="/normdocs/docs/HR/plan.pdf"`) || !strings.Contains(readme, `href="/normdocs/view/HR/guide.md"`) {
+		t.Errorf("expected README links under the base path:\n%s", readme)
+	}
+}
+
+func TestPageTemplates_BasePath(t *testing.T) {
+	tmpl, err := newPageTemplates("", "/normdocs", DefaultBranding()).page("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, indexPage{LoginEnabled: true, StatsEnabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`href="/normdocs/static/style.css"`,
+		`href="/normdocs/login"`,
+		`href="/normdocs/stats"`,
+		`fetch("/normdocs" + '/search?q='`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %s in the page", want)
+		}
+	}
+}
+
+func TestLoadConfig_Proxy(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	data := "trusted_proxies: [\"10.0.0.0/8\", \"192.168.1.5\"]\nbase_path: \"normdocs/\"\npublic_url: \"https://intranet/\"\n"
+	if err := os.WriteFile(cfgPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.BasePath != "/normdocs" {
+		t.Errorf("BasePath = %q, want /normdocs", cfg.BasePath)
+	}
+	if cfg.PublicURL != "https://intranet" {
+		t.Errorf("PublicURL = %q, want https://intranet", cfg.PublicURL)
+	}
+	if len(cfg.TrustedProxies) != 2 || !cfg.TrustedProxies.contains("192.168.1.5") {
+		t.Errorf("unexpected trusted proxies: %v", cfg.TrustedProxies)
+	}
+
+	for _, bad := range []string{"trusted_proxies: [\"proxy\"]", "base_path: \"/a b?x\"",
+		"public_url: \"intranet\"", "public_url: \"https://intranet/normdocs\""} {
+		if err := os.WriteFile(cfgPath, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(cfgPath); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDebounce - пауза после изменения файла конфигурации перед его
+// перечитыванием: редакторы сохраняют файл в несколько приёмов.
+var configReloadDebounce = time.Second
+
+// site - всё, что строится из конфигурации и заменяется целиком при её
+// перечитывании: каталог документов, шаблоны, права доступа и маршруты.
+type site struct {
+	cfg       Config
+	repo      *DocRepository
+	handler   http.Handler
+	stopWatch context.CancelFunc
+}
+
+// close останавливает наблюдение за каталогом документов.
+func (s *site) close() {
+	s.stopWatch()
+}
+
+// serveSite передаёт запрос текущему сайту.
+func (p *program) serveSite(w http.ResponseWriter, r *http.Request) {
+	p.site.Load().handler.ServeHTTP(w, r)
+}
+
+// restartSettings - настройки, которые применяются только при перезапуске службы:
+// от них зависят слушающие сокеты и открытые при старте хранилища.
+var restartSettings = []struct {
+	name  string
+	value func(Config) any
+}{
+	{"port", func(c Config) any { return c.Port }},
+	{"read_timeout", func(c Config) any { return c.ReadTimeout }},
+	{"write_timeout", func(c Config) any { return c.WriteTimeout }},
+	{"idle_timeout", func(c Config) any { return c.IdleTimeout }},
+	{"read_header_timeout", func(c Config) any { return c.ReadHeaderTimeout }},
+	{"tls", func(c Config) any { return c.TLS }},
+	{"log_format", func(c Config) any {
+		if c.LogFormat.tmpl != nil {
+			return c.LogFormat.tmpl.Root.String()
+		}
+		return c.LogFormat.name
+	}},
+	{"ack_db", func(c Config) any { return c.AckDB }},
+	{"audit_log", func(c Config) any { return c.AuditLog }},
+	{"stats_db", func(c Config) any { return c.StatsDB }},
+	{"auth", func(c Config) any { return c.Auth }},
+	{"metrics.public", func(c Config) any { return c.MetricsPublic }},
+}
+
+// pendingRestart возвращает настройки, которые в cfg отличаются от тех,
+// с которыми служба запущена.
+func (p *program) pendingRestart(cfg Config) []string {
+	var names []string
+	for _, s := range restartSettings {
+		if !reflect.DeepEqual(s.value(cfg), s.value(p.cfg)) {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// reload перечитывает конфигурацию и применяет то, что можно применить без
+// перезапуска. Новый сайт подменяет прежний только после того, как каталог
+// документов просканирован, а шаблоны разобраны; при любой ошибке продолжает
+// работать прежняя конфигурация.
+func (p *program) reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	cfg, err := p.loadConfig()
+	if err != nil {
+		return err
+	}
+	st, err := p.newSite(cfg)
+	if err != nil {
+		return err
+	}
+	if err := st.repo.Refresh(); err != nil {
+		st.close()
+		return fmt.Errorf("scan docs directory %s: %w", cfg.DocsDir, err)
+	}
+	if p.rotWriter != nil {
+		if err := p.rotWriter.setFilename(cfg.LogFile); err != nil {
+			st.close()
+			return fmt.Errorf("open log file: %w", err)
+		}
+	}
+
+	// История изменений прежнего сайта переходит к новому в момент подмены.
+	st.repo.inheritChanges()
+	if old := p.site.Swap(st); old != nil {
+		old.close()
+	}
+	if pending := p.pendingRestart(cfg); len(pending) > 0 {
+		log.Printf("Configuration reloaded; restart the service to apply: %s", strings.Join(pending, ", "))
+	} else {
+		log.Printf("Configuration reloaded")
+	}
+	return nil
+}
+
+func (p *program) reloadAndLog(reason string) {
+	log.Printf("Reloading configuration (%s)", reason)
+	if err := p.reload(); err != nil {
+		log.Printf("Error reloading configuration, keeping the current one: %v", err)
+	}
+}
+
+// watchConfig перечитывает конфигурацию по SIGHUP и при изменении файла
+// конфигурации. Отслеживание прекращается при отмене ctx.
+func (p *program) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	// Наблюдаем за каталогом, а не за файлом: редакторы сохраняют файл через
+	// переименование, и наблюдение за самим файлом теряется.
+	var events chan fsnotify.Event
+	var errs chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(p.configPath)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("Changes of %s are not tracked, use SIGHUP to reload: %v", p.configPath, err)
+		watcher = nil
+	} else {
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		if watcher != nil {
+			defer watcher.Close()
+		}
+
+		debounce := time.NewTimer(configReloadDebounce)
+		debounce.Stop()
+		defer debounce.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-hup:
+				p.reloadAndLog("SIGHUP")
+
+			case ev, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				if filepath.Base(ev.Name) == filepath.Base(p.configPath) && ev.Op != fsnotify.Chmod {
+					debounce.Reset(configReloadDebounce)
+				}
+
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				log.Printf("Config watcher error: %v", err)
+
+			case <-debounce.C:
+				p.reloadAndLog(filepath.Base(p.configPath) + " changed")
+			}
+		}
+	}()
+}
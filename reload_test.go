@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReloadTestProgram builds the site from the config file the way Start does,
+// without listeners and stores.
+func newReloadTestProgram(t *testing.T, cfgPath string) (*program, *httptest.Server) {
+	t.Helper()
+	load := func() (Config, error) { return LoadConfig(cfgPath) }
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &program{cfg: cfg, configPath: cfgPath, loadConfig: load}
+	st, err := p.newSite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.site.Store(st)
+	t.Cleanup(func() { p.site.Load().close() })
+
+	srv := httptest.NewServer(http.HandlerFunc(p.serveSite))
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func writeReloadTestDocs(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, path, []byte("x"))
+	}
+}
+
+func getBody(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return string(data)
+}
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestProgramReload(t *testing.T) {
+	dir := t.TempDir()
+	docs1, docs2 := filepath.Join(dir, "docs1"), filepath.Join(dir, "docs2")
+	writeReloadTestDocs(t, docs1, "Кадры/plan.pdf")
+	writeReloadTestDocs(t, docs2, "Связь/net.pdf")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+docs1+"\nwatch: off\nbranding:\n  org_name: Первая таможня\n"))
+
+	p, srv := newReloadTestProgram(t, cfgPath)
+	if body := getBody(t, srv.URL+"/"); !strings.Contains(body, "Кадры") || !strings.Contains(body, "Первая таможня") {
+		t.Fatalf("unexpected page before reload:\n%s", body)
+	}
+
+	logs := captureLog(t)
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+docs2+"\nwatch: off\nport: \"9090\"\nbranding:\n  org_name: Вторая таможня\n"))
+	if err := p.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	body := getBody(t, srv.URL+"/")
+	if !strings.Contains(body, "Связь") || strings.Contains(body, "Кадры") || !strings.Contains(body, "Вторая таможня") {
+		t.Errorf("expected the new docs dir and branding after reload:\n%s", body)
+	}
+	if body := getBody(t, srv.URL+"/docs/Связь/net.pdf"); body != "x" {
+		t.Errorf("expected a document from the new docs dir, got %q", body)
+	}
+	if !strings.Contains(logs.String(), "restart the service to apply: port") {
+		t.Errorf("expected the port change to be reported, log:\n%s", logs)
+	}
+}
+
+func TestProgramReload_KeepsChanges(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	writeReloadTestDocs(t, docs, "plan.pdf")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+docs+"\nwatch: off\n"))
+
+	p, _ := newReloadTestProgram(t, cfgPath)
+	if err := p.site.Load().repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	writeReloadTestDocs(t, docs, "HR/new.pdf")
+	if err := p.site.Load().repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+docs+"\nwatch: off\nbranding:\n  org_name: Таможня\n"))
+	if err := p.reload(); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := p.site.Load().repo.ChangesFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Kind != changeAdded || changes[1].Document.Path != "plan.pdf" {
+		t.Errorf("expected the history to survive the reload unchanged, got %+v", changes)
+	}
+}
+
+func TestProgramReload_KeepsCurrentConfigOnError(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	writeReloadTestDocs(t, docs, "Кадры/plan.pdf")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	good := "docs_dir: " + docs + "\nwatch: off\n"
+	writeTestFile(t, cfgPath, []byte(good))
+
+	p, srv := newReloadTestProgram(t, cfgPath)
+	captureLog(t)
+	for _, bad := range []string{
+		"docs_dir: " + docs + "\ncache_ttl: soon\n",
+		"docs_dir: " + filepath.Join(dir, "missing") + "\nwatch: off\n",
+		"docs_dir: " + docs + "\nwatch: off\nbranding:\n  accent_color: yellow\n",
+	} {
+		writeTestFile(t, cfgPath, []byte(bad))
+		if err := p.reload(); err == nil {
+			t.Errorf("expected reload error for:\n%s", bad)
+		}
+		if body := getBody(t, srv.URL+"/"); !strings.Contains(body, "Кадры") {
+			t.Errorf("expected the current config to stay after a failed reload:\n%s", body)
+		}
+	}
+}
+
+func TestProgramReload_LogFile(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestDocs(t, filepath.Join(dir, "docs"), "a.pdf")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+filepath.Join(dir, "docs")+"\nwatch: off\n"))
+
+	p, _ := newReloadTestProgram(t, cfgPath)
+	var err error
+	p.rotWriter, err = newRotatingWriter(filepath.Join(dir, "access.log"), maxLogSizeBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.rotWriter.Close()
+
+	captureLog(t)
+	newLog := filepath.Join(dir, "log", "access.log")
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+filepath.Join(dir, "docs")+"\nwatch: off\nlog_file: "+newLog+"\n"))
+	if err := p.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	p.rotWriter.Write([]byte("line\n"))
+	if data, _ := os.ReadFile(newLog); string(data) != "line\n" {
+		t.Errorf("expected the access log in the new file, got %q", data)
+	}
+}
+
+func TestPendingRestart(t *testing.T) {
+	p := &program{cfg: DefaultConfig()}
+	cfg := DefaultConfig()
+	cfg.DocsDir = "other"
+	cfg.CacheTTL = time.Hour
+	if pending := p.pendingRestart(cfg); len(pending) != 0 {
+		t.Errorf("expected hot-swappable settings only, got %v", pending)
+	}
+
+	cfg.Port = "9090"
+	cfg.TLS = &TLSConfig{CertFile: "server.crt", KeyFile: "server.key"}
+	cfg.Auth.Mode = authModeRequired
+	if got := strings.Join(p.pendingRestart(cfg), ","); got != "port,tls,auth" {
+		t.Errorf("pendingRestart = %s, want port,tls,auth", got)
+	}
+}
+
+func TestStart_ClosesStoresWhenSiteFails(t *testing.T) {
+	oldLog, oldFmt := accessLog, accessLogFmt
+	defer func() { accessLog, accessLogFmt = oldLog, oldFmt }()
+
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A broken template override makes newSite fail after the stores are opened.
+	writeTestFile(t, filepath.Join(templates, "index.html"), []byte("{{end}}"))
+
+	cfg := DefaultConfig()
+	cfg.DocsDir = dir
+	cfg.LogFile = filepath.Join(dir, "log", "access.log")
+	cfg.TemplatesDir = templates
+	cfg.AckDB = filepath.Join(dir, "acks.db")
+	cfg.AuditLog = filepath.Join(dir, "log", "audit.log")
+	cfg.StatsDB = filepath.Join(dir, "stats.db")
+	p := &program{cfg: cfg}
+	if err := p.Start(nil); err == nil {
+		t.Fatal("expected Start to fail on the broken template")
+	}
+	defer p.rotWriter.Close()
+	if p.acks != nil || p.stats != nil || p.audit != nil {
+		t.Error("expected the stores to be released")
+	}
+
+	// The databases are not locked any more: the next start can open them.
+	acks, err := openAckStore(cfg.AckDB)
+	if err != nil {
+		t.Fatalf("ack database is still locked: %v", err)
+	}
+	acks.Close()
+	stats, err := openStatsStore(cfg.StatsDB)
+	if err != nil {
+		t.Fatalf("stats database is still locked: %v", err)
+	}
+	stats.Close()
+}
+
+func TestWatchConfig(t *testing.T) {
+	old := configReloadDebounce
+	configReloadDebounce = 50 * time.Millisecond
+	defer func() { configReloadDebounce = old }()
+
+	dir := t.TempDir()
+	writeReloadTestDocs(t, filepath.Join(dir, "docs"), "a.pdf")
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+filepath.Join(dir, "docs")+"\nwatch: off\n"))
+
+	p, srv := newReloadTestProgram(t, cfgPath)
+	captureLog(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.watchConfig(ctx)
+
+	writeTestFile(t, cfgPath, []byte("docs_dir: "+filepath.Join(dir, "docs")+"\nwatch: off\nbranding:\n  org_name: Новое название\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(getBody(t, srv.URL+"/"), "Новое название") {
+		if time.Now().After(deadline) {
+			t.Fatal("config change was not applied")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Максимальное число документов в ответе /search.
+	searchMaxResults = 50
+	// Сколько страниц с совпадениями показывать для одного документа.
+	searchMaxPagesPerDoc = 3
+	// Размер контекста вокруг совпадения в сниппете (в символах).
+	snippetBefore = 60
+	snippetAfter  = 120
+)
+
+// SearchMatch - совпадение на конкретной странице документа.
+type SearchMatch struct {
+	Page    int           `json:"page"`
+	Snippet template.HTML `json:"snippet"`
+}
+
+// SearchResult - документ, в тексте которого найдены все слова запроса.
+type SearchResult struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Author  string `json:"author,omitempty"`
+	URL     string `json:"url"`
+	// Число страниц в документе.
+	TotalPages int           `json:"pages,omitempty"`
+	Pages      int           `json:"pages_matched"`
+	Matches    []SearchMatch `json:"matches"`
+}
+
+// searchIndex - инвертированный индекс по тексту PDF-документов.
+// Строится целиком в scan() и после этого только читается, поэтому
+// отдельной синхронизации не требует.
+type searchIndex struct {
+	docs     []indexedDoc
+	postings map[string][]posting
+	// Отсортированный список всех термов - для поиска по префиксу
+	// ("приказ" находит "приказа", "приказом" и т.д.).
+	terms []string
+}
+
+type indexedDoc struct {
+	section string
+	doc     Document
+	pages   []string
+}
+
+// posting - вхождение терма: номер документа в docs и номер страницы (с 0).
+type posting struct {
+	doc  int
+	page int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{postings: make(map[string][]posting)}
+}
+
+// add добавляет документ в индекс. pages - текст документа постранично.
+func (idx *searchIndex) add(section string, doc Document, pages []string) {
+	if len(pages) == 0 {
+		return
+	}
+
+	docID := len(idx.docs)
+	idx.docs = append(idx.docs, indexedDoc{section: section, doc: doc, pages: pages})
+
+	for pageNum, text := range pages {
+		seen := make(map[string]bool)
+		for _, term := range tokenize(text) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			idx.postings[term] = append(idx.postings[term], posting{doc: docID, page: pageNum})
+		}
+	}
+}
+
+// finalize готовит индекс к поиску. Вызывается один раз после добавления всех документов.
+func (idx *searchIndex) finalize() {
+	idx.terms = make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+}
+
+// search ищет страницы, на которых встречаются все слова запроса
+// (каждое слово - как префикс слова в тексте), и группирует их по документам.
+// Если allow не nil, в результат попадают только документы, для которых он вернул true.
+func (idx *searchIndex) search(query string, limit int, allow func(Document) bool) []SearchResult {
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 || idx == nil {
+		return nil
+	}
+
+	// Пересекаем множества страниц по всем словам запроса.
+	var matched map[posting]bool
+	for _, qt := range queryTerms {
+		current := make(map[posting]bool)
+		for _, p := range idx.prefixPostings(qt) {
+			if matched == nil || matched[p] {
+				current[p] = true
+			}
+		}
+		matched = current
+		if len(matched) == 0 {
+			return nil
+		}
+	}
+
+	pagesByDoc := make(map[int][]int)
+	for p := range matched {
+		if allow != nil && !allow(idx.docs[p.doc].doc) {
+			continue
+		}
+		pagesByDoc[p.doc] = append(pagesByDoc[p.doc], p.page)
+	}
+
+	results := make([]SearchResult, 0, len(pagesByDoc))
+	for docID, pages := range pagesByDoc {
+		sort.Ints(pages)
+		d := idx.docs[docID]
+
+		res := SearchResult{
+			Section:    d.section,
+			Name:       d.doc.Name,
+			Title:      d.doc.DisplayName(),
+			Author:     d.doc.Author,
+			URL:        d.doc.URL,
+			TotalPages: d.doc.Pages,
+			Pages:      len(pages),
+		}
+		for i, page := range pages {
+			if i >= searchMaxPagesPerDoc {
+				break
+			}
+			res.Matches = append(res.Matches, SearchMatch{
+				Page:    page + 1,
+				Snippet: makeSnippet(d.pages[page], queryTerms),
+			})
+		}
+		results = append(results, res)
+	}
+
+	// Сначала документы с наибольшим числом страниц-совпадений.
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Pages != results[j].Pages {
+			return results[i].Pages > results[j].Pages
+		}
+		if results[i].Section != results[j].Section {
+			return results[i].Section < results[j].Section
+		}
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// prefixPostings возвращает вхождения всех термов, начинающихся с prefix.
+func (idx *searchIndex) prefixPostings(prefix string) []posting {
+	var result []posting
+	i := sort.SearchStrings(idx.terms, prefix)
+	for ; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], prefix); i++ {
+		result = append(result, idx.postings[idx.terms[i]]...)
+	}
+	return result
+}
+
+// normalizeRune приводит символ к виду для поиска: нижний регистр, ё -> е.
+// Длина текста в рунах при этом не меняется, что важно для построения сниппетов.
+func normalizeRune(r rune) rune {
+	r = unicode.ToLower(r)
+	if r == 'ё' {
+		return 'е'
+	}
+	return r
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize разбивает текст на нормализованные слова.
+func tokenize(s string) []string {
+	var (
+		terms []string
+		b     strings.Builder
+	)
+	flush := func() {
+		if b.Len() > 0 {
+			terms = append(terms, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range s {
+		if isWordRune(r) {
+			b.WriteRune(normalizeRune(r))
+			continue
+		}
+		flush()
+	}
+	flush()
+	return terms
+}
+
+// makeSnippet вырезает фрагмент текста страницы вокруг первого совпадения
+// и подсвечивает в нём все слова запроса. Возвращает безопасный HTML.
+func makeSnippet(pageText string, queryTerms []string) template.HTML {
+	runes := []rune(strings.Join(strings.Fields(pageText), " "))
+	norm := make([]rune, len(runes))
+	for i, r := range runes {
+		norm[i] = normalizeRune(r)
+	}
+
+	// Находим все вхождения слов запроса в начале слов текста.
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(norm); i++ {
+		if i > 0 && isWordRune(norm[i-1]) {
+			continue
+		}
+		for _, qt := range queryTerms {
+			q := []rune(qt)
+			if hasRunePrefix(norm[i:], q) {
+				spans = append(spans, span{i, i + len(q)})
+				break
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	from := spans[0].start - snippetBefore
+	if from < 0 {
+		from = 0
+	}
+	to := spans[0].start + snippetAfter
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, sp := range spans {
+		if sp.start < pos || sp.end > to {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(string(runes[pos:sp.start])))
+		b.WriteString(`<span class="highlight">`)
+		b.WriteString(template.HTMLEscapeString(string(runes[sp.start:sp.end])))
+		b.WriteString(`</span>`)
+		pos = sp.end
+	}
+	b.WriteString(template.HTMLEscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+
+	return template.HTML(b.String())
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchResponse - тело ответа /search.
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+// searchHandler выполняет полнотекстовый поиск по содержимому PDF: GET /search?q=...
+// Ответ - JSON со списком документов, номерами страниц и подсвеченными фрагментами.
+func searchHandler(repo *DocRepository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+		results, err := repo.SearchFor(userFromRequest(r), query, searchMaxResults)
+		if err != nil {
+			http.Error(w, "Could not search documents", http.StatusInternalServerError)
+			log.Printf("Error searching documents: %v", err)
+			return
+		}
+		if results == nil {
+			results = []SearchResult{}
+		}
+
+		writeJSON(w, http.StatusOK, searchResponse{Query: query, Results: results})
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestPDF creates a minimal valid PDF with one page per entry in pages.
+// Text is drawn with the standard Helvetica font, so only ASCII is supported.
+func writeTestPDF(t *testing.T, path string, pages []string) {
+	t.Helper()
+	writeTestPDFWithInfo(t, path, pages, "")
+}
+
+// writeTestPDFWithInfo is like writeTestPDF but also writes an Info dictionary
+// (e.g. "<< /Title (Order) /Author (HR) >>") when info is not empty.
+func writeTestPDFWithInfo(t *testing.T, path string, pages []string, info string) {
+	t.Helper()
+
+	var objects []string
+	// 1: catalog, 2: pages tree, 3: font, then page+content pairs.
+	kids := make([]string, 0, len(pages))
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+i*2))
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+
+	trailerInfo := ""
+	if info != "" {
+		objects = append(objects, info)
+		trailerInfo = fmt.Sprintf(" /Info %d 0 R", len(objects))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailerInfo, xref)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDocRepository_SearchPDFContents(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	writeTestPDF(t, filepath.Join(tmpDir, "order_1.pdf"), []string{
+		"General provisions of the order",
+		"Officers must wear uniform on duty",
+	})
+
+	hrDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(hrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestPDF(t, filepath.Join(hrDir, "vacation.pdf"), []string{
+		"Vacation schedule is approved annually",
+	})
+
+	// Broken PDF must not break the scan.
+	if err := os.WriteFile(filepath.Join(hrDir, "broken.pdf"), []byte("not a pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+
+	results, err := repo.Search("uniform duty", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d: %+v", len(results), results)
+	}
+	res := results[0]
+	if res.Name != "order_1.pdf" || res.Section != generalSectionName {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(res.Matches) != 1 || res.Matches[0].Page != 2 {
+		t.Fatalf("expected match on page 2, got %+v", res.Matches)
+	}
+	if !strings.Contains(string(res.Matches[0].Snippet), `<span class="highlight">uniform</span>`) {
+		t.Errorf("expected highlighted snippet, got %q", res.Matches[0].Snippet)
+	}
+
+	// Prefix match: "approv" finds "approved".
+	results, err = repo.Search("APPROV", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Section != "HR" || results[0].URL != "/docs/HR/vacation.pdf" {
+		t.Fatalf("unexpected prefix search results: %+v", results)
+	}
+
+	// All words must be present on the same page.
+	results, err = repo.Search("vacation uniform", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %+v", results)
+	}
+}
+
+func TestTokenize_NormalizesCyrillic(t *testing.T) {
+	got := tokenize("Ёлка, ПРИКАЗ №123-к")
+	want := []string{"елка", "приказ", "123", "к"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("tokenize: expected %v, got %v", want, got)
+	}
+}
+
+func TestMakeSnippet_EscapesHTML(t *testing.T) {
+	snippet := makeSnippet("<b>Приказ</b> о ёлке", []string{"елке"})
+	want := `&lt;b&gt;Приказ&lt;/b&gt; о <span class="highlight">ёлке</span>`
+	if string(snippet) != want {
+		t.Fatalf("expected %q, got %q", want, snippet)
+	}
+}
+
+func TestSearchHandler_ReturnsJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestPDF(t, filepath.Join(tmpDir, "doc.pdf"), []string{"Customs declaration rules"})
+
+	repo := NewDocRepository(tmpDir, time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=declaration", nil)
+	rec := httptest.NewRecorder()
+	searchHandler(repo).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp searchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Query != "declaration" || len(resp.Results) != 1 || resp.Results[0].Matches[0].Page != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// downloadsBucket - счётчики скачиваний: ключ "2006-01-02\x00путь документа",
+// значение - число скачиваний за день (uint64, big endian).
+var downloadsBucket = []byte("downloads")
+
+const statsDayLayout = "2006-01-02"
+
+// Блок "Популярное за месяц" на главной и страница /stats.
+const (
+	popularPeriod      = 30 * 24 * time.Hour
+	popularLimit       = 5
+	defaultStatsMonths = 12
+	maxStatsMonths     = 36
+	statsDocumentLimit = 50
+)
+
+// statsMonthNames - короткие названия месяцев для подписей графиков.
+var statsMonthNames = [...]string{"янв", "фев", "мар", "апр", "май", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"}
+
+// statsStore - счётчики скачиваний документов по дням во встроенной БД (bbolt).
+// Методы nil-хранилища ничего не делают.
+type statsStore struct {
+	db *bolt.DB
+}
+
+func openStatsStore(path string) (*statsStore, error) {
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create stats database directory %q: %w", dir, err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open stats database %q: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(downloadsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init stats database %q: %w", path, err)
+	}
+	return &statsStore{db: db}, nil
+}
+
+func (s *statsStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func statsKey(day time.Time, doc string) []byte {
+	return []byte(day.Format(statsDayLayout) + "\x00" + doc)
+}
+
+// recordDownload увеличивает счётчик скачиваний документа doc за день at.
+func (s *statsStore) recordDownload(doc string, at time.Time) error {
+	key := statsKey(at, doc)
+	// Batch объединяет запись параллельных скачиваний в одну транзакцию.
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(downloadsBucket)
+		var n uint64
+		if v := b.Get(key); len(v) == 8 {
+			n = binary.BigEndian.Uint64(v)
+		}
+		return b.Put(key, binary.BigEndian.AppendUint64(nil, n+1))
+	})
+}
+
+// countRequest учитывает ответ на запрос документа rel. Считаются только
+// успешные GET; из запросов по частям (так PDF читает встроенный просмотрщик
+// браузера) - только первый, с начала файла.
+func (s *statsStore) countRequest(r *http.Request, rel string, status int) {
+	if s == nil || r.Method != http.MethodGet {
+		return
+	}
+	if status != http.StatusOK &&
+		!(status == http.StatusPartialContent && strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")) {
+		return
+	}
+	if err := s.recordDownload(rel, time.Now()); err != nil {
+		log.Printf("Error counting download of %s: %v", rel, err)
+	}
+}
+
+// dailyDownloads - число скачиваний документа за день.
+type dailyDownloads struct {
+	Day      time.Time
+	Document string
+	Count    uint64
+}
+
+// downloads возвращает счётчики за дни с from по to включительно.
+func (s *statsStore) downloads(from, to time.Time) ([]dailyDownloads, error) {
+	var res []dailyDownloads
+	last := to.Format(statsDayLayout)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(downloadsBucket).Cursor()
+		for k, v := c.Seek([]byte(from.Format(statsDayLayout))); k != nil; k, v = c.Next() {
+			day, doc, ok := strings.Cut(string(k), "\x00")
+			if !ok || len(v) != 8 {
+				continue
+			}
+			if day > last {
+				break
+			}
+			t, err := time.ParseInLocation(statsDayLayout, day, time.Local)
+			if err != nil {
+				continue
+			}
+			res = append(res, dailyDownloads{Day: t, Document: doc, Count: binary.BigEndian.Uint64(v)})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// statsDocKey сопоставляет путь из запроса с документом перечня:
+// на Windows "hr/plan.pdf" и "HR/plan.pdf" - один файл.
+func statsDocKey(p string) string {
+	return strings.ToLower(strings.TrimPrefix(p, "/"))
+}
+
+// popularDocument - строка блока "Популярное за месяц".
+type popularDocument struct {
+	Document
+	Section   string
+	Downloads uint64
+}
+
+// popularDocuments возвращает самые скачиваемые за последние 30 дней документы
+// из sections (то есть только доступные пользователю и существующие сейчас).
+func popularDocuments(s *statsStore, sections []Section, now time.Time) ([]popularDocument, error) {
+	rows, err := s.downloads(now.Add(-popularPeriod), now)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]uint64)
+	for _, row := range rows {
+		counts[statsDocKey(row.Document)] += row.Count
+	}
+
+	var popular []popularDocument
+	for _, sec := range sections {
+		for _, d := range sec.Documents {
+			if n := counts[statsDocKey(d.Path)]; n > 0 {
+				popular = append(popular, popularDocument{Document: d, Section: sec.Name, Downloads: n})
+			}
+		}
+	}
+	sort.SliceStable(popular, func(i, j int) bool { return popular[i].Downloads > popular[j].Downloads })
+	if len(popular) > popularLimit {
+		popular = popular[:popularLimit]
+	}
+	return popular, nil
+}
+
+// statsBar - столбец графика за один месяц.
+type statsBar struct {
+	Label string
+	Count uint64
+	// Height - высота столбца в процентах от максимального в графике.
+	Height int
+}
+
+// statsRow - график скачиваний по месяцам для раздела или документа.
+type statsRow struct {
+	Name    string
+	URL     string
+	Section string
+	Total   uint64
+	Bars    []statsBar
+}
+
+// statsPage - данные шаблона stats.html.
+type statsPage struct {
+	Months    int
+	Total     statsRow
+	Sections  []statsRow
+	Documents []statsRow
+}
+
+// buildStatsPage строит графики скачиваний по месяцам за months последних
+// месяцев (включая текущий) для доступных пользователю разделов и документов.
+func buildStatsPage(s *statsStore, sections []Section, months int, now time.Time) (statsPage, error) {
+	first := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.Local)
+	rows, err := s.downloads(first, now)
+	if err != nil {
+		return statsPage{}, err
+	}
+
+	labels := make([]string, months)
+	for i := range labels {
+		m := first.AddDate(0, i, 0)
+		labels[i] = statsMonthNames[m.Month()-1] + " " + strconv.Itoa(m.Year())
+	}
+	monthIndex := func(t time.Time) int {
+		return (t.Year()-first.Year())*12 + int(t.Month()-first.Month())
+	}
+
+	perDoc := make(map[string][]uint64)
+	for _, row := range rows {
+		i := monthIndex(row.Day)
+		if i < 0 || i >= months {
+			continue
+		}
+		key := statsDocKey(row.Document)
+		if perDoc[key] == nil {
+			perDoc[key] = make([]uint64, months)
+		}
+		perDoc[key][i] += row.Count
+	}
+
+	page := statsPage{Months: months}
+	total := make([]uint64, months)
+	for _, sec := range sections {
+		secCounts := make([]uint64, months)
+		for _, d := range sec.Documents {
+			counts, ok := perDoc[statsDocKey(d.Path)]
+			if !ok {
+				continue
+			}
+			for i, n := range counts {
+				secCounts[i] += n
+				total[i] += n
+			}
+			page.Documents = append(page.Documents, newStatsRow(d.DisplayName(), d.URL, sec.Name, labels, counts))
+		}
+		if row := newStatsRow(sec.Name, "", "", labels, secCounts); row.Total > 0 {
+			page.Sections = append(page.Sections, row)
+		}
+	}
+	page.Total = newStatsRow("Все разделы", "", "", labels, total)
+
+	sort.SliceStable(page.Sections, func(i, j int) bool { return page.Sections[i].Total > page.Sections[j].Total })
+	sort.SliceStable(page.Documents, func(i, j int) bool { return page.Documents[i].Total > page.Documents[j].Total })
+	if len(page.Documents) > statsDocumentLimit {
+		page.Documents = page.Documents[:statsDocumentLimit]
+	}
+	return page, nil
+}
+
+func newStatsRow(name, url, section string, labels []string, counts []uint64) statsRow {
+	row := statsRow{Name: name, URL: url, Section: section, Bars: make([]statsBar, len(counts))}
+	var peak uint64
+	for _, n := range counts {
+		row.Total += n
+		peak = max(peak, n)
+	}
+	for i, n := range counts {
+		row.Bars[i] = statsBar{Label: labels[i], Count: n}
+		if peak > 0 {
+			row.Bars[i].Height = int(n * 100 / peak)
+		}
+	}
+	return row
+}
+
+// statsHandler - страница статистики скачиваний: GET /stats?months=12.
+func statsHandler(repo *DocRepository, store *statsStore, tmpl *pageTemplate) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		months := defaultStatsMonths
+		if v := r.URL.Query().Get("months"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid months", http.StatusBadRequest)
+				return
+			}
+			months = min(n, maxStatsMonths)
+		}
+
+		sections, err := repo.SectionsFor(userFromRequest(r))
+		if err != nil {
+			http.Error(w, "Could not load documents", http.StatusInternalServerError)
+			log.Printf("Error getting sections: %v", err)
+			return
+		}
+		page, err := buildStatsPage(store, sections, months, time.Now())
+		if err != nil {
+			http.Error(w, "Could not load statistics", http.StatusInternalServerError)
+			log.Printf("Error reading download statistics: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := tmpl.Execute(w, page); err != nil {
+			log.Printf("Error executing template: %v", err)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStatsStore(t *testing.T) (*statsStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data", "stats.db")
+	s, err := openStatsStore(path)
+	if err != nil {
+		t.Fatalf("openStatsStore failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestStatsStore_PersistsDownloads(t *testing.T) {
+	s, path := openTestStatsStore(t)
+	day := time.Date(2025, 3, 14, 10, 0, 0, 0, time.Local)
+	for _, rec := range []struct {
+		doc string
+		at  time.Time
+	}{
+		{"HR/plan.pdf", day},
+		{"HR/plan.pdf", day.Add(time.Hour)},
+		{"HR/plan.pdf", day.AddDate(0, 0, 1)},
+		{"rules.pdf", day.AddDate(0, 0, -10)},
+	} {
+		if err := s.recordDownload(rec.doc, rec.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rows, err := s.downloads(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Count != 2 || rows[1].Count != 1 || rows[0].Document != "HR/plan.pdf" ||
+		!rows[1].Day.Equal(time.Date(2025, 3, 15, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected downloads after reopening: %+v", rows)
+	}
+}
+
+func TestStatsStore_CountRequest(t *testing.T) {
+	s, _ := openTestStatsStore(t)
+	cases := []struct {
+		method, rng string
+		status      int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		// The browser's PDF viewer reads the file in ranges: only the first one counts.
+		{http.MethodGet, "bytes=0-65535", http.StatusPartialContent},
+		{http.MethodGet, "bytes=65536-131071", http.StatusPartialContent},
+		{http.MethodHead, "", http.StatusOK},
+		{http.MethodGet, "", http.StatusNotModified},
+		{http.MethodGet, "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/docs/a.pdf", nil)
+		if c.rng != "" {
+			req.Header.Set("Range", c.rng)
+		}
+		s.countRequest(req, "a.pdf", c.status)
+	}
+
+	rows, err := s.downloads(time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Count != 2 {
+		t.Fatalf("expected 2 counted downloads, got %+v", rows)
+	}
+}
+
+func TestPopularDocuments(t *testing.T) {
+	s, _ := openTestStatsStore(t)
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.Local)
+	record := func(doc string, n int, at time.Time) {
+		for i := 0; i < n; i++ {
+			if err := s.recordDownload(doc, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	record("HR/plan.pdf", 3, now)
+	record("hr/PLAN.pdf", 1, now.AddDate(0, 0, -5))
+	record("rules.pdf", 2, now)
+	// Older than a month.
+	record("rules.pdf", 10, now.AddDate(0, -2, 0))
+	// Not in the sections passed in: removed or hidden from the user.
+	record("Board/minutes.pdf", 50, now)
+
+	sections := []Section{
+		{Name: generalSectionName, Documents: []Document{{Name: "rules.pdf", Path: "rules.pdf"}, {Name: "unused.pdf", Path: "unused.pdf"}}},
+		{Name: "HR", Path: "HR", Documents: []Document{{Name: "plan.pdf", Path: "HR/plan.pdf"}}},
+	}
+	popular, err := popularDocuments(s, sections, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(popular) != 2 || popular[0].Path != "HR/plan.pdf" || popular[0].Downloads != 4 || popular[0].Section != "HR" ||
+		popular[1].Path != "rules.pdf" || popular[1].Downloads != 2 {
+		t.Fatalf("unexpected popular documents: %+v", popular)
+	}
+}
+
+func TestBuildStatsPage(t *testing.T) {
+	s, _ := openTestStatsStore(t)
+	now := time.Date(2025, 2, 10, 12, 0, 0, 0, time.Local)
+	for _, rec := range []struct {
+		doc string
+		at  time.Time
+	}{
+		{"HR/plan.pdf", now},
+		{"HR/plan.pdf", now},
+		{"HR/order.pdf", now.AddDate(0, -1, 0)},
+		{"rules.pdf", now.AddDate(0, -2, 0)},
+		// Before the period.
+		{"rules.pdf", now.AddDate(0, -3, 0)},
+	} {
+		if err := s.recordDownload(rec.doc, rec.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sections := []Section{
+		{Name: generalSectionName, Documents: []Document{{Name: "rules.pdf", Path: "rules.pdf", URL: "/docs/rules.pdf"}}},
+		{Name: "HR", Path: "HR", Documents: []Document{
+			{Name: "order.pdf", Path: "HR/order.pdf"},
+			{Name: "plan.pdf", Path: "HR/plan.pdf"},
+		}},
+	}
+	page, err := buildStatsPage(s, sections, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := func(row statsRow) []uint64 {
+		var res []uint64
+		for _, b := range row.Bars {
+			res = append(res, b.Count)
+		}
+		return res
+	}
+	if got := counts(page.Total); page.Total.Total != 4 || len(got) != 3 || got[0] != 1 || got[1] != 1 || got[2] != 2 {
+		t.Errorf("unexpected total chart: %+v", page.Total)
+	}
+	if page.Total.Bars[0].Label != "дек 2024" || page.Total.Bars[2].Label != "фев 2025" || page.Total.Bars[2].Height != 100 ||
+		page.Total.Bars[0].Height != 50 {
+		t.Errorf("unexpected bars: %+v", page.Total.Bars)
+	}
+	if len(page.Sections) != 2 || page.Sections[0].Name != "HR" || page.Sections[0].Total != 3 {
+		t.Errorf("unexpected sections: %+v", page.Sections)
+	}
+	if len(page.Documents) != 3 || page.Documents[0].Name != "plan.pdf" || page.Documents[0].Section != "HR" {
+		t.Errorf("unexpected documents: %+v", page.Documents)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	s, _ := openTestStatsStore(t)
+	files := http.StripPrefix("/docs/", docsFileHandler(repo, nil, s))
+	hr := &User{Name: "ivanov", Groups: []string{"HR"}}
+	for _, target := range []string{"/docs/public.pdf", "/docs/HR/salary.pdf", "/docs/HR/salary.pdf", "/docs/Board/README.md"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		files.ServeHTTP(httptest.NewRecorder(), req.WithContext(contextWithUser(req.Context(), hr)))
+	}
+
+	// README.md is not a document and is not counted.
+	rows, err := s.downloads(time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected downloads of 2 documents, got %+v", rows)
+	}
+
+	h := statsHandler(repo, s, testPageTemplate(t, "stats.html"))
+	get := func(target string, u *User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if u != nil {
+			req = req.WithContext(contextWithUser(req.Context(), u))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	body := get("/stats", hr).Body.String()
+	if !strings.Contains(body, "salary.pdf") || !strings.Contains(body, `style="height: 100%"`) {
+		t.Errorf("expected HR documents with charts on the stats page:\n%s", body)
+	}
+	// Downloads of restricted documents are not shown to other users.
+	if body := get("/stats", nil).Body.String(); strings.Contains(body, "salary.pdf") || !strings.Contains(body, "public.pdf") {
+		t.Errorf("expected only public documents for anonymous user:\n%s", body)
+	}
+	if rec := get("/stats?months=abc", hr); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid months, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_StatsDB(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	for content, want := range map[string]string{
+		`port: "8080"`:              "",
+		`stats_db: "data/stats.db"`: "data/stats.db",
+		`stats_db: ""`:              "",
+	} {
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(cfgPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if cfg.StatsDB != want {
+			t.Errorf("%s: StatsDB = %q, want %q", content, cfg.StatsDB, want)
+		}
+	}
+}
+
+func TestIndexTemplate_Popular(t *testing.T) {
+	tmpl := testPageTemplate(t, "index.html")
+	page := indexPage{
+		StatsEnabled: true,
+		Popular:      []popularDocument{{Document: Document{Name: "plan.pdf", URL: "/docs/HR/plan.pdf"}, Section: "HR", Downloads: 7}},
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, page); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "Популярное за месяц") || !strings.Contains(b.String(), "скачиваний: 7") ||
+		!strings.Contains(b.String(), `href="/stats"`) {
+		t.Errorf("expected popular documents block and stats link:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := tmpl.Execute(&b, indexPage{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "Популярное за месяц") || strings.Contains(b.String(), `href="/stats"`) {
+		t.Errorf("expected no stats without download statistics")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Branding - оформление сайта для конкретной организации (branding в config.yaml).
+type Branding struct {
+	// OrgName - название организации на плашке в шапке.
+	OrgName string
+	// SiteName - название сайта в заголовке окна браузера.
+	SiteName string
+	// Title и Subtitle - заголовок главной страницы и строка под ним.
+	Title    string
+	Subtitle string
+	Footer   string
+	// Logo - картинка перед названием организации: имя файла в static_dir или URL.
+	Logo string
+	// AccentColor - цвет плашки, ссылок и кнопок ("#ffd86b").
+	AccentColor string
+}
+
+// yamlBranding mirrors the branding section of config.yaml.
+type yamlBranding struct {
+	OrgName     string `yaml:"org_name"`
+	SiteName    string `yaml:"site_name"`
+	Title       string `yaml:"title"`
+	Subtitle    string `yaml:"subtitle"`
+	Footer      string `yaml:"footer"`
+	Logo        string `yaml:"logo"`
+	AccentColor string `yaml:"accent_color"`
+}
+
+// validAccentColor - цвет в CSS-записи #rgb или #rrggbb.
+var validAccentColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// DefaultBranding returns the branding used when config.yaml has no branding section.
+func DefaultBranding() Branding {
+	return Branding{
+		OrgName:  "Мурманская таможня",
+		SiteName: "Справочная система",
+		Title:    "Перечень нормативных и иных правовых актов по направлениям деятельности подразделений таможни",
+		Subtitle: "Для обязательного ознакомления вновь принятых должностных лиц и актуализации знаний действующего состава",
+		Footer:   "©Мурманская таможня · Внутренняя справочная система",
+	}
+}
+
+// parseBranding применяет секцию branding поверх оформления по умолчанию.
+func parseBranding(y yamlBranding) (Branding, error) {
+	b := DefaultBranding()
+	if y.OrgName != "" {
+		b.OrgName = y.OrgName
+	}
+	if y.SiteName != "" {
+		b.SiteName = y.SiteName
+	}
+	if y.Title != "" {
+		b.Title = y.Title
+	}
+	if y.Subtitle != "" {
+		b.Subtitle = y.Subtitle
+	}
+	if y.Footer != "" {
+		b.Footer = y.Footer
+	}
+	b.Logo = y.Logo
+	if y.AccentColor != "" {
+		if !validAccentColor.MatchString(y.AccentColor) {
+			return b, fmt.Errorf("invalid value for branding.accent_color: %q (expected #rgb or #rrggbb)", y.AccentColor)
+		}
+		b.AccentColor = y.AccentColor
+	}
+	return b, nil
+}
+
+// pageTemplates - шаблоны страниц. Файл из templates_dir заменяет встроенный
+// шаблон с тем же именем и перечитывается при изменении без перезапуска.
+type pageTemplates struct {
+	// dir - templates_dir; "" - только встроенные шаблоны.
+	dir   string
+	funcs template.FuncMap
+}
+
+// newPageTemplates возвращает шаблоны с функциями basePath, branding и staticURL.
+func newPageTemplates(dir, basePath string, branding Branding) *pageTemplates {
+	return &pageTemplates{
+		dir: dir,
+		funcs: template.FuncMap{
+			// basePath - префикс сайта для абсолютных ссылок ("/normdocs" или "").
+			"basePath": func() string { return basePath },
+			"branding": func() Branding { return branding },
+			// staticURL - адрес файла из static/ (или внешний URL как есть).
+			"staticURL": func(name string) string {
+				if strings.Contains(name, "://") || strings.HasPrefix(name, "/") {
+					return name
+				}
+				return basePath + "/static/" + name
+			},
+		},
+	}
+}
+
+// page разбирает шаблон страницы; ошибка здесь - ошибка конфигурации.
+func (s *pageTemplates) page(name string) (*pageTemplate, error) {
+	t := &pageTemplate{set: s, name: name}
+	mod := s.modTime(name)
+	tmpl, err := s.parse(name, !mod.IsZero())
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl, t.modTime = tmpl, mod
+	return t, nil
+}
+
+// modTime - время изменения шаблона в templates_dir; нулевое, если его там нет.
+func (s *pageTemplates) modTime(name string) time.Time {
+	if s.dir == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(filepath.Join(s.dir, name))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (s *pageTemplates) parse(name string, fromDir bool) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(s.funcs)
+	var err error
+	if fromDir {
+		tmpl, err = tmpl.ParseFiles(filepath.Join(s.dir, name))
+	} else {
+		tmpl, err = tmpl.ParseFS(content, "templates/"+name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// pageTemplate - шаблон одной страницы.
+type pageTemplate struct {
+	set  *pageTemplates
+	name string
+
+	mu      sync.Mutex
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+func (t *pageTemplate) Execute(w io.Writer, data any) error {
+	return t.current().Execute(w, data)
+}
+
+// current возвращает шаблон, перечитывая его, если файл в templates_dir
+// появился, изменился или удалён. Шаблон с ошибкой не применяется: страница
+// продолжает открываться с прежним, а ошибка пишется в журнал один раз.
+func (t *pageTemplate) current() *template.Template {
+	if t.set.dir == "" {
+		return t.tmpl
+	}
+	mod := t.set.modTime(t.name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if mod.Equal(t.modTime) {
+		return t.tmpl
+	}
+	t.modTime = mod
+	tmpl, err := t.set.parse(t.name, !mod.IsZero())
+	if err != nil {
+		log.Printf("Error reloading template %s, keeping the previous one: %v", t.name, err)
+		return t.tmpl
+	}
+	log.Printf("Template %s reloaded", t.name)
+	t.tmpl = tmpl
+	return t.tmpl
+}
+
+// staticFS - файлы сайта для /static/: файл из static_dir заменяет встроенный
+// с тем же именем, остальные берутся из встроенных.
+type staticFS struct {
+	dir string
+}
+
+func (s staticFS) Open(name string) (fs.File, error) {
+	if rest, ok := strings.CutPrefix(name, "static/"); ok && s.dir != "" {
+		f, err := os.DirFS(s.dir).Open(path.Clean(rest))
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return content.Open(name)
+}
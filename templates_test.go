@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPageTemplate returns an embedded page template with the default branding.
+func testPageTemplate(t *testing.T, name string) *pageTemplate {
+	t.Helper()
+	tmpl, err := newPageTemplates("", "", DefaultBranding()).page(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func renderPage(t *testing.T, tmpl *pageTemplate, data any) string {
+	t.Helper()
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestPageTemplates_DefaultBranding(t *testing.T) {
+	pages := map[string]any{
+		"index.html": indexPage{},
+		"login.html": loginPage{},
+		"stats.html": statsPage{},
+		"view.html":  viewPage{},
+	}
+	for name, data := range pages {
+		html := renderPage(t, testPageTemplate(t, name), data)
+		if !strings.Contains(html, `<div class="hero-badge">Мурманская таможня</div>`) ||
+			!strings.Contains(html, "©Мурманская таможня · Внутренняя справочная система") {
+			t.Errorf("%s: expected the default branding", name)
+		}
+		if strings.Contains(html, "Мурманска ") || strings.Contains(html, "--accent:") {
+			t.Errorf("%s: unexpected footer typo or accent colour override", name)
+		}
+	}
+}
+
+func TestPageTemplates_Branding(t *testing.T) {
+	b, err := parseBranding(yamlBranding{
+		OrgName:     "Кольская таможня",
+		Title:       "Нормативные документы",
+		Footer:      "© Кольская таможня",
+		Logo:        "logo.png",
+		AccentColor: "#c0392b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := newPageTemplates("", "/normdocs", b).page("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := renderPage(t, tmpl, indexPage{})
+	for _, want := range []string{
+		`<div class="hero-badge">Кольская таможня</div>`,
+		`<h1 class="hero-title">Нормативные документы</h1>`,
+		// Not overridden.
+		"<title>Справочная система</title>",
+		"© Кольская таможня",
+		`src="/normdocs/static/logo.png"`,
+		"--accent: #c0392b",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %s in the page", want)
+		}
+	}
+
+	if _, err := parseBranding(yamlBranding{AccentColor: "red; background: url(x)"}); err == nil {
+		t.Error("expected error for an invalid accent colour")
+	}
+}
+
+func TestPageTemplates_Override(t *testing.T) {
+	dir := t.TempDir()
+	tmpl, err := newPageTemplates(dir, "", DefaultBranding()).page("view.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := renderPage(t, tmpl, viewPage{}); !strings.Contains(html, "hero-badge") {
+		t.Fatalf("expected the embedded template without an override")
+	}
+
+	path := filepath.Join(dir, "view.html")
+	write := func(text string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The override is picked up without a restart.
+	now := time.Now()
+	write(`<p>{{branding.OrgName}}: {{.Title}}</p>`, now.Add(time.Minute))
+	if html := renderPage(t, tmpl, viewPage{Title: "Приказ"}); html != "<p>Мурманская таможня: Приказ</p>" {
+		t.Errorf("expected the template from templates_dir, got %q", html)
+	}
+
+	// A broken template keeps the previous one.
+	write(`<p>{{.Title</p>`, now.Add(2*time.Minute))
+	if html := renderPage(t, tmpl, viewPage{Title: "Приказ"}); html != "<p>Мурманская таможня: Приказ</p>" {
+		t.Errorf("expected the previous template to be kept, got %q", html)
+	}
+
+	// Removing the file brings back the embedded template.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if html := renderPage(t, tmpl, viewPage{}); !strings.Contains(html, "hero-badge") {
+		t.Errorf("expected the embedded template after removing the override")
+	}
+
+	// A broken override is a configuration error at startup.
+	write(`{{end}}`, now)
+	if _, err := newPageTemplates(dir, "", DefaultBranding()).page("view.html"); err == nil {
+		t.Error("expected error for a broken template at startup")
+	}
+}
+
+func TestStaticFS_Override(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), []byte("logo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := http.FileServer(http.FS(staticFS{dir: dir}))
+	get := func(target string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+
+	if code, body := get("/static/logo.png"); code != http.StatusOK || body != "logo" {
+		t.Errorf("expected the logo from static_dir, got %d %q", code, body)
+	}
+	if _, body := get("/static/style.css"); body != "body {}" {
+		t.Errorf("expected style.css from static_dir to override the embedded one, got %q", body)
+	}
+	if code, _ := get("/static/missing.png"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", code)
+	}
+}
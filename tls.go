@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Наборы шифров TLS 1.2 (tls.cipher_policy). Шифры TLS 1.3 в Go не настраиваются.
+const (
+	// cipherPolicyModern - только ECDHE с AEAD (AES-GCM, ChaCha20-Poly1305).
+	cipherPolicyModern = "modern"
+	// cipherPolicyCompatible - набор Go по умолчанию, с CBC для старых клиентов.
+	cipherPolicyCompatible = "compatible"
+)
+
+// Проверка клиентских сертификатов (tls.client_auth).
+const (
+	clientAuthOff      = "off"
+	clientAuthOptional = "optional"
+	clientAuthRequired = "required"
+)
+
+// Откуда брать логин пользователя из клиентского сертификата (auth.client_cert.user_field).
+const (
+	certUserCN    = "cn"
+	certUserEmail = "email"
+	certUserUPN   = "upn"
+)
+
+// certCheckInterval - как часто проверять, не заменили ли файлы сертификата.
+const certCheckInterval = 10 * time.Second
+
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig - HTTPS на самом сервере: port тогда - порт HTTPS.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion - минимальная версия TLS (tls.VersionTLS12 по умолчанию).
+	MinVersion   uint16
+	CipherPolicy string
+	// RedirectHTTPPort - порт, на котором HTTP-запросы перенаправляются на HTTPS ("" - не слушать).
+	RedirectHTTPPort string
+	// ClientCAFile - сертификаты УЦ, выпустившего клиентские сертификаты (смарт-карты).
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// yamlTLSConfig mirrors the tls section of config.yaml.
+type yamlTLSConfig struct {
+	CertFile         string `yaml:"cert_file"`
+	KeyFile          string `yaml:"key_file"`
+	MinVersion       string `yaml:"min_version"`
+	CipherPolicy     string `yaml:"cipher_policy"`
+	RedirectHTTPPort string `yaml:"redirect_http_port"`
+	ClientCAFile     string `yaml:"client_ca_file"`
+	ClientAuth       string `yaml:"client_auth"`
+}
+
+func parseTLSConfig(y yamlTLSConfig) (TLSConfig, error) {
+	cfg := TLSConfig{
+		CertFile:         y.CertFile,
+		KeyFile:          y.KeyFile,
+		MinVersion:       tls.VersionTLS12,
+		CipherPolicy:     cipherPolicyModern,
+		RedirectHTTPPort: y.RedirectHTTPPort,
+		ClientCAFile:     y.ClientCAFile,
+		ClientAuth:       clientAuthOff,
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return cfg, fmt.Errorf("tls: cert_file and key_file are required")
+	}
+	if y.MinVersion != "" {
+		v, ok := tlsVersions[y.MinVersion]
+		if !ok {
+			return cfg, fmt.Errorf("invalid value for tls.min_version: %q (expected 1.0, 1.1, 1.2 or 1.3)", y.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+	switch y.CipherPolicy {
+	case "":
+	case cipherPolicyModern, cipherPolicyCompatible:
+		cfg.CipherPolicy = y.CipherPolicy
+	default:
+		return cfg, fmt.Errorf("invalid value for tls.cipher_policy: %q (expected modern or compatible)", y.CipherPolicy)
+	}
+	switch y.ClientAuth {
+	case "":
+		if cfg.ClientCAFile != "" {
+			cfg.ClientAuth = clientAuthOptional
+		}
+	case clientAuthOff, clientAuthOptional, clientAuthRequired:
+		cfg.ClientAuth = y.ClientAuth
+	default:
+		return cfg, fmt.Errorf("invalid value for tls.client_auth: %q (expected off, optional or required)", y.ClientAuth)
+	}
+	if cfg.ClientAuth != clientAuthOff && cfg.ClientCAFile == "" {
+		return cfg, fmt.Errorf("tls.client_auth is %q, but tls.client_ca_file is not set", cfg.ClientAuth)
+	}
+	return cfg, nil
+}
+
+// newServerTLSConfig загружает сертификат и УЦ клиентов; ошибка здесь - ошибка конфигурации.
+// Сертификат потом перечитывается сам, когда файлы на диске меняются.
+func newServerTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{
+		MinVersion:     cfg.MinVersion,
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.CipherPolicy == cipherPolicyModern {
+		tc.CipherSuites = modernCipherSuites
+	}
+
+	if cfg.ClientAuth != clientAuthOff {
+		data, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls.client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls.client_ca_file %q: no PEM certificates found", cfg.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ClientAuth == clientAuthRequired {
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tc, nil
+}
+
+// certReloader отдаёт сертификат сервера и перечитывает его, когда меняются
+// файлы: обновлённый сертификат подхватывается без перезапуска службы.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	// checkInterval - не чаще какого интервала проверять файлы.
+	checkInterval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, checkInterval: certCheckInterval}
+	certMod, keyMod, err := c.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	c.checked = time.Now()
+	return c, nil
+}
+
+func (c *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	ci, err := os.Stat(c.certFile)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("tls certificate: %w", err)
+	}
+	ki, err := os.Stat(c.keyFile)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("tls key: %w", err)
+	}
+	return ci.ModTime(), ki.ModTime(), nil
+}
+
+// load читает пару сертификат/ключ. Должна вызываться под c.mu (или до начала работы).
+func (c *certReloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate %q: %w", c.certFile, err)
+	}
+	c.cert, c.certMod, c.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+// GetCertificate - для tls.Config. Если файлы сейчас заменяются и пара не
+// читается (сертификат уже новый, ключ ещё старый), отдаётся прежний
+// сертификат, а попытка повторяется при следующей проверке.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= c.checkInterval {
+		c.checked = time.Now()
+		certMod, keyMod, err := c.modTimes()
+		switch {
+		case err != nil:
+			log.Printf("Error checking TLS certificate: %v", err)
+		case !certMod.Equal(c.certMod) || !keyMod.Equal(c.keyMod):
+			if err := c.load(certMod, keyMod); err != nil {
+				log.Printf("Error reloading TLS certificate, keeping the previous one: %v", err)
+			} else {
+				log.Printf("TLS certificate reloaded from %s", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// httpsRedirectHandler перенаправляет запросы на тот же адрес по HTTPS на порт httpsPort.
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// ClientCertConfig - вход по клиентскому сертификату (смарт-карте), проверенному
+// при установке TLS-соединения (tls.client_ca_file).
+type ClientCertConfig struct {
+	// UserField - откуда брать логин: cn, email или upn (имя входа Windows из смарт-карты).
+	UserField string
+	// UPNDomain - домен UPN для user_field: upn ("example.local"). Логин берётся
+	// без домена, поэтому сертификаты с другим доменом не принимаются: иначе
+	// ivanov@other.local вошёл бы как ivanov.
+	UPNDomain string
+}
+
+// yamlClientCertConfig mirrors auth.client_cert in config.yaml.
+type yamlClientCertConfig struct {
+	UserField string `yaml:"user_field"`
+	UPNDomain string `yaml:"upn_domain"`
+}
+
+func parseClientCertConfig(y yamlClientCertConfig) (ClientCertConfig, error) {
+	cfg := ClientCertConfig{UserField: certUserCN, UPNDomain: strings.TrimSpace(y.UPNDomain)}
+	switch y.UserField {
+	case "":
+	case certUserCN, certUserEmail, certUserUPN:
+		cfg.UserField = y.UserField
+	default:
+		return cfg, fmt.Errorf("invalid value for auth.client_cert.user_field: %q (expected cn, email or upn)", y.UserField)
+	}
+	if cfg.UserField == certUserUPN && cfg.UPNDomain == "" {
+		return cfg, fmt.Errorf("auth.client_cert: upn_domain is required for user_field: upn")
+	}
+	return cfg, nil
+}
+
+// clientCertUser возвращает пользователя по проверенному клиентскому сертификату
+// или nil, если сертификата нет или в нём нет нужного поля (для upn - UPN домена cfg.UPNDomain).
+func clientCertUser(r *http.Request, cfg ClientCertConfig) *User {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var name string
+	switch cfg.UserField {
+	case certUserEmail:
+		if len(cert.EmailAddresses) > 0 {
+			name = cert.EmailAddresses[0]
+		}
+	case certUserUPN:
+		// "ivanov@example.local" -> "ivanov", как при входе через Kerberos.
+		user, domain, _ := strings.Cut(certUPN(cert), "@")
+		if !strings.EqualFold(domain, cfg.UPNDomain) {
+			log.Printf("Client certificate %q: UPN %s is outside domain %s", cert.Subject.CommonName, certUPN(cert), cfg.UPNDomain)
+			return nil
+		}
+		name = user
+	default:
+		name = cert.Subject.CommonName
+	}
+	if name == "" {
+		return nil
+	}
+	// Логин в нижнем регистре, как при входе через Kerberos, LDAP и OIDC: иначе
+	// один человек получил бы разные отметки, статистику и права по users:.
+	return &User{Name: strings.ToLower(name), DisplayName: cert.Subject.CommonName}
+}
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	// oidUserPrincipalName - otherName с именем входа Windows в сертификатах смарт-карт.
+	oidUserPrincipalName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// certUPN возвращает UPN из расширения subjectAltName (x509 его не разбирает).
+func certUPN(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return ""
+		}
+		for _, n := range names {
+			// otherName ::= [0] { type-id OID, value [0] EXPLICIT ANY }
+			if n.Class != asn1.ClassContextSpecific || n.Tag != 0 {
+				continue
+			}
+			var typeID asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(n.Bytes, &typeID)
+			if err != nil || !typeID.Equal(oidUserPrincipalName) {
+				continue
+			}
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(rest, &value); err != nil {
+				continue
+			}
+			var upn string
+			if _, err := asn1.UnmarshalWithParams(value.Bytes, &upn, "utf8"); err == nil {
+				return upn
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, both as parsed values and PEM.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues a certificate from tmpl, signed by parent (self-signed if nil).
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func newTestCA(t *testing.T) testCert {
+	return newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newTestServerCert(t *testing.T, ca *testCert, serial int64) testCert {
+	return newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "docs.example.local"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+}
+
+// upnExtension builds subjectAltName with a Windows logon name, as on smart cards.
+func upnExtension(t *testing.T, upn string) pkix.Extension {
+	t.Helper()
+	value, err := asn1.MarshalWithParams(upn, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeID, err := asn1.Marshal(oidUserPrincipalName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherName := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(typeID, explicit...)}
+	san, err := asn1.Marshal([]asn1.RawValue{otherName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidSubjectAltName, Value: san}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTLSConfig(t *testing.T) {
+	cfg, err := parseTLSConfig(yamlTLSConfig{CertFile: "server.crt", KeyFile: "server.key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.CipherPolicy != cipherPolicyModern || cfg.ClientAuth != clientAuthOff {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+
+	cfg, err = parseTLSConfig(yamlTLSConfig{CertFile: "server.crt", KeyFile: "server.key", MinVersion: "1.3", ClientCAFile: "ca.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.ClientAuth != clientAuthOptional {
+		t.Errorf("expected TLS 1.3 and optional client certificates: %+v", cfg)
+	}
+
+	for name, y := range map[string]yamlTLSConfig{
+		"no key":             {CertFile: "server.crt"},
+		"bad version":        {CertFile: "server.crt", KeyFile: "server.key", MinVersion: "1.4"},
+		"bad policy":         {CertFile: "server.crt", KeyFile: "server.key", CipherPolicy: "strong"},
+		"client auth w/o CA": {CertFile: "server.crt", KeyFile: "server.key", ClientAuth: clientAuthRequired},
+	} {
+		if _, err := parseTLSConfig(y); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadConfig_ClientCertRequiresTLS(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestFile(t, cfgPath, []byte("auth:\n  mode: required\n  client_cert:\n    user_field: upn\n    upn_domain: example.local\n"))
+	if _, err := LoadConfig(cfgPath); err == nil || !strings.Contains(err.Error(), "client_ca_file") {
+		t.Errorf("expected error about client_ca_file, got %v", err)
+	}
+
+	writeTestFile(t, cfgPath, []byte("tls:\n  cert_file: a.crt\n  key_file: a.key\n  client_ca_file: ca.pem\n"+
+		"auth:\n  mode: required\n  client_cert:\n    user_field: upn\n    upn_domain: example.local\n"))
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.TLS == nil || cfg.Auth.ClientCert == nil || cfg.Auth.ClientCert.UserField != certUserUPN || cfg.Auth.ClientCert.UPNDomain != "example.local" {
+		t.Errorf("unexpected config: %+v %+v", cfg.TLS, cfg.Auth.ClientCert)
+	}
+
+	// Logins are taken without the domain, so the domain has to be known.
+	if _, err := parseClientCertConfig(yamlClientCertConfig{UserField: certUserUPN}); err == nil || !strings.Contains(err.Error(), "upn_domain") {
+		t.Errorf("expected error about upn_domain, got %v", err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	first := newTestServerCert(t, &ca, 10)
+	writeTestFile(t, certFile, first.certPEM)
+	writeTestFile(t, keyFile, first.keyPEM)
+
+	c, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkInterval = 0
+	serial := func() int64 {
+		cert, err := c.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if got := serial(); got != 10 {
+		t.Fatalf("expected the first certificate, got serial %d", got)
+	}
+
+	// The certificate is replaced on disk.
+	second := newTestServerCert(t, &ca, 20)
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, certFile, second.certPEM)
+	writeTestFile(t, keyFile, second.keyPEM)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := serial(); got != 20 {
+		t.Errorf("expected the renewed certificate, got serial %d", got)
+	}
+
+	// Half-written files do not break the server.
+	later = later.Add(time.Minute)
+	writeTestFile(t, keyFile, []byte("garbage"))
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := serial(); got != 20 {
+		t.Errorf("expected the previous certificate to be kept, got serial %d", got)
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	for _, c := range []struct {
+		port, host, target, want string
+	}{
+		{"443", "docs.example.local", "/docs/a.pdf?x=1", "https://docs.example.local/docs/a.pdf?x=1"},
+		{"8443", "docs.example.local:8080", "/normdocs/", "https://docs.example.local:8443/normdocs/"},
+		{"443", "[::1]:80", "/", "https://[::1]/"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, c.target, nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(c.port).ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != c.want {
+			t.Errorf("%s%s: got %d %q, want %q", c.host, c.target, rec.Code, rec.Header().Get("Location"), c.want)
+		}
+	}
+}
+
+func TestCertUPN(t *testing.T) {
+	ca := newTestCA(t)
+	card := newTestCert(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(30),
+		Subject:         pkix.Name{CommonName: "Иванов Иван Иванович"},
+		ExtraExtensions: []pkix.Extension{upnExtension(t, "ivanov@example.local")},
+	}, &ca)
+	if got := certUPN(card.cert); got != "ivanov@example.local" {
+		t.Errorf("certUPN = %q", got)
+	}
+	if got := certUPN(ca.cert); got != "" {
+		t.Errorf("expected no UPN in the CA certificate, got %q", got)
+	}
+}
+
+// startTLSTestServer serves h over TLS with the given client authentication mode.
+func startTLSTestServer(t *testing.T, clientAuth string, h http.Handler) (addr string, ca testCert) {
+	t.Helper()
+	dir := t.TempDir()
+	ca = newTestCA(t)
+	server := newTestServerCert(t, &ca, 10)
+	cfg := TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		MinVersion:   tls.VersionTLS12,
+		CipherPolicy: cipherPolicyModern,
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+		ClientAuth:   clientAuth,
+	}
+	writeTestFile(t, cfg.CertFile, server.certPEM)
+	writeTestFile(t, cfg.KeyFile, server.keyPEM)
+	writeTestFile(t, cfg.ClientCAFile, ca.certPEM)
+
+	tc, err := newServerTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h, TLSConfig: tc}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String(), ca
+}
+
+func tlsTestClient(ca testCert, clientCert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tc := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		cert, _ := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+}
+
+func TestMutualTLS_ClientCertLogin(t *testing.T) {
+	a := &authenticator{mode: authModeRequired, sessions: newSessionStore(time.Hour),
+		clientCert: &ClientCertConfig{UserField: certUserUPN, UPNDomain: "EXAMPLE.LOCAL"}}
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := userFromRequest(r)
+		w.Write([]byte(u.Name + " " + u.DisplayName + " " + requestScheme(r)))
+	}))
+	addr, ca := startTLSTestServer(t, clientAuthOptional, h)
+
+	card := newTestCert(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(30),
+		Subject:         pkix.Name{CommonName: "Иванов Иван Иванович"},
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{upnExtension(t, "Ivanov@Example.Local")},
+	}, &ca)
+	resp, err := tlsTestClient(ca, &card).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ivanov Иванов Иван Иванович https" {
+		t.Errorf("expected login by the smart card certificate, got %d %q", resp.StatusCode, body)
+	}
+	if c := resp.Cookies(); len(c) != 1 || c[0].Name != sessionCookieName || !c[0].Secure {
+		t.Errorf("expected a secure session cookie, got %v", c)
+	}
+
+	// Without a certificate, or with a card of another domain, the user has to log in on the login page.
+	foreign := newTestCert(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(31),
+		Subject:         pkix.Name{CommonName: "Иванов из другого домена"},
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{upnExtension(t, "ivanov@other.local")},
+	}, &ca)
+	for name, cert := range map[string]*testCert{"no certificate": nil, "another domain": &foreign} {
+		client := tlsTestClient(ca, cert)
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err = client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("%s: expected redirect to the login page, got %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestClientCertUser_LowercasesLogin(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "Ivanov"},
+		EmailAddresses: []string{"Ivanov@Example.Local"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	for field, want := range map[string]string{certUserCN: "ivanov", certUserEmail: "ivanov@example.local"} {
+		if u := clientCertUser(r, ClientCertConfig{UserField: field}); u == nil || u.Name != want {
+			t.Errorf("%s: expected login %q, got %+v", field, want, u)
+		}
+	}
+}
+
+func TestMutualTLS_Required(t *testing.T) {
+	addr, ca := startTLSTestServer(t, clientAuthRequired, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if _, err := tlsTestClient(ca, nil).Get("https://" + addr + "/"); err == nil {
+		t.Error("expected the handshake to fail without a client certificate")
+	}
+
+	// A certificate from another CA is rejected too.
+	other := newTestCA(t)
+	stranger := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(40),
+		Subject:      pkix.Name{CommonName: "stranger"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &other)
+	if _, err := tlsTestClient(ca, &stranger).Get("https://" + addr + "/"); err == nil {
+		t.Error("expected the handshake to fail with a certificate from an unknown CA")
+	}
+}
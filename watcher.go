@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Режимы отслеживания изменений в каталоге документов (поле watch в config.yaml).
+const (
+	// auto - события ФС (inotify/ReadDirectoryChangesW), а для сетевых путей
+	// вида \\server\share - периодический опрос.
+	watchModeAuto = "auto"
+	// notify - только события ФС.
+	watchModeNotify = "notify"
+	// poll - периодический опрос дерева каталогов (для сетевых шар, где события не приходят).
+	watchModePoll = "poll"
+	// off - без отслеживания, кэш обновляется по cache_ttl при обращении.
+	watchModeOff = "off"
+)
+
+// watchDebounce - пауза после последнего события перед пересканированием:
+// копирование пачки файлов порождает десятки событий, а сканировать нужно один раз.
+var watchDebounce = time.Second
+
+func validWatchMode(mode string) bool {
+	switch mode {
+	case watchModeAuto, watchModeNotify, watchModePoll, watchModeOff:
+		return true
+	}
+	return false
+}
+
+// Watch запускает фоновое отслеживание изменений в каталоге документов.
+// После запуска кэш обновляется в фоне по событиям (или по результатам опроса
+// раз в pollInterval), а запросы всегда получают готовые данные из кэша.
+// Раз в cache_ttl каталог дополнительно пересканируется целиком - на случай
+// потерянных событий. Отслеживание прекращается при отмене ctx.
+func (r *DocRepository) Watch(ctx context.Context, mode string, pollInterval time.Duration) error {
+	if mode == watchModeOff {
+		return nil
+	}
+
+	requested := mode
+	if mode == watchModeAuto {
+		mode = watchModeNotify
+		if isNetworkPath(r.dir) {
+			mode = watchModePoll
+		}
+	}
+
+	var watcher *fsnotify.Watcher
+	if mode == watchModeNotify {
+		var err error
+		watcher, err = newRecursiveWatcher(r.dir)
+		if err != nil {
+			if requested != watchModeAuto {
+				return fmt.Errorf("watch docs directory: %w", err)
+			}
+			log.Printf("Filesystem events unavailable for %s, falling back to polling: %v", r.dir, err)
+			mode = watchModePoll
+		}
+	}
+
+	r.mu.Lock()
+	r.watching = true
+	r.mu.Unlock()
+
+	if watcher != nil {
+		go r.watchEvents(ctx, watcher)
+	} else {
+		go r.watchPoll(ctx, pollInterval)
+	}
+
+	log.Printf("Watching %s for changes (mode: %s)", r.dir, mode)
+	return nil
+}
+
+// refreshInBackground пересканирует каталог, логируя ошибку.
+func (r *DocRepository) refreshInBackground(reason string) {
+	start := time.Now()
+	if err := r.Refresh(); err != nil {
+		log.Printf("Error rescanning docs directory (%s): %v", reason, err)
+		return
+	}
+	log.Printf("Docs directory rescanned (%s) in %s", reason, time.Since(start).Round(time.Millisecond))
+}
+
+// watchEvents обрабатывает события fsnotify: новые поддиректории ставятся на
+// наблюдение, а пересканирование запускается после паузы watchDebounce.
+func (r *DocRepository) watchEvents(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	r.refreshInBackground("initial scan")
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	periodic := newTTLTicker(r.ttl)
+	defer periodic.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			debounce.Stop()
+			return
+
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := addRecursive(watcher, ev.Name); err != nil {
+						log.Printf("Error watching new directory %s: %v", ev.Name, err)
+					}
+				}
+			}
+			debounce.Reset(watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// При переполнении очереди часть событий потеряна - пересканируем целиком.
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				debounce.Reset(watchDebounce)
+			}
+			log.Printf("Watcher error: %v", err)
+
+		case <-debounce.C:
+			r.refreshInBackground("files changed")
+
+		case <-periodic.C:
+			r.refreshInBackground("periodic")
+		}
+	}
+}
+
+// watchPoll раз в interval сравнивает отпечаток дерева каталогов (пути, размеры
+// и время изменения файлов) с предыдущим и пересканирует каталог при отличии.
+func (r *DocRepository) watchPoll(ctx context.Context, interval time.Duration) {
+	// Отпечаток снимаем до сканирования, чтобы не пропустить изменения во время него.
+	last, _ := treeFingerprint(r.dir)
+	r.refreshInBackground("initial scan")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	periodic := newTTLTicker(r.ttl)
+	defer periodic.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			fp, err := treeFingerprint(r.dir)
+			if err != nil {
+				log.Printf("Error polling docs directory: %v", err)
+				continue
+			}
+			if fp != last {
+				last = fp
+				r.refreshInBackground("files changed")
+			}
+
+		case <-periodic.C:
+			r.refreshInBackground("periodic")
+		}
+	}
+}
+
+// newTTLTicker возвращает тикер для периодического полного пересканирования.
+// При нулевом TTL тикер не срабатывает никогда.
+func newTTLTicker(ttl time.Duration) *time.Ticker {
+	if ttl <= 0 {
+		t := time.NewTicker(time.Hour)
+		t.Stop()
+		return t
+	}
+	return time.NewTicker(ttl)
+}
+
+// newRecursiveWatcher создаёт fsnotify.Watcher, наблюдающий за dir и всеми
+// его поддиректориями (fsnotify сам по себе не рекурсивен).
+func newRecursiveWatcher(dir string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := addRecursive(watcher, dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func addRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Недоступные поддиректории пропускаем, корень - обязателен.
+			if path == root {
+				return err
+			}
+			log.Printf("Error accessing %s: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+// treeFingerprint возвращает хэш от путей, размеров и времени изменения
+// всех файлов дерева.
+func treeFingerprint(root string) (uint64, error) {
+	h := fnv.New64a()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64(), err
+}
+
+// isNetworkPath сообщает, похож ли путь на сетевую шару Windows (\\server\share или //server/share).
+func isNetworkPath(path string) bool {
+	return strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//")
+}
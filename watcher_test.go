@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForDocuments polls repo until the total number of documents equals want.
+func waitForDocuments(t *testing.T, repo *DocRepository, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sections, err := repo.GetSections()
+		if err != nil {
+			t.Fatalf("GetSections failed: %v", err)
+		}
+		total := 0
+		for _, s := range sections {
+			total += len(s.Documents)
+		}
+		if total == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d documents, got %d", want, total)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func testWatchMode(t *testing.T, mode string) {
+	oldDebounce := watchDebounce
+	watchDebounce = 20 * time.Millisecond
+	defer func() { watchDebounce = oldDebounce }()
+
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc1.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// TTL is long on purpose: changes must be picked up by the watcher, not by expiry.
+	repo := NewDocRepository(tmpDir, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := repo.Watch(ctx, mode, 20*time.Millisecond); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	waitForDocuments(t, repo, 1)
+
+	// New file in the root.
+	if err := os.WriteFile(filepath.Join(tmpDir, "doc2.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForDocuments(t, repo, 2)
+
+	// New subdirectory and a file inside it must be noticed too.
+	subDir := filepath.Join(tmpDir, "HR")
+	if err := os.Mkdir(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(subDir, "hiring.pdf"), []byte("pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForDocuments(t, repo, 3)
+
+	// Removal.
+	if err := os.Remove(filepath.Join(tmpDir, "doc1.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	waitForDocuments(t, repo, 2)
+}
+
+func TestDocRepository_WatchNotify(t *testing.T) {
+	testWatchMode(t, watchModeNotify)
+}
+
+func TestDocRepository_WatchPoll(t *testing.T) {
+	testWatchMode(t, watchModePoll)
+}
+
+func TestIsNetworkPath(t *testing.T) {
+	cases := map[string]bool{
+		`\\fileserver\docs`: true,
+		"//fileserver/docs": true,
+		"./docs":            false,
+		`C:\Docs`:           false,
+	}
+	for path, want := range cases {
+		if got := isNetworkPath(path); got != want {
+			t.Errorf("isNetworkPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zipStoredExts - форматы, которые уже сжаты: в архив они кладутся без
+// повторного сжатия, чтобы не тратить процессор впустую.
+var zipStoredExts = map[string]bool{
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true,
+	".zip": true, ".jpg": true, ".jpeg": true, ".png": true,
+}
+
+// errZipTooLarge - файлы выросли после сканирования, и архив превысил ограничение.
+var errZipTooLarge = errors.New("archive size limit exceeded")
+
+// zipEntry - документ в архиве.
+type zipEntry struct {
+	// rel - путь относительно каталога документов, name - внутри архива.
+	rel  string
+	name string
+	doc  Document
+}
+
+// zipHandler отдаёт все документы раздела одним ZIP-архивом: GET /zip/<раздел>,
+// с ?recursive=1 - вместе с подразделами ("/zip/" - раздел "Общее", а с
+// recursive - весь каталог). Архив пишется прямо в ответ, без временных файлов.
+// Разделы, закрытые для пользователя, в архив не попадают, а архив больше
+// maxSize не отдаётся (maxSize <= 0 - без ограничения).
+//
+// Архив пишется дольше write_timeout сервера, поэтому перед каждым файлом срок
+// записи продлевается на writeTimeout - столько же, сколько дано на скачивание
+// этого файла по отдельности (0 - сервер срок не ограничивает).
+func zipHandler(repo *DocRepository, audit *auditLog, stats *statsStore, maxSize int64, writeTimeout time.Duration) http.Handler {
+	if maxSize <= 0 {
+		maxSize = math.MaxInt64
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dir := strings.Trim(path.Clean("/"+r.PathValue("path")), "/")
+		recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive"))
+
+		sections, err := repo.SectionsFor(userFromRequest(r))
+		if err != nil {
+			http.Error(w, "Could not load documents", http.StatusInternalServerError)
+			log.Printf("Error getting sections: %v", err)
+			return
+		}
+
+		var entries []zipEntry
+		var total int64
+		for _, s := range sections {
+			if s.Path != dir && !(recursive && isSubsection(s.Path, dir)) {
+				continue
+			}
+			for _, d := range s.Documents {
+				name := d.Path
+				if dir != "" {
+					name = strings.TrimPrefix(d.Path, dir+"/")
+				}
+				entries = append(entries, zipEntry{rel: d.Path, name: name, doc: d})
+				total += d.Size
+			}
+		}
+		if len(entries) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if total > maxSize {
+			http.Error(w, fmt.Sprintf("Archive would be %s, the limit is %s; download the documents one by one",
+				formatSize(total), formatSize(maxSize)), http.StatusForbidden)
+			return
+		}
+
+		filename := generalSectionName + ".zip"
+		if dir != "" {
+			filename = strings.ReplaceAll(dir, "/", "_") + ".zip"
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+		rc := http.NewResponseController(w)
+		zw := zip.NewWriter(w)
+		var written int64
+		for _, e := range entries {
+			if writeTimeout > 0 {
+				if err := rc.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+					log.Printf("Error extending write deadline for ZIP archive: %v", err)
+				}
+			}
+			fullPath := filepath.Join(repo.dir, filepath.FromSlash(e.rel))
+			n, err := writeZipEntry(zw, fullPath, e, maxSize-written)
+			written += n
+			if errors.Is(err, fs.ErrNotExist) {
+				// Удалён после сканирования.
+				continue
+			}
+			if err != nil {
+				// Без оглавления (zw.Close) архив останется заведомо повреждённым,
+				// и клиент не примет обрезанный архив за полный.
+				log.Printf("Error writing %s to ZIP archive: %v", e.rel, err)
+				return
+			}
+			audit.record(r, repo, e.rel, fullPath, auditResultOK, http.StatusOK, int(n))
+			stats.countRequest(r, e.rel, http.StatusOK)
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("Error finishing ZIP archive: %v", err)
+		}
+	})
+}
+
+// writeZipEntry добавляет в архив файл fullPath, но не больше limit байт.
+func writeZipEntry(zw *zip.Writer, fullPath string, e zipEntry, limit int64) (int64, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.doc.ModTime}
+	if zipStoredExts[strings.ToLower(path.Ext(e.name))] {
+		h.Method = zip.Store
+	}
+	fw, err := zw.CreateHeader(h)
+	if err != nil {
+		return 0, err
+	}
+	// Читаем на байт больше лимита, чтобы заметить превышение.
+	if limit < math.MaxInt64 {
+		limit++
+	}
+	n, err := io.Copy(fw, io.LimitReader(f, limit))
+	if err == nil && n == limit {
+		err = errZipTooLarge
+	}
+	return n, err
+}
+
+// isSubsection сообщает, вложен ли раздел p в раздел dir ("" - корень).
+func isSubsection(p, dir string) bool {
+	if dir == "" {
+		return p != ""
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+// sectionsWithSubsections возвращает пути разделов, у которых среди sections
+// есть подразделы: для кнопки "с подразделами" на главной.
+func sectionsWithSubsections(sections []Section) map[string]bool {
+	res := map[string]bool{}
+	for _, s := range sections {
+		if s.Path == "" {
+			continue
+		}
+		res[""] = true
+		for p := path.Dir(s.Path); p != "."; p = path.Dir(p) {
+			res[p] = true
+		}
+	}
+	return res
+}
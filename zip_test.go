@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func serveZip(t *testing.T, h http.Handler, url string, u *User) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("GET /zip/{path...}", h)
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if u != nil {
+		req = req.WithContext(contextWithUser(req.Context(), u))
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// zipContents returns archive entry names mapped to their contents.
+func zipContents(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid ZIP archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestZipHandler_Section(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	h := zipHandler(repo, nil, nil, 0, 0)
+
+	rec := serveZip(t, h, "/zip/Unrestricted", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename=Unrestricted.zip` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	files := zipContents(t, rec.Body.Bytes())
+	if len(files) != 1 || files["readme.txt"] != "text" {
+		t.Errorf("unexpected archive contents: %v", files)
+	}
+
+	rec = serveZip(t, h, "/zip/Unrestricted?recursive=1", nil)
+	files = zipContents(t, rec.Body.Bytes())
+	if len(files) != 2 || files["readme.txt"] != "text" || files["Sub/memo.pdf"] != "memo" {
+		t.Errorf("unexpected recursive archive contents: %v", files)
+	}
+}
+
+func TestZipHandler_RespectsAccess(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	h := zipHandler(repo, nil, nil, 0, 0)
+
+	// A closed section looks like a missing one.
+	if rec := serveZip(t, h, "/zip/HR", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("anonymous /zip/HR: expected 404, got %d", rec.Code)
+	}
+	if rec := serveZip(t, h, "/zip/Missing", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("/zip/Missing: expected 404, got %d", rec.Code)
+	}
+
+	// Recursive archives skip closed sub-sections.
+	rec := serveZip(t, h, "/zip/HR?recursive=1", &User{Name: "petrov", Groups: []string{"Everyone"}})
+	files := zipContents(t, rec.Body.Bytes())
+	if len(files) != 1 || files["Open/holidays.pdf"] != "holidays" {
+		t.Errorf("unexpected archive contents for logged-in user: %v", files)
+	}
+
+	rec = serveZip(t, h, "/zip/?recursive=1", &User{Name: "ivanov", Groups: []string{"HR"}})
+	var names []string
+	for name := range zipContents(t, rec.Body.Bytes()) {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	want := []string{"HR/Open/holidays.pdf", "HR/salary.pdf", "Unrestricted/Sub/memo.pdf", "Unrestricted/readme.txt", "public.pdf"}
+	if !slices.Equal(names, want) {
+		t.Errorf("whole tree for HR user = %v, want %v", names, want)
+	}
+}
+
+func TestZipHandler_SizeLimit(t *testing.T) {
+	repo := newAccessTestRepo(t)
+
+	// "holidays" is 8 bytes.
+	rec := serveZip(t, zipHandler(repo, nil, nil, 7, 0), "/zip/HR/Open", &User{Name: "petrov"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 over the limit, got %d", rec.Code)
+	}
+
+	rec = serveZip(t, zipHandler(repo, nil, nil, 8, 0), "/zip/HR/Open", &User{Name: "petrov"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 at the limit, got %d", rec.Code)
+	}
+}
+
+func TestZipHandler_WritesAuditLog(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	audit := openTestAuditLog(t)
+
+	rec := serveZip(t, zipHandler(repo, audit, nil, 0, 0), "/zip/Unrestricted?recursive=1", &User{Name: "petrov"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	records := readAuditRecords(t, audit)
+	var paths []string
+	for _, r := range records {
+		paths = append(paths, r.Path)
+		if r.User != "petrov" || r.Result != auditResultOK || r.SHA256 == "" {
+			t.Errorf("unexpected audit record: %+v", r)
+		}
+	}
+	slices.Sort(paths)
+	if want := []string{"Unrestricted/Sub/memo.pdf", "Unrestricted/readme.txt"}; !slices.Equal(paths, want) {
+		t.Errorf("audited paths = %v, want %v", paths, want)
+	}
+}
+
+func TestSectionsWithSubsections(t *testing.T) {
+	got := sectionsWithSubsections([]Section{{Path: ""}, {Path: "HR/Open/2024"}, {Path: "Board"}})
+	for _, p := range []string{"", "HR", "HR/Open"} {
+		if !got[p] {
+			t.Errorf("expected %q to have sub-sections", p)
+		}
+	}
+	for _, p := range []string{"Board", "HR/Open/2024"} {
+		if got[p] {
+			t.Errorf("expected %q to have no sub-sections", p)
+		}
+	}
+}
+
+func TestZipHandler_ExtendsWriteDeadline(t *testing.T) {
+	repo := newAccessTestRepo(t)
+	mux := http.NewServeMux()
+	mux.Handle("GET /zip/{path...}", zipHandler(repo, nil, nil, 0, time.Minute))
+	// The deadline must reach the connection through the middleware wrappers.
+	h := loggingMiddleware(basePathMiddleware("/normdocs", routeMiddleware(mux, mux)))
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The archive starts after WriteTimeout has already passed, as with
+		// a large section: without extending the deadline it is cut off.
+		time.Sleep(100 * time.Millisecond)
+		h.ServeHTTP(w, r)
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/normdocs/zip/Unrestricted?recursive=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("archive was cut off: %v", err)
+	}
+	if files := zipContents(t, data); len(files) != 2 {
+		t.Errorf("unexpected archive contents: %v", files)
+	}
+}